@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// EnvKey is read for the account key when -auth=key is used without -key
+const EnvKey = "COSMOS_KEY"
+
+// AuthModes are the values accepted by -auth. default tries the whole
+// DefaultAzureCredential chain, the others build exactly one credential
+var AuthModes = []string{"default", "cli", "env", "managed-identity", "key"}
+
+// OpenClient prints the startup lines of the connection, the emulator notice
+// and the SDK retry policy, and creates its client with NewClient. Every tool
+// but load starts this way, load prints both with the rest of its configuration
+func (c Connection) OpenClient() (*azcosmos.Client, error) {
+	if c.IsEmulator() {
+		fmt.Printf("[EMULATOR MODE] local emulator endpoint detected, TLS verification is disabled\n")
+	}
+	fmt.Printf("SDK retries: %s\n", c.RetrySummary())
+	return c.NewClient()
+}
+
+// NewClient creates an Azure Cosmos DB client authenticated with the
+// connection's auth mode. A credential that cannot be created fails with an
+// error naming the mode instead of falling through a credential chain
+func (c Connection) NewClient() (*azcosmos.Client, error) {
+	if c.AuthMode == "key" {
+		cred, err := azcosmos.NewKeyCredential(c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("-auth=key: failed to create key credential: %w", err)
+		}
+		client, err := azcosmos.NewClientWithKey(c.Endpoint, cred, c.ClientOptions())
+		if err != nil {
+			return nil, fmt.Errorf("-auth=key: failed to create client: %w", err)
+		}
+		return client, nil
+	}
+
+	cred, err := c.tokenCredential()
+	if err != nil {
+		return nil, fmt.Errorf("-auth=%s: failed to create credential: %w", c.AuthMode, err)
+	}
+	client, err := azcosmos.NewClient(c.Endpoint, cred, c.ClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("-auth=%s: failed to create client: %w", c.AuthMode, err)
+	}
+	return client, nil
+}
+
+// tokenCredential returns the Microsoft Entra ID credential of the auth mode
+func (c Connection) tokenCredential() (azcore.TokenCredential, error) {
+	switch c.AuthMode {
+	case "cli":
+		return azidentity.NewAzureCLICredential(nil)
+	case "env":
+		return azidentity.NewEnvironmentCredential(nil)
+	case "managed-identity":
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		if c.ClientID != "" {
+			options.ID = azidentity.ClientID(c.ClientID)
+		}
+		return azidentity.NewManagedIdentityCredential(options)
+	default:
+		return azidentity.NewDefaultAzureCredential(nil)
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// request timeouts for the emulator and for real accounts
+const (
+	EmulatorTimeout = 5 * time.Second
+	DefaultTimeout  = 30 * time.Second
+)
+
+// defaults of the azcore retry policy, which -sdk-max-retries and
+// -sdk-retry-delay start from
+const (
+	DefaultSDKMaxRetries = 3
+	DefaultSDKRetryDelay = 800 * time.Millisecond
+)
+
+// maxUserAgentSuffix is the longest application ID azcore keeps, longer ones are cut
+const maxUserAgentSuffix = 24
+
+// IsEmulatorEndpoint reports whether endpoint points at a local Cosmos DB emulator
+func IsEmulatorEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+
+	host := u.Hostname()
+	return host == "localhost" || host == "127.0.0.1"
+}
+
+// ClientOptions returns the azcosmos client options for endpoint. The emulator
+// uses a self-signed certificate, so TLS verification is skipped for it and
+// requests time out sooner
+func ClientOptions(endpoint string) *azcosmos.ClientOptions {
+	httpClient := &http.Client{Timeout: DefaultTimeout}
+
+	if IsEmulatorEndpoint(endpoint) {
+		httpClient = &http.Client{
+			Timeout: EmulatorTimeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // emulator certificate is self-signed
+			},
+		}
+	}
+
+	options := &azcosmos.ClientOptions{}
+	options.Transport = httpClient
+	return options
+}
+
+// ClientOptions returns the azcosmos client options for the connection, with
+// the application and preferred regions, the SDK retry policy, the proxy and
+// the user agent suffix applied
+func (c Connection) ClientOptions() *azcosmos.ClientOptions {
+	options := ClientOptions(c.Endpoint)
+	options.PreferredRegions = c.Regions()
+
+	options.Retry = policy.RetryOptions{
+		MaxRetries: int32(c.SDKMaxRetries),
+		RetryDelay: c.SDKRetryDelay,
+	}
+	if c.SDKMaxRetries == 0 {
+		// azcore reads 0 as its default, a negative value disables retries
+		options.Retry.MaxRetries = -1
+	}
+	options.Telemetry.ApplicationID = c.UserAgentSuffix
+	options.PerRetryPolicies = append(options.PerRetryPolicies, c.PerRetryPolicies...)
+
+	if c.HTTPProxy != "" {
+		proxy, _ := parseProxy(c.HTTPProxy) // checked by Validate
+		httpClient := options.Transport.(*http.Client)
+		transport, ok := httpClient.Transport.(*http.Transport)
+		if !ok {
+			transport = http.DefaultTransport.(*http.Transport)
+		}
+		transport = transport.Clone()
+		transport.Proxy = http.ProxyURL(proxy)
+		httpClient.Transport = transport
+	}
+	return options
+}
+
+// RetrySummary describes the effective SDK retry policy for the startup output
+func (c Connection) RetrySummary() string {
+	if c.SDKMaxRetries == 0 {
+		return "disabled"
+	}
+	return fmt.Sprintf("up to %d retries, %v initial delay", c.SDKMaxRetries, c.SDKRetryDelay)
+}
+
+// RedactedProxy returns -http-proxy with any password masked, for the startup output
+func (c Connection) RedactedProxy() string {
+	proxy, err := parseProxy(c.HTTPProxy)
+	if err != nil {
+		return c.HTTPProxy
+	}
+	return proxy.Redacted()
+}
+
+// parseProxy parses a -http-proxy URL
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("%q: scheme must be http, https or socks5", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q: missing host", raw)
+	}
+	return u, nil
+}
+
+// ServingEndpoint reads the database and returns the host that answered, which
+// shows the regional endpoint the client routes requests to. A database that
+// does not exist yet still reports the host that returned the 404
+func (c Connection) ServingEndpoint(ctx context.Context, client *azcosmos.Client) (string, error) {
+	database, err := client.NewDatabase(c.DatabaseName)
+	if err != nil {
+		return "", fmt.Errorf("failed to create database client: %w", err)
+	}
+
+	resp, err := database.Read(ctx, nil)
+	raw := resp.RawResponse
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if !errors.As(err, &respErr) || respErr.RawResponse == nil {
+			return "", fmt.Errorf("failed to reach the account: %w", err)
+		}
+		raw = respErr.RawResponse
+	}
+	if raw == nil || raw.Request == nil {
+		return "", fmt.Errorf("response carries no request")
+	}
+	return raw.Request.URL.Host, nil
+}
+
+// IsEmulator reports whether the connection targets a local Cosmos DB emulator
+func (c Connection) IsEmulator() bool {
+	return IsEmulatorEndpoint(c.Endpoint)
+}
@@ -0,0 +1,189 @@
+// Package config defines the connection flags shared by the load and query
+// tools and resolves them against environment variables
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// environment variables read when the matching flag is not set
+const (
+	EnvEndpoint       = "COSMOS_ENDPOINT"
+	EnvLegacyEndpoint = "COSMOS_DB_ENDPOINT" // older name used by the query tool
+	EnvDatabase       = "COSMOS_DB_DATABASE_NAME"
+	EnvContainer      = "COSMOS_DB_CONTAINER_NAME"
+	EnvRegions        = "COSMOS_PREFERRED_REGIONS"
+	EnvAppRegion      = "COSMOS_APP_REGION"
+)
+
+// Connection holds the Azure Cosmos DB settings shared by both tools
+type Connection struct {
+	Endpoint      string
+	DatabaseName  string
+	ContainerName string
+
+	// PreferredRegions orders the regions requests are sent to on a
+	// multi-region account, empty lets the SDK use the account's write region
+	PreferredRegions []string
+
+	// ApplicationRegion is the region the tool runs in. The SDK has no
+	// proximity routing, so it is tried before the preferred regions
+	ApplicationRegion string
+
+	// AuthMode selects the credential, one of AuthModes. ClientID picks a
+	// user assigned managed identity, Key is the account key for key auth
+	AuthMode string
+	ClientID string
+	Key      string
+
+	// SDKMaxRetries and SDKRetryDelay tune the azcore retry policy, which
+	// retries 408, 429 and 5xx responses before the tools see an error
+	SDKMaxRetries int
+	SDKRetryDelay time.Duration
+
+	// HTTPProxy routes requests through a proxy instead of the one from the
+	// environment, UserAgentSuffix tags requests in Azure diagnostics
+	HTTPProxy       string
+	UserAgentSuffix string
+
+	// PerRetryPolicies are added to the client pipeline after the SDK's own
+	// retry policies, so they see every request. Tools set them, not flags
+	PerRetryPolicies []policy.Policy `json:"-"`
+}
+
+// Loader owns the FlagSet of a tool. The shared connection flags are defined
+// by NewLoader, tools add their own flags to FlagSet before calling Parse
+type Loader struct {
+	FlagSet    *flag.FlagSet
+	connection Connection
+	regions    string
+}
+
+// NewLoader creates a Loader whose FlagSet already defines the connection flags
+func NewLoader(name string) *Loader {
+	l := &Loader{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+
+	l.FlagSet.StringVar(&l.connection.Endpoint, "endpoint", "", "Azure Cosmos DB endpoint URL (env: "+EnvEndpoint+")")
+	l.FlagSet.StringVar(&l.connection.DatabaseName, "database", "sampleDB", "Database name (env: "+EnvDatabase+")")
+	l.FlagSet.StringVar(&l.connection.ContainerName, "container", "UserSessions", "Container name (env: "+EnvContainer+")")
+	l.FlagSet.StringVar(&l.regions, "regions", "", "Comma-separated preferred regions in order, e.g. \"West Europe,North Europe\" (env: "+EnvRegions+")")
+	l.FlagSet.StringVar(&l.regions, "preferred-regions", "", "Alias of -regions")
+	l.FlagSet.StringVar(&l.connection.AuthMode, "auth", "default", fmt.Sprintf("Credential to authenticate with: one of %v", AuthModes))
+	l.FlagSet.StringVar(&l.connection.ClientID, "client-id", "", "Client ID of a user assigned managed identity for -auth=managed-identity")
+	l.FlagSet.StringVar(&l.connection.Key, "key", "", "Account key for -auth=key (env: "+EnvKey+")")
+	l.FlagSet.IntVar(&l.connection.SDKMaxRetries, "sdk-max-retries", DefaultSDKMaxRetries, "Times the SDK retries a throttled or failed request, 0 disables SDK retries")
+	l.FlagSet.DurationVar(&l.connection.SDKRetryDelay, "sdk-retry-delay", DefaultSDKRetryDelay, "Initial delay between SDK retries, doubled on each retry")
+	l.FlagSet.StringVar(&l.connection.HTTPProxy, "http-proxy", "", "Proxy URL for all requests, e.g. http://proxy:8080 (default: HTTPS_PROXY from the environment)")
+	l.FlagSet.StringVar(&l.connection.UserAgentSuffix, "user-agent-suffix", "", fmt.Sprintf("Application ID added to the User-Agent header, at most %d characters without spaces", maxUserAgentSuffix))
+	l.FlagSet.StringVar(&l.connection.ApplicationRegion, "app-region", "", "Region the tool runs in, tried before the preferred regions (env: "+EnvAppRegion+")")
+
+	return l
+}
+
+// Parse parses args, fills connection settings whose flag was not given from
+// the environment and validates that the required settings are present
+func (l *Loader) Parse(args []string) (Connection, error) {
+	if err := l.FlagSet.Parse(args); err != nil {
+		return Connection{}, err
+	}
+
+	// flags given on the command line take precedence over the environment
+	set := map[string]bool{}
+	l.FlagSet.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	overlay := func(name string, target *string, envVars ...string) {
+		if set[name] {
+			return
+		}
+		for _, envVar := range envVars {
+			if value := os.Getenv(envVar); value != "" {
+				*target = value
+				return
+			}
+		}
+	}
+	overlay("endpoint", &l.connection.Endpoint, EnvEndpoint, EnvLegacyEndpoint)
+	overlay("database", &l.connection.DatabaseName, EnvDatabase)
+	overlay("container", &l.connection.ContainerName, EnvContainer)
+	if !set["preferred-regions"] {
+		overlay("regions", &l.regions, EnvRegions)
+	}
+	overlay("app-region", &l.connection.ApplicationRegion, EnvAppRegion)
+	overlay("key", &l.connection.Key, EnvKey)
+	l.connection.ApplicationRegion = strings.TrimSpace(l.connection.ApplicationRegion)
+
+	l.connection.PreferredRegions = nil
+	for _, region := range strings.Split(l.regions, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			l.connection.PreferredRegions = append(l.connection.PreferredRegions, region)
+		}
+	}
+
+	if err := l.connection.Validate(); err != nil {
+		return Connection{}, err
+	}
+	return l.connection, nil
+}
+
+// Regions returns the regions requests are routed to in order: the application
+// region first, then the preferred regions without it
+func (c Connection) Regions() []string {
+	if c.ApplicationRegion == "" {
+		return c.PreferredRegions
+	}
+	regions := []string{c.ApplicationRegion}
+	for _, region := range c.PreferredRegions {
+		if !strings.EqualFold(region, c.ApplicationRegion) {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// Validate checks that every required connection setting is present
+func (c Connection) Validate() error {
+	var errs []error
+	if c.Endpoint == "" {
+		errs = append(errs, fmt.Errorf("missing endpoint: provide it via -endpoint or the %s environment variable", EnvEndpoint))
+	}
+	if c.DatabaseName == "" {
+		errs = append(errs, fmt.Errorf("missing database name: provide it via -database or the %s environment variable", EnvDatabase))
+	}
+	if c.ContainerName == "" {
+		errs = append(errs, fmt.Errorf("missing container name: provide it via -container or the %s environment variable", EnvContainer))
+	}
+	if !slices.Contains(AuthModes, c.AuthMode) {
+		errs = append(errs, fmt.Errorf("invalid -auth %q: must be one of %v", c.AuthMode, AuthModes))
+	}
+	if c.AuthMode == "key" && c.Key == "" {
+		errs = append(errs, fmt.Errorf("-auth=key needs the account key: provide it via -key or the %s environment variable", EnvKey))
+	}
+	if c.ClientID != "" && c.AuthMode != "managed-identity" {
+		errs = append(errs, fmt.Errorf("-client-id requires -auth=managed-identity"))
+	}
+	if c.SDKMaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("invalid -sdk-max-retries %d: must not be negative", c.SDKMaxRetries))
+	}
+	if c.SDKRetryDelay <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -sdk-retry-delay %v: must be positive", c.SDKRetryDelay))
+	}
+	if c.HTTPProxy != "" {
+		if _, err := parseProxy(c.HTTPProxy); err != nil {
+			errs = append(errs, fmt.Errorf("invalid -http-proxy: %w", err))
+		}
+	}
+	if len(c.UserAgentSuffix) > maxUserAgentSuffix || strings.ContainsAny(c.UserAgentSuffix, " \t") {
+		errs = append(errs, fmt.Errorf("invalid -user-agent-suffix %q: must be at most %d characters without spaces", c.UserAgentSuffix, maxUserAgentSuffix))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,110 @@
+// Package diag extracts the request diagnostics of a failed Cosmos DB request,
+// the details a support ticket asks for, and prints them as a block
+package diag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// response headers carrying the diagnostics
+const (
+	headerActivityID    = "x-ms-activity-id"
+	headerSubStatus     = "x-ms-substatus"
+	headerRequestCharge = "x-ms-request-charge"
+)
+
+// Diagnostics describes one failed request
+type Diagnostics struct {
+	Operation     string
+	StatusCode    int
+	SubStatus     string
+	ActivityID    string
+	RequestCharge string
+	ErrorCode     string
+	PartitionKey  []string
+	Err           error
+}
+
+// FromError returns the diagnostics of err, a failed operation on the
+// partition key values partitionKey. Errors that never reached the service,
+// such as timeouts, only carry the operation, partition key and error
+func FromError(operation string, err error, partitionKey ...string) Diagnostics {
+	d := Diagnostics{
+		Operation:    operation,
+		PartitionKey: partitionKey,
+		Err:          err,
+	}
+
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return d
+	}
+	d.StatusCode = respErr.StatusCode
+	d.ErrorCode = respErr.ErrorCode
+	if respErr.RawResponse != nil {
+		header := respErr.RawResponse.Header
+		d.ActivityID = header.Get(headerActivityID)
+		d.SubStatus = header.Get(headerSubStatus)
+		d.RequestCharge = header.Get(headerRequestCharge)
+	}
+	return d
+}
+
+// Print writes the diagnostics as an indented block. With redact the partition
+// key values are replaced by a short hash, which still tells equal keys apart
+func (d Diagnostics) Print(w io.Writer, redact bool) {
+	fmt.Fprintf(w, "🔎 Request diagnostics: %s\n", d.Operation)
+	fmt.Fprintf(w, " Status: %s\n", orUnknown(d.status()))
+	fmt.Fprintf(w, " Activity ID: %s\n", orUnknown(d.ActivityID))
+	fmt.Fprintf(w, " Request charge: %s\n", orUnknown(d.RequestCharge))
+	if d.ErrorCode != "" {
+		fmt.Fprintf(w, " Error code: %s\n", d.ErrorCode)
+	}
+	if len(d.PartitionKey) > 0 {
+		values := d.PartitionKey
+		if redact {
+			values = make([]string, len(d.PartitionKey))
+			for i, value := range d.PartitionKey {
+				values[i] = Redact(value)
+			}
+		}
+		fmt.Fprintf(w, " Partition key: [%s]\n", strings.Join(values, ", "))
+	}
+	if d.Err != nil {
+		// azcore errors span several lines, the first one names the request
+		message, _, _ := strings.Cut(d.Err.Error(), "\n")
+		fmt.Fprintf(w, " Error: %s\n", message)
+	}
+}
+
+// status formats the status code with its substatus, e.g. "429/3200"
+func (d Diagnostics) status() string {
+	if d.StatusCode == 0 {
+		return ""
+	}
+	if d.SubStatus == "" || d.SubStatus == "0" {
+		return fmt.Sprint(d.StatusCode)
+	}
+	return fmt.Sprintf("%d/%s", d.StatusCode, d.SubStatus)
+}
+
+// Redact replaces a partition key value by the first bytes of its SHA-256
+func Redact(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// orUnknown returns value, or "unknown" when the response did not carry it
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,110 @@
+package diag
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// headerRetryAfter is the delay Cosmos DB asks for before retrying a 429
+const headerRetryAfter = "x-ms-retry-after-ms"
+
+// Attempt is one HTTP request the SDK pipeline sent for an operation
+type Attempt struct {
+	Method        string
+	Host          string
+	StatusCode    int
+	SubStatus     string
+	RequestCharge string
+	ActivityID    string
+	RetryAfter    string
+	Latency       time.Duration
+	Err           error
+}
+
+// Trace collects the attempts of one operation. The SDK retries throttled and
+// failed requests and fails over between regions on its own, the trace shows
+// every request it sent on the way
+type Trace struct {
+	Operation string
+
+	mu       sync.Mutex
+	start    time.Time
+	attempts []Attempt
+}
+
+// traceKey is the context key of the Trace of an operation
+type traceKey struct{}
+
+// WithTrace returns a context that records the requests sent with it into the
+// returned Trace, as long as the client was created with TracePolicy
+func WithTrace(ctx context.Context, operation string) (context.Context, *Trace) {
+	t := &Trace{Operation: operation, start: time.Now()}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// TracePolicy returns the per retry pipeline policy that records every request into
+// the Trace of its context. Requests without a Trace pass through untouched
+func TracePolicy() policy.Policy {
+	return tracePolicy{}
+}
+
+type tracePolicy struct{}
+
+func (tracePolicy) Do(req *policy.Request) (*http.Response, error) {
+	t, ok := req.Raw().Context().Value(traceKey{}).(*Trace)
+	if !ok {
+		return req.Next()
+	}
+
+	attempt := Attempt{Method: req.Raw().Method, Host: req.Raw().URL.Host}
+	start := time.Now()
+	resp, err := req.Next()
+	attempt.Latency = time.Since(start)
+	attempt.Err = err
+	if resp != nil {
+		attempt.StatusCode = resp.StatusCode
+		attempt.SubStatus = resp.Header.Get(headerSubStatus)
+		attempt.RequestCharge = resp.Header.Get(headerRequestCharge)
+		attempt.ActivityID = resp.Header.Get(headerActivityID)
+		attempt.RetryAfter = resp.Header.Get(headerRetryAfter)
+	}
+
+	t.mu.Lock()
+	t.attempts = append(t.attempts, attempt)
+	t.mu.Unlock()
+	return resp, err
+}
+
+// Print writes the trace as an indented block, one line per request
+func (t *Trace) Print(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hosts := map[string]bool{}
+	for _, attempt := range t.attempts {
+		hosts[attempt.Host] = true
+	}
+	fmt.Fprintf(w, "🔎 SDK diagnostics: %s\n", t.Operation)
+	fmt.Fprintf(w, " Requests: %d to %d endpoints, %v in total\n", len(t.attempts), len(hosts), time.Since(t.start).Round(time.Microsecond))
+	for i, attempt := range t.attempts {
+		d := Diagnostics{StatusCode: attempt.StatusCode, SubStatus: attempt.SubStatus}
+		line := fmt.Sprintf(" #%d %s %s: status %s, %v, RU %s, activity ID %s",
+			i+1, attempt.Method, attempt.Host, orUnknown(d.status()), attempt.Latency.Round(time.Microsecond),
+			orUnknown(attempt.RequestCharge), orUnknown(attempt.ActivityID))
+		if attempt.RetryAfter != "" {
+			line += fmt.Sprintf(", retry after %sms", attempt.RetryAfter)
+		}
+		if attempt.Err != nil {
+			message, _, _ := strings.Cut(attempt.Err.Error(), "\n")
+			line += ", error: " + message
+		}
+		fmt.Fprintln(w, line)
+	}
+}
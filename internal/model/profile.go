@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// ProfileType is the type discriminator of UserProfile documents
+const ProfileType = "profile"
+
+// ProfileSessionID pads the third partition key level of a profile stored in
+// a container partitioned by /tenantId, /userId, /sessionId
+const ProfileSessionID = "profile"
+
+// UserProfile is the profile document of a user of a tenant
+type UserProfile struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	TenantID    string    `json:"tenantId"`
+	UserID      string    `json:"userId"`
+	SessionID   string    `json:"sessionId,omitempty"`
+	DisplayName string    `json:"displayName"`
+	Plan        string    `json:"plan"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
@@ -0,0 +1,86 @@
+// Package model holds the document types shared by the load and query tools
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the current version of the UserSession document layout
+const SchemaVersion = 1
+
+// user session data model with heirarchical partition keys
+// key/column/field with highest cardinality comes first/level 1 as the
+// sample partitioned keys /tenantId/userId/sessionId
+type UserSession struct {
+	ID            string    `json:"id"`
+	TenantID      string    `json:"tenantId"`  // level 1: Tenant Isolation
+	UserID        string    `json:"userId"`    // level 2: User distribution
+	SessionID     string    `json:"sessionId"` // level 3: session granularity
+	Activity      string    `json:"activity"`
+	Timestamp     time.Time `json:"timestamp"`
+	SchemaVersion int       `json:"schemaVersion"`
+	TTL           int       `json:"ttl,omitempty"` // per-item time to live in seconds, overrides the container default
+
+	// client details, shared by every event of a session
+	DeviceType string `json:"deviceType,omitempty"`
+	IPAddress  string `json:"ipAddress,omitempty"`
+	Country    string `json:"country,omitempty"`
+	UserAgent  string `json:"userAgent,omitempty"`
+
+	// set on sessions rewritten by anomaly injection so detection queries can
+	// be checked against the ground truth
+	Anomalous   bool   `json:"anomalous,omitempty"`
+	AnomalyType string `json:"anomalyType,omitempty"`
+}
+
+// MigrationFunc upgrades a raw document from one schema version to the next
+type MigrationFunc func(doc map[string]any) error
+
+// Migrations maps a schema version to the function that upgrades a document
+// from that version to version+1
+var Migrations = map[int]MigrationFunc{
+	// documents written before schemaVersion existed carry no version field
+	// and already match the version 1 layout
+	0: func(doc map[string]any) error { return nil },
+}
+
+// MigrateDocument reads the schemaVersion of a raw document, applies every
+// registered migration up to SchemaVersion and returns the up-to-date session
+func MigrateDocument(raw json.RawMessage) (UserSession, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return UserSession{}, fmt.Errorf("failed to unmarshal document: %w", err)
+	}
+
+	version := 0
+	if v, ok := doc["schemaVersion"].(float64); ok {
+		version = int(v)
+	}
+	if version > SchemaVersion {
+		return UserSession{}, fmt.Errorf("document schema version %d is newer than supported version %d", version, SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		migrate, ok := Migrations[version]
+		if !ok {
+			return UserSession{}, fmt.Errorf("no migration registered for schema version %d", version)
+		}
+		if err := migrate(doc); err != nil {
+			return UserSession{}, fmt.Errorf("failed to migrate document from schema version %d: %w", version, err)
+		}
+		doc["schemaVersion"] = version + 1
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return UserSession{}, fmt.Errorf("failed to marshal migrated document: %w", err)
+	}
+
+	var session UserSession
+	if err := json.Unmarshal(migrated, &session); err != nil {
+		return UserSession{}, fmt.Errorf("failed to unmarshal migrated document: %w", err)
+	}
+	return session, nil
+}
@@ -0,0 +1,11 @@
+package model
+
+// Tenant is the reference document of a tenant kept in the tenants container,
+// partitioned by /tenantId with the tenant ID doubling as the item ID
+type Tenant struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenantId"`
+	UserMin  int    `json:"userMin"`
+	UserMax  int    `json:"userMax"`
+	Sessions int    `json:"sessions"`
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxIDBytes bounds tenantId, userId and sessionId
+const maxIDBytes = 256
+
+// maxClockSkew is how far in the future a timestamp may be before it is rejected
+const maxClockSkew = time.Minute
+
+// registeredActivities holds the activity names Validate accepts
+var registeredActivities = map[string]bool{}
+
+// RegisterActivities adds names to the activities Validate accepts. It is not
+// safe to call while sessions are being validated
+func RegisterActivities(names ...string) {
+	for _, name := range names {
+		registeredActivities[name] = true
+	}
+}
+
+// Validate checks a session before it is written: the id is a random (v4) or
+// name based (v5, from -deterministic-ids) UUID, the partition key values are
+// present and at most 256 bytes, the activity is registered and the timestamp
+// is set and not in the future
+func (s UserSession) Validate() error {
+	var errs []error
+
+	if id, err := uuid.Parse(s.ID); err != nil {
+		errs = append(errs, fmt.Errorf("id %q is not a UUID", s.ID))
+	} else if id.Version() != 4 && id.Version() != 5 {
+		errs = append(errs, fmt.Errorf("id %q is a version %d UUID, expected version 4 or 5", s.ID, id.Version()))
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"tenantId", s.TenantID},
+		{"userId", s.UserID},
+		{"sessionId", s.SessionID},
+	} {
+		if field.value == "" {
+			errs = append(errs, fmt.Errorf("%s is empty", field.name))
+		} else if len(field.value) > maxIDBytes {
+			errs = append(errs, fmt.Errorf("%s is %d bytes, the limit is %d", field.name, len(field.value), maxIDBytes))
+		}
+	}
+
+	if !registeredActivities[s.Activity] {
+		errs = append(errs, fmt.Errorf("activity %q is not registered", s.Activity))
+	}
+
+	if s.Timestamp.IsZero() {
+		errs = append(errs, errors.New("timestamp is not set"))
+	} else if ahead := time.Until(s.Timestamp); ahead > maxClockSkew {
+		errs = append(errs, fmt.Errorf("timestamp %s is %v in the future", s.Timestamp.Format(time.RFC3339), ahead.Round(time.Second)))
+	}
+
+	return errors.Join(errs...)
+}
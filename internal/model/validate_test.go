@@ -0,0 +1,53 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	RegisterActivities("login")
+	valid := UserSession{
+		ID:        "9b2f3c7e-6d1a-4f0b-8c2e-5a7d9e1f3b4c",
+		TenantID:  "Enterprise-Corp",
+		UserID:    "user-42",
+		SessionID: "session-5af6ab47",
+		Activity:  "login",
+		Timestamp: time.Now().Add(-time.Hour),
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*UserSession)
+		wantErr string
+	}{
+		{"valid", func(*UserSession) {}, ""},
+		{"name based id", func(s *UserSession) { s.ID = "886313e1-3b8a-5372-9b90-0c9aee199e5d" }, ""},
+		{"id not a UUID", func(s *UserSession) { s.ID = "session-1" }, "is not a UUID"},
+		{"time based id", func(s *UserSession) { s.ID = "c232ab00-9414-11ec-b3c8-9e6bdeced846" }, "version 1 UUID"},
+		{"empty tenant", func(s *UserSession) { s.TenantID = "" }, "tenantId is empty"},
+		{"long user", func(s *UserSession) { s.UserID = strings.Repeat("u", maxIDBytes+1) }, "userId is 257 bytes"},
+		{"empty session", func(s *UserSession) { s.SessionID = "" }, "sessionId is empty"},
+		{"unregistered activity", func(s *UserSession) { s.Activity = "teleport" }, `activity "teleport" is not registered`},
+		{"no timestamp", func(s *UserSession) { s.Timestamp = time.Time{} }, "timestamp is not set"},
+		{"future timestamp", func(s *UserSession) { s.Timestamp = time.Now().Add(time.Hour) }, "in the future"},
+		{"within clock skew", func(s *UserSession) { s.Timestamp = time.Now().Add(maxClockSkew / 2) }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := valid
+			tt.modify(&session)
+			err := session.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
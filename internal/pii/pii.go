@@ -0,0 +1,83 @@
+// Package pii encrypts personally identifiable fields before they are stored.
+// Encryption is deterministic: the nonce is derived from the key and the
+// plaintext, so equal values encrypt to equal ciphertexts and encrypted
+// partition key values still route every item of a user to the same partition
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// KeySize is the AES-256 key length in bytes
+const KeySize = 32
+
+// ParseKey decodes a hex encoded AES-256 key
+func ParseKey(value string) ([]byte, error) {
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid hex: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes (%d hex characters), got %d bytes", KeySize, KeySize*2, len(key))
+	}
+	return key, nil
+}
+
+// Cipher encrypts and decrypts fields with AES-256-GCM. It is safe for
+// concurrent use
+type Cipher struct {
+	key  []byte
+	aead cipher.AEAD
+}
+
+// NewCipher creates a Cipher for a 32 byte key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return &Cipher{key: key, aead: aead}, nil
+}
+
+// Encrypt returns the nonce and ciphertext of plaintext as URL safe base64.
+// The nonce is an HMAC-SHA256 of the plaintext, which only reveals whether two
+// values are equal
+func (c *Cipher) Encrypt(plaintext string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(plaintext))
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// Decrypt reverses Encrypt
+func (c *Cipher) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("ciphertext is not valid base64: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext is too short")
+	}
+
+	nonce, sealed := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt field: %w", err)
+	}
+	return string(plaintext), nil
+}
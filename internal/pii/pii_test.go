@@ -0,0 +1,128 @@
+package pii
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// testKey returns a key of KeySize bytes starting at b
+func testKey(b byte) []byte {
+	key := make([]byte, KeySize)
+	for i := range key {
+		key[i] = b + byte(i)
+	}
+	return key
+}
+
+func newTestCipher(t *testing.T, b byte) *Cipher {
+	t.Helper()
+	c, err := NewCipher(testKey(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newTestCipher(t, 1)
+	for _, plaintext := range []string{"", "user-42", "session-5af6ab47", "émilie@example.com", strings.Repeat("x", 4096)} {
+		ciphertext := c.Encrypt(plaintext)
+		if plaintext != "" && strings.Contains(ciphertext, plaintext) {
+			t.Errorf("ciphertext of %q contains the plaintext", plaintext)
+		}
+		if _, err := base64.RawURLEncoding.DecodeString(ciphertext); err != nil {
+			t.Errorf("ciphertext of %q is not URL safe base64: %v", plaintext, err)
+		}
+
+		got, err := c.Decrypt(ciphertext)
+		if err != nil {
+			t.Errorf("Decrypt(Encrypt(%q)) = %v", plaintext, err)
+			continue
+		}
+		if got != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q", plaintext, got)
+		}
+	}
+}
+
+func TestEncryptIsDeterministic(t *testing.T) {
+	c := newTestCipher(t, 1)
+	if c.Encrypt("user-42") != c.Encrypt("user-42") {
+		t.Error("the same plaintext encrypted to different ciphertexts, partition keys would not route")
+	}
+	if c.Encrypt("user-42") == c.Encrypt("user-43") {
+		t.Error("different plaintexts encrypted to the same ciphertext")
+	}
+
+	// a second cipher with the same key, as in query decrypting what load wrote
+	if newTestCipher(t, 1).Encrypt("user-42") != c.Encrypt("user-42") {
+		t.Error("ciphers with the same key encrypt differently")
+	}
+	if newTestCipher(t, 2).Encrypt("user-42") == c.Encrypt("user-42") {
+		t.Error("ciphers with different keys encrypt the same")
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	c := newTestCipher(t, 1)
+	ciphertext := c.Encrypt("user-42")
+	sealed, _ := base64.RawURLEncoding.DecodeString(ciphertext)
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name       string
+		cipher     *Cipher
+		ciphertext string
+		wantErr    string
+	}{
+		{"wrong key", newTestCipher(t, 2), ciphertext, "failed to decrypt"},
+		{"tampered", c, base64.RawURLEncoding.EncodeToString(tampered), "failed to decrypt"},
+		{"plaintext", c, "session-5af6ab47-user-4242", "failed to decrypt"},
+		{"not base64", c, "user 42!", "not valid base64"},
+		{"too short", c, base64.RawURLEncoding.EncodeToString([]byte("short")), "too short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.cipher.Decrypt(tt.ciphertext)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decrypt() err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	valid := strings.Repeat("ab", KeySize)
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"valid", valid, ""},
+		{"upper case", strings.ToUpper(valid), ""},
+		{"not hex", strings.Repeat("zz", KeySize), "not valid hex"},
+		{"too short", valid[:KeySize], "must be 32 bytes"},
+		{"too long", valid + "ab", "must be 32 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.value)
+			if tt.wantErr == "" {
+				if err != nil || len(key) != KeySize {
+					t.Errorf("ParseKey() = %d bytes, %v", len(key), err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseKey() err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewCipher(make([]byte, 16)); err == nil {
+		t.Error("NewCipher() accepted a 16 byte key")
+	}
+}
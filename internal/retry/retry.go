@@ -0,0 +1,112 @@
+// Package retry retries transient Cosmos DB failures with exponential backoff
+// and jitter, honouring the delay the service asks for after a 429
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// Policy retries transient Cosmos DB failures with exponential backoff.
+// It stops at MaxAttempts or once MaxElapsedTime has passed, whichever comes
+// first, so a burst of 429s with long retry-after delays cannot stall a write
+// for minutes
+type Policy struct {
+	MaxAttempts     int           // attempts including the first, 1 disables retries
+	MaxElapsedTime  time.Duration // total time budget across attempts, 0 means no limit
+	InitialInterval time.Duration // wait before the first retry
+	Multiplier      float64       // growth of the wait after each retry
+	MaxInterval     time.Duration // upper bound of a single wait
+	Jitter          float64       // fraction of each wait that is randomized, 0 disables
+}
+
+// Default is the policy of the tools, load overrides its budget with
+// -retry-max-attempts and -retry-max-elapsed
+var Default = Policy{
+	MaxAttempts:     3,
+	MaxElapsedTime:  30 * time.Second,
+	InitialInterval: 100 * time.Millisecond,
+	Multiplier:      2,
+	MaxInterval:     5 * time.Second,
+	Jitter:          0.5,
+}
+
+// Execute runs op until it succeeds, fails with an error that is not worth
+// retrying, or the policy's attempt or time budget is used up. The error of the
+// last attempt is returned. A backoff ends early when ctx is done, the error
+// then wraps both ctx.Err() and the last attempt's error
+func (p Policy) Execute(ctx context.Context, op func() error) error {
+	start := time.Now()
+	interval := p.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !isRetriable(err) {
+			return err
+		}
+		if attempt >= p.MaxAttempts {
+			return err
+		}
+
+		// jitter spreads out writers that were throttled at the same moment,
+		// the service knows best how long to back off after a 429
+		wait := min(interval, p.MaxInterval)
+		wait -= time.Duration(rand.Float64() * p.Jitter * float64(wait))
+		if retryAfter := retryAfter(err); retryAfter > wait {
+			wait = retryAfter
+		}
+		if p.MaxElapsedTime > 0 && time.Since(start)+wait > p.MaxElapsedTime {
+			return fmt.Errorf("giving up after %d attempts in %v: %w", attempt, time.Since(start).Round(time.Millisecond), err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w while backing off after %d attempts: %w", ctx.Err(), attempt, err)
+		}
+		interval = time.Duration(float64(interval) * p.Multiplier)
+	}
+}
+
+// isRetriable reports whether err is a transient Cosmos DB failure: throttling,
+// a request timeout, an attempt that ran past -op-timeout or the service being
+// briefly unavailable
+func isRetriable(err error) bool {
+	if errors.Is(err, timeout.ErrOpTimeout) {
+		return true
+	}
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	switch respErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusRequestTimeout, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay Cosmos DB asked for in the x-ms-retry-after-ms
+// header of a failed response, or 0 when there is none
+func retryAfter(err error) time.Duration {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.RawResponse == nil {
+		return 0
+	}
+	ms, parseErr := strconv.Atoi(respErr.RawResponse.Header.Get("x-ms-retry-after-ms"))
+	if parseErr != nil || ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
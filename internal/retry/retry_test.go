@@ -0,0 +1,171 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// responseError returns the error azcosmos reports for a response with status,
+// retryAfterMs sets the x-ms-retry-after-ms header when above 0
+func responseError(status, retryAfterMs int) error {
+	header := http.Header{}
+	if retryAfterMs > 0 {
+		header.Set("x-ms-retry-after-ms", strconv.Itoa(retryAfterMs))
+	}
+	return &azcore.ResponseError{
+		StatusCode:  status,
+		RawResponse: &http.Response{StatusCode: status, Header: header, Body: http.NoBody},
+	}
+}
+
+// fastPolicy retries without noticeable waits
+var fastPolicy = Policy{
+	MaxAttempts:     3,
+	InitialInterval: time.Millisecond,
+	Multiplier:      2,
+	MaxInterval:     5 * time.Millisecond,
+}
+
+func TestExecute(t *testing.T) {
+	errPlain := errors.New("connection reset")
+
+	tests := []struct {
+		name         string
+		policy       Policy
+		errs         []error // returned by successive attempts, nil once used up
+		wantAttempts int
+		wantStatus   int // status of the returned error, 0 for success or none
+		wantErr      error
+	}{
+		{name: "success", policy: fastPolicy, wantAttempts: 1},
+		{name: "429 retried", policy: fastPolicy, errs: []error{responseError(429, 0)}, wantAttempts: 2},
+		{name: "408 retried", policy: fastPolicy, errs: []error{responseError(408, 0)}, wantAttempts: 2},
+		{name: "503 retried", policy: fastPolicy, errs: []error{responseError(503, 0), responseError(503, 0)}, wantAttempts: 3},
+		{name: "op timeout retried", policy: fastPolicy, errs: []error{timeout.ErrOpTimeout}, wantAttempts: 2},
+		{name: "400 not retried", policy: fastPolicy, errs: []error{responseError(400, 0)}, wantAttempts: 1, wantStatus: 400},
+		{name: "404 not retried", policy: fastPolicy, errs: []error{responseError(404, 0)}, wantAttempts: 1, wantStatus: 404},
+		{name: "409 not retried", policy: fastPolicy, errs: []error{responseError(409, 0)}, wantAttempts: 1, wantStatus: 409},
+		{name: "413 not retried", policy: fastPolicy, errs: []error{responseError(413, 0)}, wantAttempts: 1, wantStatus: 413},
+		{name: "non response error not retried", policy: fastPolicy, errs: []error{errPlain}, wantAttempts: 1, wantErr: errPlain},
+		{
+			name:         "attempts capped",
+			policy:       fastPolicy,
+			errs:         []error{responseError(429, 0), responseError(429, 0), responseError(429, 0), responseError(429, 0)},
+			wantAttempts: 3,
+			wantStatus:   429,
+		},
+		{
+			name:         "single attempt",
+			policy:       Policy{MaxAttempts: 1},
+			errs:         []error{responseError(429, 0)},
+			wantAttempts: 1,
+			wantStatus:   429,
+		},
+		{
+			name:         "retry-after past the time budget",
+			policy:       Policy{MaxAttempts: 5, MaxElapsedTime: 50 * time.Millisecond, InitialInterval: time.Millisecond, Multiplier: 2, MaxInterval: time.Millisecond},
+			errs:         []error{responseError(429, 1000)},
+			wantAttempts: 1,
+			wantStatus:   429,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := tt.policy.Execute(context.Background(), func() error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			var respErr *azcore.ResponseError
+			status := 0
+			if errors.As(err, &respErr) {
+				status = respErr.StatusCode
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d (err %v)", status, tt.wantStatus, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantStatus == 0 && tt.wantErr == nil && err != nil {
+				t.Errorf("err = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestExecuteHonoursRetryAfter(t *testing.T) {
+	start := time.Now()
+	attempts := 0
+	err := fastPolicy.Execute(context.Background(), func() error {
+		attempts++
+		if attempts == 1 {
+			return responseError(429, 50)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Execute() = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("retried after %v, want at least the 50ms the service asked for", elapsed)
+	}
+}
+
+func TestExecuteStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{MaxAttempts: 5, InitialInterval: time.Hour, Multiplier: 1, MaxInterval: time.Hour}
+
+	attempts := 0
+	err := policy.Execute(ctx, func() error {
+		attempts++
+		cancel()
+		return responseError(429, 0)
+	})
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want it to wrap context.Canceled", err)
+	}
+	if !strings.Contains(err.Error(), "backing off") {
+		t.Errorf("err = %v, want it to say it was backing off", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"header", responseError(429, 250), 250 * time.Millisecond},
+		{"no header", responseError(429, 0), 0},
+		{"no response", &azcore.ResponseError{StatusCode: 429}, 0},
+		{"not a response error", errors.New("boom"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.err); got != tt.want {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Package timeout bounds single Cosmos DB requests by the -op-timeout of the
+// tools, telling a timed out request apart from a cancelled or expired run
+package timeout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrOpTimeout marks a single request that ran past -op-timeout. Unlike a
+// cancelled run it is worth retrying
+var ErrOpTimeout = errors.New("operation timed out")
+
+// WithOpTimeout runs op with a context bounded by timeout, 0 leaves it
+// unbounded. A timeout of op itself, rather than of ctx, is reported as
+// ErrOpTimeout
+func WithOpTimeout(ctx context.Context, timeout time.Duration, op func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return op(ctx)
+	}
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := op(opCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(opCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %v: %w", ErrOpTimeout, timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package timeout
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithOpTimeout(t *testing.T) {
+	// block waits for the operation's context like a stalled request
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		timeout     time.Duration
+		op          func(context.Context) error
+		wantTimeout bool
+	}{
+		{"no limit", context.Background(), 0, func(context.Context) error { return nil }, false},
+		{"within the limit", context.Background(), time.Second, func(context.Context) error { return nil }, false},
+		{"stalled", context.Background(), 10 * time.Millisecond, block, true},
+		{"load cancelled", cancelled, time.Second, block, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WithOpTimeout(tt.ctx, tt.timeout, tt.op)
+			if got := errors.Is(err, ErrOpTimeout); got != tt.wantTimeout {
+				t.Errorf("WithOpTimeout() = %v, want timeout %v", err, tt.wantTimeout)
+			}
+		})
+	}
+}
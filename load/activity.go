@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ActivityWeight is an activity and how often it is picked relative to the
+// others. A weight of 0 never picks the activity at random
+type ActivityWeight struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+}
+
+// prefix sums of the weights of weightedActivities, set by setActivityDistribution
+var activityCumulative []float64
+
+// activityNames returns the names of weighted in order
+func activityNames(weighted []ActivityWeight) []string {
+	names := make([]string, len(weighted))
+	for i, activity := range weighted {
+		names[i] = activity.Name
+	}
+	return names
+}
+
+// parseActivityWeights parses "name=weight,name=weight" into a map
+func parseActivityWeights(value string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, entry := range strings.Split(value, ",") {
+		name, weightText, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid entry %q: expected name=weight", entry)
+		}
+		weight, err := strconv.ParseFloat(weightText, 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight for %q: expected a non-negative number", name)
+		}
+		weights[name] = weight
+	}
+	return weights, nil
+}
+
+// setActivityWeights overrides the weights of the named activities in
+// weightedActivities, the others keep the weight they have
+func setActivityWeights(weights map[string]float64) error {
+	for name := range weights {
+		if !slices.Contains(activities, name) {
+			return fmt.Errorf("unknown activity %q", name)
+		}
+	}
+	for i, activity := range weightedActivities {
+		if weight, ok := weights[activity.Name]; ok {
+			weightedActivities[i].Weight = weight
+		}
+	}
+	return nil
+}
+
+// setActivityDistribution computes the prefix sums weightedRandomActivity
+// samples from
+func setActivityDistribution(weighted []ActivityWeight) error {
+	cumulative := make([]float64, len(weighted))
+	var total float64
+	for i, activity := range weighted {
+		total += activity.Weight
+		cumulative[i] = total
+	}
+	if total <= 0 {
+		return fmt.Errorf("at least one activity needs a positive weight")
+	}
+
+	activityCumulative = cumulative
+	return nil
+}
+
+// weightedRandomActivity returns an activity drawn from rng with probability
+// proportional to its weight, by a binary search of a uniform draw in the
+// prefix sums
+func weightedRandomActivity(rng *rand.Rand) string {
+	if activityCumulative == nil {
+		return activities[rng.Intn(len(activities))]
+	}
+	n := rng.Float64() * activityCumulative[len(activityCumulative)-1]
+	i := sort.Search(len(activityCumulative), func(i int) bool { return activityCumulative[i] > n })
+	return activities[min(i, len(activities)-1)]
+}
+
+// activityFollowUps are the actions that tend to follow an action within a
+// session, e.g. a created document gets edited. Actions not listed here, or
+// whose follow-ups were removed by -activities-file, are followed at random
+var activityFollowUps = map[string][]string{
+	"view_dashboard":  {"view_report", "send_message", "schedule_event"},
+	"create_document": {"edit_document", "upload_file", "send_message"},
+	"edit_document":   {"edit_document", "send_message", "export_data"},
+	"upload_file":     {"send_message", "create_document"},
+	"download_file":   {"edit_document", "view_report"},
+	"view_report":     {"export_data", "download_file"},
+	"send_message":    {"join_meeting", "schedule_event"},
+	"schedule_event":  {"invite_user", "send_message"},
+	"invite_user":     {"send_message", "join_meeting"},
+}
+
+// followUpChance is how often an action is followed by one of its follow-ups
+const followUpChance = 0.6
+
+// pickSessionAction returns the action following previous in a session: often
+// one of its follow-ups, otherwise a random activity. login and logout only
+// open and close a session, so they are not picked when other activities can be
+func pickSessionAction(rng *rand.Rand, previous string) string {
+	if rng.Float64() < followUpChance {
+		var candidates []string
+		for _, followUp := range activityFollowUps[previous] {
+			if slices.Contains(activities, followUp) {
+				candidates = append(candidates, followUp)
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[rng.Intn(len(candidates))]
+		}
+	}
+
+	if !slices.ContainsFunc(weightedActivities, func(a ActivityWeight) bool { return a.Name != "login" && a.Name != "logout" && a.Weight > 0 }) {
+		return weightedRandomActivity(rng)
+	}
+	for {
+		action := weightedRandomActivity(rng)
+		if action != "login" && action != "logout" {
+			return action
+		}
+	}
+}
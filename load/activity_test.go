@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFile writes content to a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestActivitiesFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // no file when empty
+		want    []ActivityWeight
+		wantErr string
+	}{
+		{name: "built-in fallback", want: weightedActivities},
+		{
+			name:    "names",
+			content: `["checkout", "add_to_cart"]`,
+			want:    []ActivityWeight{{"checkout", 1}, {"add_to_cart", 1}},
+		},
+		{
+			name:    "names and weights",
+			content: `["checkout", {"name": "browse", "weight": 8.5}, {"name": "refund"}]`,
+			want:    []ActivityWeight{{"checkout", 1}, {"browse", 8.5}, {"refund", 1}},
+		},
+		{name: "empty list", content: `[]`, wantErr: "at least one activity"},
+		{name: "empty name", content: `["checkout", ""]`, wantErr: "entry 1 is empty"},
+		{name: "name too long", content: `["` + strings.Repeat("x", maxActivityLength+1) + `"]`, wantErr: "exceeds 64 characters"},
+		{name: "negative weight", content: `[{"name": "checkout", "weight": -1}]`, wantErr: "negative weight"},
+		{name: "wrong entry type", content: `[42]`, wantErr: "must be a name or an object"},
+		{name: "not json", content: `checkout`, wantErr: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.content != "" {
+				path = writeFile(t, "activities.json", tt.content)
+			}
+			got, err := activitiesFrom(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("activitiesFrom() err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("activitiesFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := activitiesFrom(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("activitiesFrom() of a missing file succeeded")
+	}
+}
+
+// useActivities makes weighted the activity list for the rest of the test
+func useActivities(t *testing.T, weighted []ActivityWeight) {
+	t.Helper()
+	savedWeighted, savedNames, savedCumulative := weightedActivities, activities, activityCumulative
+	t.Cleanup(func() {
+		weightedActivities, activities, activityCumulative = savedWeighted, savedNames, savedCumulative
+	})
+
+	weightedActivities = weighted
+	activities = activityNames(weighted)
+	if err := setActivityDistribution(weighted); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWeightedRandomActivityDistribution(t *testing.T) {
+	tests := []struct {
+		name     string
+		weighted []ActivityWeight
+	}{
+		{"built-in", weightedActivities},
+		{"from a file", []ActivityWeight{{"checkout", 3}, {"browse", 1}, {"refund", 0}}},
+		{"equal weights", []ActivityWeight{{"a", 1}, {"b", 1}, {"c", 1}, {"d", 1}}},
+	}
+
+	const draws = 200000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useActivities(t, tt.weighted)
+			rng := rand.New(rand.NewSource(1))
+			counts := make(map[string]int)
+			for range draws {
+				counts[weightedRandomActivity(rng)]++
+			}
+
+			var total float64
+			for _, activity := range tt.weighted {
+				total += activity.Weight
+			}
+			for _, activity := range tt.weighted {
+				want := activity.Weight / total
+				got := float64(counts[activity.Name]) / draws
+				if math.Abs(got-want) > 0.01 {
+					t.Errorf("%s drawn %.3f of the time, want %.3f", activity.Name, got, want)
+				}
+				if activity.Weight == 0 && counts[activity.Name] > 0 {
+					t.Errorf("%s has weight 0 but was drawn %d times", activity.Name, counts[activity.Name])
+				}
+			}
+		})
+	}
+}
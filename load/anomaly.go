@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// anomaly types injected by -anomaly-rate
+const (
+	anomalyImpossibleTravel = "impossible_travel"
+	anomalyMassDelete       = "mass_delete"
+	anomalyOffHoursLogin    = "off_hours_login"
+)
+
+var anomalyTypes = []string{anomalyImpossibleTravel, anomalyMassDelete, anomalyOffHoursLogin}
+
+// UTC offsets in minutes used to place off-hours logins at 3am local time
+var countryUTCOffsets = map[string]int{
+	"US": -5 * 60,
+	"GB": 0,
+	"DE": 60,
+	"IN": 5*60 + 30,
+	"KE": 3 * 60,
+	"BR": -3 * 60,
+	"JP": 9 * 60,
+	"AU": 10 * 60,
+}
+
+// injectAnomaly rewrites the events of one session to follow a suspicious
+// pattern picked from rng and marks every event as anomalous. It returns the
+// new events and the anomaly type
+func injectAnomaly(rng *rand.Rand, events []UserSession) ([]UserSession, string) {
+	kind := anomalyTypes[rng.Intn(len(anomalyTypes))]
+
+	switch kind {
+	case anomalyImpossibleTravel:
+		// the session continues from another country a few minutes later
+		if len(events) < 2 {
+			next := events[0]
+			next.ID = uuid.NewString()
+			next.Activity = weightedRandomActivity(rng)
+			next.Timestamp = next.Timestamp.Add(time.Duration(rng.Intn(10)+1) * time.Minute)
+			events = append(events, next)
+		}
+		others := slices.DeleteFunc(slices.Clone(countries), func(c weighted) bool { return c.value == events[0].Country })
+		country := pickWeighted(rng, others)
+		ipAddress := randomIPAddress(rng, country)
+		for i := len(events) / 2; i < len(events); i++ {
+			events[i].Country = country
+			events[i].IPAddress = ipAddress
+		}
+
+	case anomalyMassDelete:
+		// hundreds of deletes in quick succession
+		count := 100 + rng.Intn(201)
+		first := events[0]
+		events = make([]UserSession, count)
+		timestamp := first.Timestamp
+		for i := range events {
+			event := first
+			event.ID = uuid.NewString()
+			event.Activity = "delete_document"
+			event.Timestamp = timestamp
+			events[i] = event
+			timestamp = timestamp.Add(time.Duration(rng.Intn(10)+1) * time.Second)
+		}
+
+	case anomalyOffHoursLogin:
+		// move the whole session so it starts at 3am in the user's country
+		offset := time.Duration(countryUTCOffsets[events[0].Country]) * time.Minute
+		local := events[0].Timestamp.Add(offset)
+		start := time.Date(local.Year(), local.Month(), local.Day(), 3, rng.Intn(60), 0, 0, time.UTC).Add(-offset)
+		shift := start.Sub(events[0].Timestamp)
+		for i := range events {
+			events[i].Timestamp = events[i].Timestamp.Add(shift)
+		}
+		events[0].Activity = "login"
+	}
+
+	for i := range events {
+		events[i].Anomalous = true
+		events[i].AnomalyType = kind
+	}
+	return events, kind
+}
+
+// printAnomalies prints how many sessions of each anomaly type were injected
+func printAnomalies(injected map[string]int) {
+	total := 0
+	for _, count := range injected {
+		total += count
+	}
+	fmt.Printf("\n🚨 Anomalies injected: %d sessions\n", total)
+	for _, kind := range anomalyTypes {
+		fmt.Printf(" %-20s %d\n", kind, injected[kind])
+	}
+}
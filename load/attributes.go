@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// weighted is a sample pool entry picked with probability weight/total
+type weighted struct {
+	value  string
+	weight int
+}
+
+// pickWeighted returns a value from pool drawn from rng
+func pickWeighted(rng *rand.Rand, pool []weighted) string {
+	total := 0
+	for _, entry := range pool {
+		total += entry.weight
+	}
+	n := rng.Intn(total)
+	for _, entry := range pool {
+		if n < entry.weight {
+			return entry.value
+		}
+		n -= entry.weight
+	}
+	return pool[len(pool)-1].value
+}
+
+// device types, desktops dominate business applications
+var deviceTypes = []weighted{
+	{"desktop", 60},
+	{"mobile", 30},
+	{"tablet", 10},
+}
+
+// countries sessions originate from
+var countries = []weighted{
+	{"US", 40},
+	{"GB", 12},
+	{"DE", 10},
+	{"IN", 10},
+	{"KE", 8},
+	{"BR", 7},
+	{"JP", 7},
+	{"AU", 6},
+}
+
+// first octet of the addresses handed out per country, documentation ranges
+// are avoided so the addresses look like real traffic
+var countryIPPrefixes = map[string][]int{
+	"US": {23, 34, 52, 98},
+	"GB": {51, 81, 86},
+	"DE": {46, 79, 91},
+	"IN": {49, 103, 117},
+	"KE": {41, 102, 105},
+	"BR": {177, 179, 189},
+	"JP": {60, 126, 153},
+	"AU": {1, 101, 124},
+}
+
+// user agents per device type
+var userAgents = map[string][]weighted{
+	"desktop": {
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36", 50},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", 30},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0", 20},
+	},
+	"mobile": {
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", 50},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Mobile Safari/537.36", 50},
+	},
+	"tablet": {
+		{"Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", 70},
+		{"Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36", 30},
+	},
+}
+
+// randomIPAddress returns an IPv4 address from one of the country's prefixes
+func randomIPAddress(rng *rand.Rand, country string) string {
+	prefixes := countryIPPrefixes[country]
+	return fmt.Sprintf("%d.%d.%d.%d", prefixes[rng.Intn(len(prefixes))], rng.Intn(256), rng.Intn(256), 1+rng.Intn(254))
+}
+
+// assignClientAttributes fills the device, country, IP address and user agent
+// of a session
+func assignClientAttributes(rng *rand.Rand, session *UserSession) {
+	session.DeviceType = pickWeighted(rng, deviceTypes)
+	session.Country = pickWeighted(rng, countries)
+	session.IPAddress = randomIPAddress(rng, session.Country)
+	session.UserAgent = pickWeighted(rng, userAgents[session.DeviceType])
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// writeStrategy is one way -bench-writes loads the benchmark records
+type writeStrategy struct {
+	name  string
+	write func(ctx context.Context, containerClient *azcosmos.ContainerClient, partitionKey azcosmos.PartitionKey, bodies [][]byte, batchSize int) writeBenchResult
+}
+
+// writeBenchResult is the outcome of one strategy. latencies holds one sample
+// per item, a batch spreads its latency over the items it wrote
+type writeBenchResult struct {
+	charge    float64
+	elapsed   time.Duration
+	latencies []time.Duration
+	requests  int
+	failures  int
+	lastErr   error
+}
+
+var writeStrategies = []writeStrategy{
+	{name: "individual upserts", write: upsertIndividually},
+	{name: "transactional batches", write: upsertInBatches},
+}
+
+// runWriteBenchmark writes the same config.BenchWrites events of one session
+// with every strategy and prints their RU charge, wall time and per-item
+// latency side by side. Each strategy writes to its own session, so both insert
+// new items into an equally empty logical partition. The events are generated
+// from config.Seed, so the payloads only differ in their id and sessionId
+func runWriteBenchmark(containerClient *azcosmos.ContainerClient, config Config) error {
+	ctx, stop := runContext(config)
+	defer stop()
+
+	rng := rand.New(rand.NewSource(config.Seed))
+	tenant := tenantTypes[rng.Intn(len(tenantTypes))]
+	events := generateSessionEvents(rng, config.BenchWrites, tenant, time.Now().UTC())
+	runID := fmt.Sprintf("%08x", rng.Uint32())
+
+	fmt.Printf("Benchmarking %d writes to one logical partition of tenant %s, batches of up to %d\n",
+		config.BenchWrites, tenant.Name, config.BatchSize)
+	fmt.Println("==========================================")
+
+	results := make([]writeBenchResult, len(writeStrategies))
+	written := make([][]UserSession, len(writeStrategies))
+	for i, strategy := range writeStrategies {
+		sessionID := fmt.Sprintf("bench-%s-%d", runID, i+1)
+		sessions := make([]UserSession, len(events))
+		bodies := make([][]byte, len(events))
+		for j, event := range events {
+			event.SessionID = sessionID
+			event.ID = fmt.Sprintf("%s-%d", sessionID, j+1)
+			event.TTL = config.RecordTTL
+			body, err := json.Marshal(event)
+			if err != nil {
+				return fmt.Errorf("failed to marshal benchmark record: %w", err)
+			}
+			sessions[j], bodies[j] = event, body
+		}
+		written[i] = sessions
+
+		results[i] = strategy.write(ctx, containerClient, buildPartitionKey(sessions[0], config.PKLevels), bodies, config.BatchSize)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	printWriteBenchmark(results)
+
+	if !config.BenchCleanup {
+		fmt.Printf("Benchmark items were kept in sessions bench-%s-*, pass -bench-cleanup to delete them\n", runID)
+		return nil
+	}
+	deleted := 0
+	for _, sessions := range written {
+		for _, session := range sessions {
+			_, err := containerClient.DeleteItem(ctx, buildPartitionKey(session, config.PKLevels), session.ID, nil)
+			if err != nil && statusCode(err) != 404 {
+				return fmt.Errorf("failed to delete benchmark item %s: %w", session.ID, err)
+			}
+			if err == nil {
+				deleted++
+			}
+		}
+	}
+	fmt.Printf("Deleted %d benchmark items\n", deleted)
+	return nil
+}
+
+// upsertIndividually writes every body with its own UpsertItem call
+func upsertIndividually(ctx context.Context, containerClient *azcosmos.ContainerClient, partitionKey azcosmos.PartitionKey, bodies [][]byte, _ int) writeBenchResult {
+	var result writeBenchResult
+	start := time.Now()
+	for _, body := range bodies {
+		requestStart := time.Now()
+		resp, err := containerClient.UpsertItem(ctx, partitionKey, body, nil)
+		latency := time.Since(requestStart)
+		result.requests++
+		result.charge += float64(resp.RequestCharge)
+		if err != nil {
+			result.failures++
+			result.lastErr = err
+			continue
+		}
+		result.latencies = append(result.latencies, latency)
+	}
+	result.elapsed = time.Since(start)
+	return result
+}
+
+// upsertInBatches writes the bodies as transactional batches of up to
+// batchSize upserts each
+func upsertInBatches(ctx context.Context, containerClient *azcosmos.ContainerClient, partitionKey azcosmos.PartitionKey, bodies [][]byte, batchSize int) writeBenchResult {
+	var result writeBenchResult
+	start := time.Now()
+	for len(bodies) > 0 {
+		n := min(len(bodies), batchSize)
+		batch := containerClient.NewTransactionalBatch(partitionKey)
+		for _, body := range bodies[:n] {
+			batch.UpsertItem(body, nil)
+		}
+
+		requestStart := time.Now()
+		resp, err := containerClient.ExecuteTransactionalBatch(ctx, batch, nil)
+		latency := time.Since(requestStart)
+		result.requests++
+		result.charge += float64(resp.RequestCharge)
+		switch {
+		case err != nil:
+			result.failures += n
+			result.lastErr = err
+		case !resp.Success:
+			_, result.lastErr = batchFailure(resp)
+			result.failures += n
+		default:
+			for range n {
+				result.latencies = append(result.latencies, latency/time.Duration(n))
+			}
+		}
+		bodies = bodies[n:]
+	}
+	result.elapsed = time.Since(start)
+	return result
+}
+
+// printWriteBenchmark prints one column per strategy
+func printWriteBenchmark(results []writeBenchResult) {
+	row := func(label string, value func(writeBenchResult) string) {
+		fmt.Printf(" %-22s", label)
+		for _, result := range results {
+			fmt.Printf(" %-24s", value(result))
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf(" %-22s", "")
+	for _, strategy := range writeStrategies {
+		fmt.Printf(" %-24s", strategy.name)
+	}
+	fmt.Println()
+	row("Requests", func(r writeBenchResult) string { return fmt.Sprint(r.requests) })
+	row("Items written", func(r writeBenchResult) string { return fmt.Sprint(len(r.latencies)) })
+	row("Total RU", func(r writeBenchResult) string { return fmt.Sprintf("%.2f", r.charge) })
+	row("RU per item", func(r writeBenchResult) string {
+		if len(r.latencies) == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", r.charge/float64(len(r.latencies)))
+	})
+	row("Wall time", func(r writeBenchResult) string { return r.elapsed.Round(time.Millisecond).String() })
+	row("Latency per item avg", func(r writeBenchResult) string { return latencyStat(r.latencies, -1) })
+	row("Latency per item p95", func(r writeBenchResult) string { return latencyStat(r.latencies, 0.95) })
+
+	for i, result := range results {
+		if result.failures > 0 {
+			log.Printf("%s: %d items failed, last error: %v", writeStrategies[i].name, result.failures, result.lastErr)
+		}
+	}
+	fmt.Println("==========================================")
+}
+
+// latencyStat returns the p-th percentile of latencies, or their average when
+// p is negative
+func latencyStat(latencies []time.Duration, p float64) string {
+	if len(latencies) == 0 {
+		return "-"
+	}
+	if p < 0 {
+		var sum time.Duration
+		for _, latency := range latencies {
+			sum += latency
+		}
+		return (sum / time.Duration(len(latencies))).Round(time.Microsecond).String()
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := max(int(float64(len(sorted))*p+0.5)-1, 0)
+	return sorted[min(index, len(sorted)-1)].Round(time.Microsecond).String()
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// the Go SDK has no bulk execution mode, so -bulk sends concurrent transactional
+// batches instead. bulkChunkSize records are generated and grouped by partition
+// key at a time, and a batch holds at most -batch-size records, which is capped
+// at maxBatchOperations. A batch over the 2 MB request limit is split in half
+// up to maxBatchSplitDepth times. A full batch of 100 records is down to 6 or
+// 7 records after the last split, and a batch still too large then fails
+const (
+	bulkChunkSize      = 1000
+	maxBatchOperations = 100
+	maxBatchSplitDepth = 4
+)
+
+// bulkGroup is a set of records sharing one partition key, written together
+type bulkGroup struct {
+	partitionKey azcosmos.PartitionKey
+	records      []record
+}
+
+// loadSampleDataBulk generates config.RowCount records, groups consecutive
+// records by partition key and writes every group of two or more as one
+// transactional batch through batches, with config.Workers batches in flight at
+// a time. Single records are written through writer like in loadSampleData.
+// Grouping pays off most with fewer key levels or several events per session
+func loadSampleDataBulk(batches BatchWriter, writer ItemWriter, config Config) (*loadStats, error) {
+	ctx, stop := runContext(config)
+	defer stop()
+
+	fmt.Printf("Generating %d sample records, writing them as batches with %d workers...\n", config.RowCount, config.Workers)
+
+	stats := &loadStats{total: config.RowCount, mode: config.Mode}
+	progress := newProgress(config.RowCount, config.Quiet)
+	start := time.Now()
+
+	generator, err := newSessionGenerator(config)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.begin()
+
+	groups := make(chan bulkGroup, config.Workers)
+	go produceBulkGroups(ctx, config, generator, stats, progress, groups)
+
+	var batchCount atomic.Int64
+	var wg sync.WaitGroup
+	for range config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range groups {
+				if ctx.Err() != nil {
+					for range group.records {
+						stats.record(outcomeCancelled, 0)
+					}
+					continue
+				}
+				if writeBulkGroup(ctx, batches, writer, config, group, stats, progress) {
+					batchCount.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	progress.end()
+	stats.elapsed = time.Since(start)
+
+	stats.printSummary()
+	stats.printFailures()
+	fmt.Printf(" Batches: %d\n", batchCount.Load())
+	generator.saveUserPool()
+	if config.AnomalyRate > 0 {
+		printAnomalies(generator.anomalies)
+	}
+	if config.TTLByAge > 0 {
+		printTTLBuckets(stats.ttlBuckets, config.TTLByAge)
+	}
+	if config.PrintDistribution || config.HotTenant != "" {
+		generator.tenants.printDistribution(stats.generated, stats.tenants)
+	}
+	if err := ctx.Err(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return stats, fmt.Errorf("interrupted after %d of %d records", stats.generated, stats.total)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return stats, fmt.Errorf("-deadline reached after %d of %d records", stats.generated, stats.total)
+		}
+		return stats, err
+	}
+	return stats, stats.err()
+}
+
+// produceBulkGroups generates the records chunk by chunk, groups each chunk by
+// partition key in the order the keys first appear and sends the groups to
+// out, which it closes when done. Records with an invalid partition key are
+// counted and dropped here, the others count as generated once handed to a
+// writer
+func produceBulkGroups(ctx context.Context, config Config, generator *sessionGenerator, stats *loadStats, progress *progress, out chan<- bulkGroup) {
+	defer close(out)
+
+	for chunkStart := 0; chunkStart < config.RowCount; chunkStart += bulkChunkSize {
+		byKey := make(map[[3]string]*bulkGroup)
+		var order [][3]string
+
+		for i := chunkStart; i < min(chunkStart+bulkChunkSize, config.RowCount); i++ {
+			session := generator.next()
+			if err := validatePartitionKey(session, config.PKLevels); err != nil {
+				log.Printf("Skipping session %d: %v", i+1, err)
+				stats.record(outcomeGenerated, 0)
+				stats.record(outcomeInvalid, 0)
+				progress.add(1, 0)
+				continue
+			}
+			if err := session.Validate(); err != nil {
+				log.Printf("Skipping session %d: %v", i+1, err)
+				stats.record(outcomeGenerated, 0)
+				stats.record(outcomeRejected, 0)
+				progress.add(1, 0)
+				continue
+			}
+			if config.TTLByAge > 0 {
+				if err := validateTTL(session.TTL); err != nil {
+					log.Printf("Skipping session %d: %v", i+1, err)
+					stats.record(outcomeGenerated, 0)
+					stats.record(outcomeInvalid, 0)
+					progress.add(1, 0)
+					continue
+				}
+			}
+
+			key := [3]string{session.TenantID}
+			if config.PKLevels >= 2 {
+				key[1] = session.UserID
+			}
+			if config.PKLevels >= 3 {
+				key[2] = session.SessionID
+			}
+			group, ok := byKey[key]
+			if !ok {
+				group = &bulkGroup{partitionKey: buildPartitionKey(session, config.PKLevels)}
+				byKey[key] = group
+				order = append(order, key)
+			}
+			group.records = append(group.records, record{index: i, session: session})
+		}
+
+		for _, key := range order {
+			group := byKey[key]
+			for len(group.records) > 0 {
+				n := min(len(group.records), config.BatchSize)
+				select {
+				case out <- bulkGroup{partitionKey: group.partitionKey, records: group.records[:n]}:
+					for range n {
+						stats.record(outcomeGenerated, 0)
+					}
+				case <-ctx.Done():
+					return
+				}
+				group.records = group.records[n:]
+			}
+		}
+	}
+}
+
+// writeBulkGroup writes one group, as a transactional batch when it holds more
+// than one record, and counts the outcome of every record. Oversized records are
+// dropped from the group first. It reports whether a batch was sent
+func writeBulkGroup(ctx context.Context, batches BatchWriter, writer ItemWriter, config Config, group bulkGroup, stats *loadStats, progress *progress) bool {
+	var records []record
+	var bodies [][]byte
+	for _, rec := range group.records {
+		body, err := json.Marshal(rec.session)
+		if err != nil {
+			log.Printf("Failed to marshal session %d: %v", rec.index+1, err)
+			stats.record(outcomeError, 0)
+			progress.add(1, 0)
+			continue
+		}
+		if err := checkDocumentSize(body); err != nil {
+			log.Printf("Skipping session %d (id %s): %v", rec.index+1, rec.session.ID, err)
+			stats.record(outcomeOversized, 0)
+			progress.add(1, 0)
+			continue
+		}
+		records = append(records, rec)
+		bodies = append(bodies, body)
+	}
+
+	switch len(records) {
+	case 0:
+		return false
+	case 1:
+		writeBulkRecord(ctx, writer, config, group.partitionKey, records[0], bodies[0], stats, progress)
+		return false
+	}
+
+	return writeBatch(ctx, batches, writer, config, group.partitionKey, records, bodies, 0, stats, progress)
+}
+
+// writeBulkRecord writes one record of a group on its own through writer and
+// counts its outcome, classifying a 409 like loadSampleData does
+func writeBulkRecord(ctx context.Context, writer ItemWriter, config Config, partitionKey azcosmos.PartitionKey, rec record, body []byte, stats *loadStats, progress *progress) {
+	charge, err := writeItem(ctx, writer, config.Mode, partitionKey, body)
+	outcome := outcomeSuccess
+	conflict, isConflict := classifyConflict(config, err)
+	switch {
+	case isConflict:
+		if conflict != outcomeSkipped {
+			stats.recordFailure("Conflict inserting", rec, statusCode(err), err)
+		}
+		outcome = conflict
+	case statusCode(err) == 429:
+		stats.recordFailure("Throttled inserting", rec, statusCode(err), err)
+		outcome = outcomeThrottled
+	case errors.Is(err, timeout.ErrOpTimeout):
+		stats.recordFailure("Timed out inserting", rec, statusCode(err), err)
+		outcome = outcomeTimeout
+	case err != nil:
+		stats.recordFailure("Failed to insert", rec, statusCode(err), err)
+		outcome = outcomeError
+	}
+	if outcome != outcomeSuccess && outcome != outcomeSkipped {
+		printDiagnostics(config, config.Mode+" of session", rec, err)
+	}
+	countBulkRecords(config, []record{rec}, outcome, charge, stats)
+	progress.add(1, charge)
+}
+
+// writeBatch writes records as one transactional batch and counts the outcome
+// of every record. A batch rejected with 413 is split in half and each half is
+// written on its own, depth counts the splits so far. A batch rolled back by a
+// 409 is written again one record at a time through writer, so the conflicting
+// record is classified like in loadSampleData and the others are still written
+func writeBatch(ctx context.Context, batches BatchWriter, writer ItemWriter, config Config, partitionKey azcosmos.PartitionKey, records []record, bodies [][]byte, depth int, stats *loadStats, progress *progress) bool {
+	resp, err := batches.WriteBatch(ctx, partitionKey, config.Mode, bodies)
+	charge := float64(resp.RequestCharge)
+	if statusCode(err) == http.StatusRequestEntityTooLarge && depth < maxBatchSplitDepth && len(records) > 1 {
+		// the rejected batch is still charged
+		stats.chargeWrite(charge)
+		progress.add(0, charge)
+		half := len(records) / 2
+		if config.Verbose {
+			log.Printf("Batch of %d records is too large, splitting it into %d and %d records", len(records), half, len(records)-half)
+		}
+		firstRecords, secondRecords := splitBatch(records, half)
+		firstBodies, secondBodies := splitBatch(bodies, half)
+		writeBatch(ctx, batches, writer, config, partitionKey, firstRecords, firstBodies, depth+1, stats, progress)
+		writeBatch(ctx, batches, writer, config, partitionKey, secondRecords, secondBodies, depth+1, stats, progress)
+		return true
+	}
+	switch {
+	case statusCode(err) == 429:
+		log.Printf("Throttled writing batch of %d records: %v", len(records), err)
+		recordBatchFailure(stats, "Throttled writing", records, statusCode(err), err)
+		printDiagnostics(config, "transactional batch", records[0], err)
+		countBulkRecords(config, records, outcomeThrottled, charge, stats)
+	case errors.Is(err, timeout.ErrOpTimeout):
+		log.Printf("Timed out writing batch of %d records: %v", len(records), err)
+		recordBatchFailure(stats, "Timed out writing", records, statusCode(err), err)
+		printDiagnostics(config, "transactional batch", records[0], err)
+		countBulkRecords(config, records, outcomeTimeout, charge, stats)
+	case err != nil:
+		log.Printf("Failed to write batch of %d records: %v", len(records), err)
+		recordBatchFailure(stats, "Failed to write", records, statusCode(err), err)
+		printDiagnostics(config, "transactional batch", records[0], err)
+		countBulkRecords(config, records, outcomeError, charge, stats)
+	case !resp.Success && batchConflict(resp):
+		// a batch is atomic, so one conflicting id rolls back every record.
+		// The batch result carries no substatus, a record written on its own
+		// tells an id conflict from a unique key one
+		if config.Verbose {
+			log.Printf("Batch of %d records was rolled back by a conflict, writing them one at a time", len(records))
+		}
+		stats.chargeWrite(charge)
+		progress.add(0, charge)
+		for i, rec := range records {
+			writeBulkRecord(ctx, writer, config, partitionKey, rec, bodies[i], stats, progress)
+		}
+		return true
+	case !resp.Success:
+		log.Printf("Batch of %d records was rolled back", len(records))
+		status, err := batchFailure(resp)
+		recordBatchFailure(stats, "Rolled back", records, status, err)
+		printBatchDiagnostics(config, records[0], resp, status, err)
+		countBulkRecords(config, records, outcomeError, charge, stats)
+	default:
+		countBulkRecords(config, records, outcomeSuccess, charge, stats)
+	}
+	progress.add(len(records), charge)
+	return true
+}
+
+// splitBatch splits the records or bodies of a batch at half
+func splitBatch[T any](items []T, half int) ([]T, []T) {
+	return items[:half], items[half:]
+}
+
+// recordBatchFailure records err as the failure of every record of a batch
+func recordBatchFailure(stats *loadStats, action string, records []record, status int, err error) {
+	for _, rec := range records {
+		stats.recordFailure(action, rec, status, err)
+	}
+}
+
+// batchConflict reports whether a transactional batch was rolled back because
+// one of its operations failed with 409
+func batchConflict(resp azcosmos.TransactionalBatchResponse) bool {
+	status, _ := batchFailure(resp)
+	return status == http.StatusConflict
+}
+
+// batchFailure returns the status of the operation that rolled back a
+// transactional batch and an error naming it
+func batchFailure(resp azcosmos.TransactionalBatchResponse) (int, error) {
+	for i, result := range resp.OperationResults {
+		// 424 marks the operations that failed only because another one did
+		if result.StatusCode >= 300 && result.StatusCode != http.StatusFailedDependency {
+			return int(result.StatusCode), fmt.Errorf("batch operation %d of %d failed with status %d", i+1, len(resp.OperationResults), result.StatusCode)
+		}
+	}
+	return 0, errors.New("batch was rolled back")
+}
+
+// countBulkRecords records the same outcome for every record of a group, with
+// the group's RU charge counted once
+func countBulkRecords(config Config, records []record, o outcome, charge float64, stats *loadStats) {
+	for i, rec := range records {
+		if i > 0 {
+			charge = 0
+		}
+		stats.record(o, charge)
+		if o == outcomeSuccess {
+			stats.countTenant(rec.session.TenantID)
+			if config.TTLByAge > 0 {
+				stats.countTTL(rec.session.TTL)
+			}
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// fakeBatchWriter is a BatchWriter that holds committed batches in memory.
+// fail decides the error of every call, numbered from 1; rollback makes a
+// call without an error report the batch as rolled back by its first
+// operation failing with the returned status, 0 commits it
+type fakeBatchWriter struct {
+	charge          float32       // RU charge of every call
+	chargePerRecord float32       // RU charge added per record of a call
+	latency         time.Duration // delay of every call
+	fail            func(call int, bodies [][]byte) error
+	rollback        func(call int) int
+
+	mu        sync.Mutex
+	calls     int
+	sizes     []int // records per call, in call order
+	committed int
+}
+
+func (w *fakeBatchWriter) WriteBatch(ctx context.Context, pk azcosmos.PartitionKey, mode string, bodies [][]byte) (azcosmos.TransactionalBatchResponse, error) {
+	if w.latency > 0 {
+		time.Sleep(w.latency)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls++
+	w.sizes = append(w.sizes, len(bodies))
+
+	charge := w.charge + w.chargePerRecord*float32(len(bodies))
+	resp := azcosmos.TransactionalBatchResponse{Response: azcosmos.Response{RequestCharge: charge}}
+	if w.fail != nil {
+		if err := w.fail(w.calls, bodies); err != nil {
+			return resp, err
+		}
+	}
+	failed := 0
+	if w.rollback != nil {
+		failed = w.rollback(w.calls)
+	}
+	if failed != 0 {
+		// the first operation fails, the others fail with it
+		for i := range bodies {
+			status := int32(http.StatusFailedDependency)
+			if i == 0 {
+				status = int32(failed)
+			}
+			resp.OperationResults = append(resp.OperationResults, azcosmos.TransactionalBatchResult{StatusCode: status})
+		}
+		return resp, nil
+	}
+	for range bodies {
+		resp.OperationResults = append(resp.OperationResults, azcosmos.TransactionalBatchResult{StatusCode: http.StatusCreated})
+	}
+	resp.Success = true
+	w.committed += len(bodies)
+	return resp, nil
+}
+
+// sessionBatch returns n records of one session, so they share a partition key
+func sessionBatch(t *testing.T, n int) ([]record, [][]byte) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	first := generateUserSession(rng, tenantTypes[0], time.Now())
+	records := make([]record, n)
+	bodies := make([][]byte, n)
+	for i := range n {
+		session := generateUserSession(rng, tenantTypes[0], time.Now())
+		session.UserID, session.SessionID = first.UserID, first.SessionID
+		body, err := json.Marshal(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records[i] = record{index: i, session: session}
+		bodies[i] = body
+	}
+	return records, bodies
+}
+
+func TestWriteBatch(t *testing.T) {
+	tooLarge := responseError(http.StatusRequestEntityTooLarge, 0)
+	conflict := func(int) int { return http.StatusConflict }
+	tests := []struct {
+		name       string
+		args       []string
+		records    int
+		fail       func(call int, bodies [][]byte) error
+		rollback   func(call int) int
+		existing   bool                            // the first record's id is already written
+		writerFail func(call int, id string) error // of the records written on their own
+		wantSizes  []int                           // nil skips the check
+		wantStats  counts
+	}{
+		{
+			name:      "committed",
+			records:   8,
+			wantSizes: []int{8},
+			wantStats: counts{success: 8},
+		},
+		{
+			// the two halves are written depth first
+			name:    "413 on the first call",
+			records: 8,
+			fail: func(call int, bodies [][]byte) error {
+				if call == 1 {
+					return tooLarge
+				}
+				return nil
+			},
+			wantSizes: []int{8, 4, 4},
+			wantStats: counts{success: 8},
+		},
+		{
+			name:    "413 on batches over 3 records",
+			records: 13,
+			fail: func(call int, bodies [][]byte) error {
+				if len(bodies) > 3 {
+					return tooLarge
+				}
+				return nil
+			},
+			wantSizes: []int{13, 6, 3, 3, 7, 3, 4, 2, 2},
+			wantStats: counts{success: 13},
+		},
+		{
+			// maxBatchSplitDepth splits leave 16 batches of one, which fail
+			name:    "413 on every call",
+			records: 16,
+			fail:    func(int, [][]byte) error { return tooLarge },
+			wantStats: counts{
+				errors: 16,
+			},
+		},
+		{
+			name:      "413 on a single record",
+			records:   1,
+			fail:      func(int, [][]byte) error { return tooLarge },
+			wantSizes: []int{1},
+			wantStats: counts{errors: 1},
+		},
+		{
+			name:      "throttled batches are not split",
+			records:   8,
+			fail:      func(int, [][]byte) error { return responseError(http.StatusTooManyRequests, 0) },
+			wantSizes: []int{8},
+			wantStats: counts{errors: 8, throttled: 8},
+		},
+		{
+			name:      "rolled back",
+			records:   5,
+			rollback:  func(int) int { return http.StatusBadRequest },
+			wantSizes: []int{5},
+			wantStats: counts{errors: 5},
+		},
+		{
+			// the records are written one at a time and only the existing id is skipped
+			name:      "conflict skipped",
+			args:      []string{"-mode", "insert"},
+			records:   5,
+			rollback:  conflict,
+			existing:  true,
+			wantSizes: []int{5},
+			wantStats: counts{success: 4, skipped: 1},
+		},
+		{
+			name:      "conflict with -on-conflict fail",
+			args:      []string{"-mode", "insert", "-on-conflict", "fail"},
+			records:   5,
+			rollback:  conflict,
+			existing:  true,
+			wantSizes: []int{5},
+			wantStats: counts{success: 4, errors: 1, conflicts: 1},
+		},
+		{
+			name:       "unique key conflict",
+			args:       []string{"-mode", "insert"},
+			records:    5,
+			rollback:   conflict,
+			writerFail: failFirst(1, uniqueKeyConflict()),
+			wantSizes:  []int{5},
+			wantStats:  counts{success: 4, errors: 1, uniqueConflicts: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig(t, append([]string{"-bulk"}, tt.args...)...)
+			batches := &fakeBatchWriter{charge: 2, fail: tt.fail, rollback: tt.rollback}
+			writer := &fakeWriter{charge: 1, fail: tt.writerFail}
+			stats := &loadStats{}
+			records, bodies := sessionBatch(t, tt.records)
+			if tt.existing {
+				writer.items = map[string][]byte{records[0].session.ID: bodies[0]}
+			}
+
+			writeBatch(context.Background(), batches, writer, config, buildPartitionKey(records[0].session, config.PKLevels),
+				records, bodies, 0, stats, newProgress(tt.records, true))
+
+			if tt.wantSizes != nil && !slices.Equal(batches.sizes, tt.wantSizes) {
+				t.Errorf("batch sizes = %v, want %v", batches.sizes, tt.wantSizes)
+			}
+			if got := countsOf(stats); got != tt.wantStats {
+				t.Errorf("counts = %+v, want %+v", got, tt.wantStats)
+			}
+			if written := batches.committed + writer.written(); written != tt.wantStats.success {
+				t.Errorf("%d records committed in batches and %d on their own, want %d", batches.committed, writer.written(), tt.wantStats.success)
+			}
+			// every call is charged, also those of the batches split or rolled back
+			if want := float64(2*batches.calls + writer.calls); stats.charge.Total() != want {
+				t.Errorf("charge = %v, want %v for %d batch and %d single calls", stats.charge.Total(), want, batches.calls, writer.calls)
+			}
+		})
+	}
+}
+
+func TestWriteBatchSplitDepth(t *testing.T) {
+	config := testConfig(t, "-bulk")
+	batches := &fakeBatchWriter{fail: func(int, [][]byte) error {
+		return responseError(http.StatusRequestEntityTooLarge, 0)
+	}}
+	stats := &loadStats{}
+	records, bodies := sessionBatch(t, maxBatchOperations)
+
+	writeBatch(context.Background(), batches, &fakeWriter{}, config, buildPartitionKey(records[0].session, config.PKLevels),
+		records, bodies, 0, stats, newProgress(len(records), true))
+
+	// one call per split level: 1 + 2 + 4 + 8 + 16
+	if want := 1<<(maxBatchSplitDepth+1) - 1; batches.calls != want {
+		t.Errorf("%d calls, want %d", batches.calls, want)
+	}
+	last := batches.sizes[len(batches.sizes)-1<<maxBatchSplitDepth:]
+	for _, size := range last {
+		if size < 6 {
+			t.Errorf("batches after %d splits hold %v records, want 6 or more", maxBatchSplitDepth, last)
+			break
+		}
+	}
+	if stats.errors != maxBatchOperations {
+		t.Errorf("errors = %d, want all %d records", stats.errors, maxBatchOperations)
+	}
+}
+
+func TestLoadSampleDataBulk(t *testing.T) {
+	config := testConfig(t, "-bulk", "-rows", "400", "-workers", "4", "-pk-levels", "1", "-batch-size", "50", "-deterministic-ids")
+	writer := &fakeWriter{charge: 1}
+	// every batch over 10 records is too large
+	batches := &fakeBatchWriter{charge: 1, fail: func(call int, bodies [][]byte) error {
+		if len(bodies) > 10 {
+			return responseError(http.StatusRequestEntityTooLarge, 0)
+		}
+		return nil
+	}}
+
+	var stats *loadStats
+	var err error
+	captureStdout(t, func() {
+		stats, err = loadSampleDataBulk(batches, writer, config)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != config.RowCount {
+		t.Errorf("wrote %d of %d records", stats.success, config.RowCount)
+	}
+	if written := batches.committed + writer.written(); written != config.RowCount {
+		t.Errorf("%d records committed in batches and %d on their own, want %d", batches.committed, writer.written(), config.RowCount)
+	}
+	if batches.committed == 0 {
+		t.Error("no batch was committed, want records sharing a tenant batched")
+	}
+	for _, size := range batches.sizes {
+		if size > 50 {
+			t.Errorf("sent a batch of %d records, want at most -batch-size 50", size)
+		}
+	}
+}
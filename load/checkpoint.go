@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// how often the checkpoint file is rewritten while records complete
+const checkpointInterval = 5 * time.Second
+
+// checkpoint is the persisted progress of a load. Completed counts the records
+// from the start of the run that are all done, so a resumed run regenerates
+// the same sequence from Seed and skips that many records
+type checkpoint struct {
+	Seed      int64 `json:"seed"`
+	Rows      int   `json:"rows"`
+	Completed int   `json:"completed"`
+}
+
+// readCheckpoint reads a checkpoint file written by an earlier run
+func readCheckpoint(path string) (checkpoint, error) {
+	var cp checkpoint
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cp, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("failed to parse checkpoint file %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// checkpointer tracks which records are done and periodically saves the
+// contiguous completed prefix. Workers finish records out of order, so records
+// past the first unfinished one are held in done until the gap closes. A record
+// that failed never completes, which keeps a resumed run from skipping it.
+// complete is safe to call from several goroutines at once
+type checkpointer struct {
+	path string
+
+	mu        sync.Mutex
+	cp        checkpoint
+	done      map[int]bool
+	lastSaved time.Time
+}
+
+// newCheckpointer creates a checkpointer for a run starting at record start
+func newCheckpointer(path string, seed int64, rows, start int) *checkpointer {
+	return &checkpointer{
+		path:      path,
+		cp:        checkpoint{Seed: seed, Rows: rows, Completed: start},
+		done:      make(map[int]bool),
+		lastSaved: time.Now(),
+	}
+}
+
+// complete marks the record at index as done and saves the checkpoint when
+// checkpointInterval has passed since the last save
+func (c *checkpointer) complete(index int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.done[index] = true
+	for c.done[c.cp.Completed] {
+		delete(c.done, c.cp.Completed)
+		c.cp.Completed++
+	}
+
+	if time.Since(c.lastSaved) < checkpointInterval {
+		return nil
+	}
+	return c.saveLocked()
+}
+
+// save writes the checkpoint file
+func (c *checkpointer) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saveLocked()
+}
+
+// completed returns the number of records in the completed prefix
+func (c *checkpointer) completed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cp.Completed
+}
+
+// saveLocked writes the checkpoint to a temporary file and renames it so a
+// crash never leaves a truncated checkpoint behind, c.mu must be held
+func (c *checkpointer) saveLocked() error {
+	data, err := json.MarshalIndent(c.cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to move checkpoint file into place: %w", err)
+	}
+
+	c.lastSaved = time.Now()
+	return nil
+}
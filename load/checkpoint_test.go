@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSampleDataResume(t *testing.T) {
+	const rows = 100
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+	args := []string{"-rows", "100", "-workers", "4", "-deterministic-ids", "-checkpoint-file", checkpointFile}
+
+	// the records a run of this seed generates, in order
+	config := testConfig(t, args...)
+	generator, err := newSessionGenerator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, rows)
+	for i := range ids {
+		ids[i] = generator.next().ID
+	}
+
+	// the first run fails record 40, so the records after it are written but
+	// the checkpoint stops before it
+	const failed = 40
+	writer := &fakeWriter{fail: func(call int, id string) error {
+		if id == ids[failed] {
+			return responseError(400, 0)
+		}
+		return nil
+	}}
+	captureStdout(t, func() {
+		_, err = loadSampleData(writer, config, nil)
+	})
+	if err == nil {
+		t.Fatal("first run succeeded, want the failed record reported")
+	}
+	cp, err := readCheckpoint(checkpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Completed != failed || cp.Seed != config.Seed || cp.Rows != rows {
+		t.Fatalf("checkpoint = %+v, want %d of %d completed with seed %d", cp, failed, rows, config.Seed)
+	}
+
+	// the resumed run regenerates the same records and writes the rest
+	writer.fail = nil
+	resumed := testConfig(t, append(args, "-resume")...)
+	if resumed.ResumeFrom != failed {
+		t.Fatalf("ResumeFrom = %d, want %d", resumed.ResumeFrom, failed)
+	}
+	var stats *loadStats
+	captureStdout(t, func() {
+		stats, err = loadSampleData(writer, resumed, nil)
+	})
+	if err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	if stats.total != rows-failed || stats.success != rows-failed {
+		t.Errorf("resumed run wrote %d of %d records, want %d", stats.success, stats.total, rows-failed)
+	}
+
+	for i, id := range ids {
+		if _, ok := writer.items[id]; !ok {
+			t.Errorf("record %d (%s) was never written", i, id)
+		}
+	}
+	if len(writer.items) != rows {
+		t.Errorf("writer holds %d ids, want %d", len(writer.items), rows)
+	}
+
+	cp, err = readCheckpoint(checkpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Completed != rows {
+		t.Errorf("checkpoint completed = %d after the resume, want %d", cp.Completed, rows)
+	}
+}
+
+func TestLoadConfigResumeSeedMismatch(t *testing.T) {
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := newCheckpointer(checkpointFile, 7, 100, 10).save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the checkpoint was written with seed 7
+	_, err := loadConfig([]string{"-endpoint", "https://localhost:8081", "-database", "test", "-container", "test",
+		"-seed", "1", "-rows", "100", "-checkpoint-file", checkpointFile, "-resume"})
+	if err == nil || !strings.Contains(err.Error(), "does not match seed 7") {
+		t.Errorf("loadConfig() err = %v, want the seed mismatch", err)
+	}
+}
+
+func TestCheckpointerCompletesContiguousPrefix(t *testing.T) {
+	c := newCheckpointer(filepath.Join(t.TempDir(), "checkpoint.json"), 1, 10, 2)
+	for _, index := range []int{4, 3, 6} {
+		if err := c.complete(index); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := c.completed(); got != 2 {
+		t.Errorf("completed = %d before record 2 is done, want 2", got)
+	}
+	if err := c.complete(2); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.completed(); got != 5 {
+		t.Errorf("completed = %d, want 5 with record 5 still missing", got)
+	}
+
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := readCheckpoint(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp != (checkpoint{Seed: 1, Rows: 10, Completed: 5}) {
+		t.Errorf("saved %+v", cp)
+	}
+
+	if _, err := readCheckpoint(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("readCheckpoint() of a missing file = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// replaceOutcome is the result of one of the competing updates
+type replaceOutcome struct {
+	writer   string
+	activity string
+	charge   float32
+	err      error
+}
+
+// runConcurrencyDemo shows optimistic concurrency with ETags: a document is
+// created and read back, then two writers update it at the same time, both
+// conditioned on the ETag they read. Exactly one wins, the other gets 412
+// Precondition Failed and would have to re-read and retry
+func runConcurrencyDemo(containerClient *azcosmos.ContainerClient, config Config) error {
+	ctx := context.Background()
+
+	generator, err := newSessionGenerator(config)
+	if err != nil {
+		return err
+	}
+	session := generator.next()
+	partitionKey := buildPartitionKey(session, config.PKLevels)
+
+	fmt.Printf("Concurrency demo on item %s\n", session.ID)
+	fmt.Printf(" Partition key: %s / %s / %s\n", session.TenantID, session.UserID, session.SessionID)
+
+	body, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	createResponse, err := containerClient.CreateItem(ctx, partitionKey, body, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create item: %w", err)
+	}
+	fmt.Printf(" Created (RU %.2f)\n", createResponse.RequestCharge)
+	defer func() {
+		if _, err := containerClient.DeleteItem(context.Background(), partitionKey, session.ID, nil); err != nil {
+			fmt.Printf(" Failed to delete demo item: %v\n", err)
+		}
+	}()
+
+	readResponse, err := containerClient.ReadItem(ctx, partitionKey, session.ID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read item: %w", err)
+	}
+	etag := readResponse.ETag
+	fmt.Printf(" Read ETag %s (RU %.2f)\n", etag, readResponse.RequestCharge)
+
+	// a replace addressed by a partial key cannot find the item, the full
+	// hierarchical key is part of the item's identity
+	if config.PKLevels > 1 {
+		partialKey := buildPartitionKey(session, config.PKLevels-1)
+		_, err = containerClient.ReplaceItem(ctx, partialKey, session.ID, body, ifMatch(etag))
+		fmt.Printf(" Replace with a %d-level partition key: status %d (the full %d-level key is required)\n", config.PKLevels-1, statusCode(err), config.PKLevels)
+	}
+
+	// both writers start from the same ETag and race each other
+	outcomes := make([]replaceOutcome, 2)
+	var wg sync.WaitGroup
+	for i, activity := range []string{"edit_document", "delete_document"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outcomes[i] = replaceWithETag(ctx, containerClient, config.PKLevels, session, activity, etag)
+			outcomes[i].writer = fmt.Sprintf("Writer %c", 'A'+i)
+		}()
+	}
+	wg.Wait()
+
+	for _, outcome := range outcomes {
+		var preconditionFailed *PreconditionFailedError
+		switch {
+		case outcome.err == nil:
+			fmt.Printf(" %s set activity %q: succeeded (RU %.2f)\n", outcome.writer, outcome.activity, outcome.charge)
+		case errors.As(outcome.err, &preconditionFailed):
+			fmt.Printf(" %s set activity %q: 412 Precondition Failed, the ETag changed underneath it (RU %.2f)\n", outcome.writer, outcome.activity, outcome.charge)
+		default:
+			return fmt.Errorf("%s failed to update item: %w", outcome.writer, outcome.err)
+		}
+	}
+
+	finalResponse, err := containerClient.ReadItem(ctx, partitionKey, session.ID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read item: %w", err)
+	}
+	var final UserSession
+	if err := json.Unmarshal(finalResponse.Value, &final); err != nil {
+		return fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+	fmt.Printf(" Final activity %q, ETag %s\n", final.Activity, finalResponse.ETag)
+	return nil
+}
+
+// replaceWithETag updates the session with a new activity if its ETag still matches
+func replaceWithETag(ctx context.Context, containerClient *azcosmos.ContainerClient, pkLevels int, session UserSession, activity string, etag azcore.ETag) replaceOutcome {
+	session.Activity = activity
+	_, charge, err := updateIfUnchanged(ctx, containerClient, pkLevels, session, etag)
+	return replaceOutcome{activity: activity, charge: charge, err: err}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/config"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/diag"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/pii"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/retry"
+)
+
+// configuration for Azure Cosmos DB connection and the data load
+type Config struct {
+	config.Connection
+	RowCount       int
+	RowsPerTenant  int
+	PKLevels       int
+	Force          bool
+	TTL            int
+	RecordTTL      int
+	TTLByAge       int
+	ActivitiesFile string
+	EventsMin      int
+	EventsMax      int
+	TenantsFile    string
+	Mode           string
+	Duration       time.Duration
+	TargetOps      int
+	Quiet          bool
+	Strict         bool
+	Ping           bool
+	TemplateFile   string
+	TemplateCheck  bool
+	MetricsFile    string
+	ReportDir      string
+	PreLoadRUs     int
+	Scale          int
+	Workers        int
+	Buffer         int
+	ShardByTenant  bool
+
+	WithProfiles      bool
+	ProfilesContainer string
+
+	EncryptPII    bool
+	EncryptionKey string
+	PIIKey        []byte
+
+	ConcurrencyDemo bool
+	PatchDemo       bool
+	UpsertOnMissing bool
+	IfMatch         string
+	EraseUser       string
+	Purge           bool
+	AuditLog        string
+
+	CreateTenantsContainer bool
+	TenantsContainer       string
+
+	RetryPolicy retry.Policy
+	Bulk        bool
+	BatchSize   int
+	TargetRUs   int
+	OpTimeout   time.Duration
+	Deadline    time.Duration
+	DeadlineAt  time.Time // startup plus Deadline, zero without -deadline
+
+	BenchWrites  int
+	BenchCleanup bool
+
+	// Endpoints are regional endpoints of a multi region write account that
+	// the load writes to in round robin order, the first one is Endpoint
+	Endpoints []string
+
+	// OnConflict is what a -mode insert write does when its id exists, one
+	// of conflictModes
+	OnConflict string
+
+	// UserPool keeps the users of every tenant stable across runs, GrowUsers
+	// adds that many new users per tenant to it
+	UserPool  string
+	GrowUsers int
+
+	// LoadTest ramps the write rate from StartRPS until writes get throttled
+	LoadTest bool
+	StartRPS int
+
+	// Verbose prints request diagnostics for every failed write, Redact hashes
+	// the partition key values in them
+	Verbose bool
+	Redact  bool
+
+	// Diagnostics prints every HTTP request the SDK sent for each write:
+	// the endpoint, status, latency and RU charge of every retry
+	Diagnostics bool
+
+	Seed             int64
+	CheckpointFile   string
+	Resume           bool
+	DeterministicIDs bool
+	ResumeFrom       int // records already completed by the checkpointed run
+
+	HotTenant         string
+	HotRatio          float64
+	HotUser           string
+	AnomalyRate       float64
+	SkewFactor        float64
+	ActivityWeights   string
+	PrintDistribution bool
+
+	// OutputDir writes the generated records to NDJSON files, one per tenant
+	// or user as SplitBy selects, instead of to Cosmos DB
+	OutputDir string
+	SplitBy   string
+
+	IndexingPolicySource string
+	IndexingPolicy       *azcosmos.IndexingPolicy
+	CompositeIndexes     bool
+}
+
+// loadConfig defines the load flags, parses args and validates the result
+func loadConfig(args []string) (Config, error) {
+	loader := config.NewLoader("load")
+	fs := loader.FlagSet
+
+	var cfg Config
+	var eventsPerSession string
+	fs.IntVar(&cfg.RowCount, "rows", 10, "Number of rows to generate")
+	fs.IntVar(&cfg.RowsPerTenant, "rows-per-tenant", 0, "Generate exactly this many rows for every tenant, in tenant list order, instead of -rows picked at random (0 disables)")
+	fs.IntVar(&cfg.PKLevels, "pk-levels", 3, "Number of partition key levels to use: 1 (/tenantId), 2 (+/userId) or 3 (+/sessionId)")
+	fs.IntVar(&cfg.PKLevels, "pk-depth", 3, "Alias for -pk-levels")
+	fs.BoolVar(&cfg.Force, "force", false, "Use an existing container even if its partition key definition differs")
+	fs.IntVar(&cfg.TTL, "ttl", 0, "Container default time to live in seconds, -1 enables TTL without a default expiry (0 disables)")
+	fs.IntVar(&cfg.RecordTTL, "record-ttl", 0, "Time to live in seconds set on each generated record, overriding the container default (0 leaves it unset)")
+	fs.IntVar(&cfg.TTLByAge, "ttl-by-age", 0, "Set each record's ttl so it expires N days after its timestamp, older records get a minimal ttl (0 disables)")
+	fs.StringVar(&cfg.ActivitiesFile, "activities-file", "", "Path to a JSON array of activity names or {\"name\", \"weight\"} objects, names weigh 1 (default: built-in weighted activities)")
+	fs.StringVar(&cfg.ActivityWeights, "activity-weights", "", "Relative activity weights as name=weight,... e.g. login=20,export_data=0.5, overriding the built-in or -activities-file weights of the listed activities")
+	fs.StringVar(&eventsPerSession, "events-per-session", "1", "Number of records per session as N or min..max, sessions start with login and end with logout")
+	fs.StringVar(&cfg.TenantsFile, "tenants-file", "", "Path to a JSON array of tenant configurations (default: built-in tenants)")
+	fs.StringVar(&cfg.Mode, "mode", "upsert", "Write mode: upsert overwrites existing items, insert skips items that already exist, replace only overwrites existing items and skips the others (use -deterministic-ids with the seed of an earlier load)")
+	fs.StringVar(&cfg.OnConflict, "on-conflict", "skip", fmt.Sprintf("What -mode insert does with an id that already exists: one of %v, retry-new-id tries up to %d new ids in the same partition", conflictModes, maxConflictRetries))
+	fs.DurationVar(&cfg.Duration, "duration", 0, "Run a sustained load for this long instead of loading -rows records, e.g. 30m")
+	fs.IntVar(&cfg.TargetOps, "target-ops", 100, "Target writes per second in sustained load mode")
+	fs.BoolVar(&cfg.CompositeIndexes, "composite-indexes", false, "Add composite indexes (/tenantId ASC, /timestamp DESC) and (/tenantId ASC, /userId ASC, /timestamp DESC) to the indexing policy")
+	fs.StringVar(&cfg.IndexingPolicySource, "indexing-policy", "", "Container indexing policy: keys (partition key paths and /timestamp only) or a path to a JSON policy file (default: index everything)")
+	fs.BoolVar(&cfg.Strict, "strict", false, "Abort on the first record with an invalid partition key instead of skipping it")
+	fs.BoolVar(&cfg.Ping, "ping", false, "Check credentials and connectivity, print container details and exit")
+	fs.StringVar(&cfg.TemplateFile, "template", "", "Path to a Go text/template rendering one JSON document per record (helpers: uuid, randInt, choice, now; data: .Index, .Tenant)")
+	fs.BoolVar(&cfg.TemplateCheck, "template-check", false, "Render a few documents from -template to stdout without writing anything")
+	fs.IntVar(&cfg.Workers, "workers", 4, "Number of concurrent writer goroutines")
+	fs.BoolVar(&cfg.ShardByTenant, "shard-by-tenant", false, "Give every worker its own slice of tenants so each tenant's records are written in order by one worker")
+	fs.IntVar(&cfg.Buffer, "buffer", 100, "Number of generated records queued ahead of the writers (per worker with -shard-by-tenant)")
+	fs.Float64Var(&cfg.SkewFactor, "skew-factor", 0, "Tenant skew from 0 (uniform) to 1 (a few tenants get most sessions), tenants are ranked by their sessions weight")
+	fs.StringVar(&cfg.HotTenant, "hot-tenant", "", "Send -hot-ratio of all records to this tenant to simulate a hot partition")
+	fs.Float64Var(&cfg.HotRatio, "hot-ratio", 0.8, "Share of records (0.0-1.0) sent to -hot-tenant")
+	fs.StringVar(&cfg.HotUser, "hot-user", "", "Pin every -hot-tenant record to this user ID")
+	fs.Float64Var(&cfg.AnomalyRate, "anomaly-rate", 0, "Share of sessions (0.0-1.0) rewritten as impossible travel, mass deletes or 3am logins and marked anomalous")
+	fs.BoolVar(&cfg.PrintDistribution, "print-distribution", false, "Print the expected and actual record count per tenant after loading")
+	fs.Int64Var(&cfg.Seed, "seed", 0, "Seed for the data generator, the same seed produces the same tenants, users and activities (default: random)")
+	fs.StringVar(&cfg.UserPool, "user-pool", "", "Path to a JSON file of (tenantId, userId) pairs: a missing file is created with the users of this run, an existing one limits new sessions to its users")
+	fs.IntVar(&cfg.GrowUsers, "grow-users", 0, "Add this many new users per tenant to an existing -user-pool before loading (0 disables)")
+	fs.BoolVar(&cfg.DeterministicIDs, "deterministic-ids", false, "Derive item and session IDs from the record content so the same -seed on the same day produces the same IDs")
+	fs.StringVar(&cfg.CheckpointFile, "checkpoint-file", "", "Periodically save load progress and the seed to this file")
+	fs.BoolVar(&cfg.Resume, "resume", false, "Continue the load recorded in -checkpoint-file, skipping the records it completed")
+	fs.IntVar(&cfg.PreLoadRUs, "pre-load-rus", 0, "Raise the container's manual throughput to this many RU/s during the load and restore it afterwards (0 leaves it unchanged)")
+	fs.BoolVar(&cfg.WithProfiles, "with-profiles", false, "Also upsert a UserProfile document for every distinct tenant and user")
+	fs.StringVar(&cfg.ProfilesContainer, "profiles-container", "", "Write profiles to this container, partitioned by /tenantId and /userId (default: the sessions container)")
+	fs.IntVar(&cfg.Scale, "scale", 0, "Set the existing container's throughput to this many RU/s (the autoscale maximum for autoscale containers) and exit")
+	fs.BoolVar(&cfg.CreateTenantsContainer, "create-tenants-container", false, "Create a tenants reference container partitioned by /tenantId and store the tenant types in it")
+	fs.StringVar(&cfg.TenantsContainer, "tenants-container", "Tenants", "Name of the tenants reference container")
+	fs.BoolVar(&cfg.EncryptPII, "encrypt-pii", false, "Encrypt userId and sessionId with AES-256-GCM before writing, equal values keep equal ciphertexts")
+	fs.StringVar(&cfg.EncryptionKey, "encryption-key", "", "Hex encoded 32 byte key for -encrypt-pii")
+	fs.BoolVar(&cfg.LoadTest, "load-test-mode", false, "Raise the write rate from -start-rps by 10% every 5s until more than 5% of writes are throttled, print the maximum sustainable rate and exit. SDK and loader retries are disabled")
+	fs.IntVar(&cfg.StartRPS, "start-rps", 10, "Records per second -load-test-mode starts at")
+	fs.IntVar(&cfg.BenchWrites, "bench-writes", 0, "Write this many records of one session once as individual upserts and once as transactional batches, compare RU and latency, then exit (0 disables)")
+	fs.BoolVar(&cfg.BenchCleanup, "bench-cleanup", false, "Delete the records written by -bench-writes afterwards")
+	fs.BoolVar(&cfg.ConcurrencyDemo, "concurrency-demo", false, "Race two ETag conditioned replaces of one item to show optimistic concurrency, then exit")
+	fs.BoolVar(&cfg.PatchDemo, "patch-demo", false, "Patch the first generated item and compare the RU charge with a full replace, then exit")
+	fs.BoolVar(&cfg.UpsertOnMissing, "upsert-on-missing", false, "Create the item first when -patch-demo finds it missing")
+	fs.StringVar(&cfg.IfMatch, "if-match", "", "ETag the -patch-demo patch is conditioned on, a stale ETag fails it with 412 Precondition Failed")
+	fs.IntVar(&cfg.RetryPolicy.MaxAttempts, "retry-max-attempts", retry.Default.MaxAttempts, "Attempts per write, including the first, for throttled or unavailable requests (1 disables retries)")
+	fs.DurationVar(&cfg.RetryPolicy.MaxElapsedTime, "retry-max-elapsed", retry.Default.MaxElapsedTime, "Total time a write may spend retrying, whichever of this and -retry-max-attempts is hit first (0 means no limit)")
+	fs.DurationVar(&cfg.OpTimeout, "op-timeout", 0, "Time limit of a single write, a timed out write is retried like a throttled one (0 means no limit)")
+	fs.DurationVar(&cfg.Deadline, "deadline", 0, "Stop the load once this much time has passed since startup, e.g. 30m (0 means no limit)")
+	fs.IntVar(&cfg.TargetRUs, "target-rus", 0, "Pace writes so their RU charge stays under N RU/s, e.g. the provisioned throughput (0 disables)")
+	fs.BoolVar(&cfg.Bulk, "bulk", false, "Group records by partition key and write them as concurrent transactional batches of up to -batch-size records")
+	fs.IntVar(&cfg.BatchSize, "batch-size", maxBatchOperations, fmt.Sprintf("Maximum records per transactional batch with -bulk and -bench-writes, at most %d", maxBatchOperations))
+	fs.StringVar(&cfg.EraseUser, "erase-user", "", "Delete every item of this user ID across all tenants and exit")
+	fs.BoolVar(&cfg.Purge, "purge", false, "Delete every item of the container with -workers concurrent deletes and exit, keeping the container, its throughput and indexing policy")
+	fs.StringVar(&cfg.AuditLog, "audit-log", "", "Append a JSON line audit entry for -erase-user to this file")
+	fs.StringVar(&cfg.MetricsFile, "metrics-file", "", "Write Prometheus text format metrics for the load to this file")
+	fs.StringVar(&cfg.ReportDir, "report-dir", "", "Write a JSON report of each load (config, counts per tenant, RUs, errors, elapsed time) to load-report-<timestamp>.json in this directory")
+	fs.BoolVar(&cfg.Verbose, "verbose", false, "Print the status, substatus, activity ID and RU charge of every failed write, for support tickets")
+	fs.BoolVar(&cfg.Redact, "redact", false, "Replace partition key values in -verbose diagnostics with a short hash")
+	fs.BoolVar(&cfg.Diagnostics, "diagnostics", false, "Print the endpoint, status, latency and RU charge of every request the SDK sent for each write, including its own retries")
+	fs.StringVar(&cfg.OutputDir, "output-dir", "", "Write the generated records to NDJSON files in this directory instead of Cosmos DB")
+	fs.StringVar(&cfg.SplitBy, "split-by", "tenant", fmt.Sprintf("Output file per tenant or per user for -output-dir: one of %v", splitModes))
+	fs.Func("endpoints", "Comma-separated endpoint URLs of a multi region write account, writes go to them in round robin order and an endpoint failing without a response or with a 5xx is skipped for 30s (the first one also serves as -endpoint)", func(value string) error {
+		cfg.Endpoints = nil
+		for _, endpoint := range strings.Split(value, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" && !slices.Contains(cfg.Endpoints, endpoint) {
+				cfg.Endpoints = append(cfg.Endpoints, endpoint)
+			}
+		}
+		if len(cfg.Endpoints) == 0 {
+			return fmt.Errorf("no endpoint URLs in %q", value)
+		}
+		return fs.Set("endpoint", cfg.Endpoints[0])
+	})
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "Do not print progress while loading")
+
+	connection, err := loader.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Connection = connection
+
+	// a retried 429 would hide the throttling the load test looks for
+	if cfg.LoadTest {
+		cfg.SDKMaxRetries = 0
+		cfg.RetryPolicy.MaxAttempts = 1
+	}
+	if cfg.Diagnostics {
+		cfg.PerRetryPolicies = append(cfg.PerRetryPolicies, diag.TracePolicy())
+	}
+
+	if cfg.RowCount < 0 {
+		return Config{}, fmt.Errorf("invalid -rows %d: must not be negative", cfg.RowCount)
+	}
+	if cfg.PKLevels < 1 || cfg.PKLevels > len(partitionKeyPaths) {
+		return Config{}, fmt.Errorf("invalid -pk-levels/-pk-depth %d: must be 1, 2 or 3", cfg.PKLevels)
+	}
+	if cfg.Mode != "upsert" && cfg.Mode != "insert" && cfg.Mode != "replace" {
+		return Config{}, fmt.Errorf("invalid -mode %q: must be upsert, insert or replace", cfg.Mode)
+	}
+	if cfg.Mode == "replace" && (cfg.Bulk || cfg.Duration > 0 || cfg.OutputDir != "") {
+		// a missing item would roll back a whole batch, and neither files nor
+		// the sustained report tell missing items apart
+		return Config{}, fmt.Errorf("-mode replace cannot be combined with -bulk, -duration or -output-dir")
+	}
+	if !slices.Contains(conflictModes, cfg.OnConflict) {
+		return Config{}, fmt.Errorf("invalid -on-conflict %q: must be one of %v", cfg.OnConflict, conflictModes)
+	}
+	if cfg.OnConflict != "skip" && cfg.Mode != "insert" {
+		return Config{}, fmt.Errorf("-on-conflict %s requires -mode insert, the other modes never conflict on the id", cfg.OnConflict)
+	}
+	if cfg.OnConflict == "retry-new-id" && (cfg.Bulk || cfg.TemplateFile != "" || cfg.Duration > 0 || cfg.LoadTest) {
+		// batches roll back as a whole and templates own their ids
+		return Config{}, fmt.Errorf("-on-conflict retry-new-id cannot be combined with -bulk, -template, -duration or -load-test-mode")
+	}
+	if cfg.TTLByAge < 0 || cfg.TTLByAge > maxTTLByAgeDays {
+		return Config{}, fmt.Errorf("invalid -ttl-by-age %d: must be between 0 and %d days", cfg.TTLByAge, maxTTLByAgeDays)
+	}
+	if cfg.TTLByAge > 0 && cfg.RecordTTL != 0 {
+		return Config{}, fmt.Errorf("-ttl-by-age and -record-ttl cannot be combined")
+	}
+	if cfg.Diagnostics && (cfg.Bulk || cfg.OutputDir != "") {
+		// batches and files are not written through the traced item writes
+		return Config{}, fmt.Errorf("-diagnostics cannot be combined with -bulk or -output-dir")
+	}
+	if cfg.IfMatch != "" && !cfg.PatchDemo {
+		return Config{}, fmt.Errorf("-if-match requires -patch-demo")
+	}
+	if cfg.RetryPolicy.MaxAttempts < 1 {
+		return Config{}, fmt.Errorf("invalid -retry-max-attempts %d: must be at least 1", cfg.RetryPolicy.MaxAttempts)
+	}
+	if cfg.OpTimeout < 0 {
+		return Config{}, fmt.Errorf("invalid -op-timeout %v: must not be negative", cfg.OpTimeout)
+	}
+	if cfg.Deadline < 0 {
+		return Config{}, fmt.Errorf("invalid -deadline %v: must not be negative", cfg.Deadline)
+	}
+	if cfg.Deadline > 0 {
+		cfg.DeadlineAt = time.Now().Add(cfg.Deadline)
+	}
+	if cfg.TargetRUs < 0 {
+		return Config{}, fmt.Errorf("invalid -target-rus %d: must not be negative", cfg.TargetRUs)
+	}
+	if cfg.RetryPolicy.MaxElapsedTime < 0 {
+		return Config{}, fmt.Errorf("invalid -retry-max-elapsed %v: must not be negative", cfg.RetryPolicy.MaxElapsedTime)
+	}
+	cfg.RetryPolicy.InitialInterval = retry.Default.InitialInterval
+	cfg.RetryPolicy.Multiplier = retry.Default.Multiplier
+	cfg.RetryPolicy.MaxInterval = retry.Default.MaxInterval
+	cfg.RetryPolicy.Jitter = retry.Default.Jitter
+
+	if cfg.Workers < 1 {
+		return Config{}, fmt.Errorf("invalid -workers %d: must be at least 1", cfg.Workers)
+	}
+	if cfg.Buffer < 0 {
+		return Config{}, fmt.Errorf("invalid -buffer %d: must not be negative", cfg.Buffer)
+	}
+	if cfg.Scale != 0 && cfg.Scale < 400 {
+		return Config{}, fmt.Errorf("invalid -scale %d: throughput starts at 400 RU/s", cfg.Scale)
+	}
+	if cfg.PreLoadRUs != 0 && cfg.PreLoadRUs < 400 {
+		return Config{}, fmt.Errorf("invalid -pre-load-rus %d: manual throughput starts at 400 RU/s", cfg.PreLoadRUs)
+	}
+	if cfg.AnomalyRate < 0 || cfg.AnomalyRate > 1 {
+		return Config{}, fmt.Errorf("invalid -anomaly-rate %g: must be between 0 and 1", cfg.AnomalyRate)
+	}
+	if cfg.SkewFactor < 0 || cfg.SkewFactor > 1 {
+		return Config{}, fmt.Errorf("invalid -skew-factor %g: must be between 0 and 1", cfg.SkewFactor)
+	}
+	if cfg.HotRatio < 0 || cfg.HotRatio > 1 {
+		return Config{}, fmt.Errorf("invalid -hot-ratio %g: must be between 0 and 1", cfg.HotRatio)
+	}
+	if cfg.RowsPerTenant < 0 {
+		return Config{}, fmt.Errorf("invalid -rows-per-tenant %d: must not be negative", cfg.RowsPerTenant)
+	}
+	if cfg.RowsPerTenant > 0 && (cfg.HotTenant != "" || cfg.SkewFactor > 0 || cfg.Duration > 0 || cfg.TemplateFile != "" || cfg.CheckpointFile != "") {
+		return Config{}, fmt.Errorf("-rows-per-tenant cannot be combined with -hot-tenant, -skew-factor, -duration, -template or -checkpoint-file")
+	}
+	if cfg.HotUser != "" && cfg.HotTenant == "" {
+		return Config{}, fmt.Errorf("-hot-user requires -hot-tenant")
+	}
+	if len(cfg.Endpoints) > 0 && cfg.Endpoint != cfg.Endpoints[0] {
+		return Config{}, fmt.Errorf("-endpoint %s differs from the first of -endpoints, pass only -endpoints", cfg.Endpoint)
+	}
+	if len(cfg.Endpoints) > 1 && (cfg.Bulk || cfg.WithProfiles || cfg.OutputDir != "") {
+		// batches and profiles are written through the first endpoint's client
+		return Config{}, fmt.Errorf("several -endpoints cannot be combined with -bulk, -with-profiles or -output-dir")
+	}
+	if cfg.GrowUsers < 0 {
+		return Config{}, fmt.Errorf("invalid -grow-users %d: must not be negative", cfg.GrowUsers)
+	}
+	if cfg.GrowUsers > 0 && cfg.UserPool == "" {
+		return Config{}, fmt.Errorf("-grow-users requires -user-pool")
+	}
+	if cfg.UserPool != "" && (cfg.HotUser != "" || cfg.Duration > 0 || cfg.TemplateFile != "" || cfg.LoadTest) {
+		// the pool is saved at the end of a -rows load, the other modes never save it
+		return Config{}, fmt.Errorf("-user-pool cannot be combined with -hot-user, -duration, -template or -load-test-mode")
+	}
+	if cfg.Duration > 0 && cfg.TargetOps < 1 {
+		return Config{}, fmt.Errorf("invalid -target-ops %d: must be at least 1", cfg.TargetOps)
+	}
+
+	cfg.EventsMin, cfg.EventsMax, err = parseRange(eventsPerSession)
+	if err != nil || cfg.EventsMin < 1 {
+		return Config{}, fmt.Errorf("invalid -events-per-session %q: expected a positive N or min..max", eventsPerSession)
+	}
+
+	if cfg.ProfilesContainer != "" && !cfg.WithProfiles {
+		return Config{}, fmt.Errorf("-profiles-container requires -with-profiles")
+	}
+	if cfg.WithProfiles && (cfg.Duration > 0 || cfg.TemplateFile != "") {
+		return Config{}, fmt.Errorf("-with-profiles cannot be combined with -duration or -template")
+	}
+	if cfg.ReportDir != "" && cfg.Duration > 0 {
+		return Config{}, fmt.Errorf("-report-dir cannot be combined with -duration")
+	}
+	if !slices.Contains(splitModes, cfg.SplitBy) {
+		return Config{}, fmt.Errorf("invalid -split-by %q: must be one of %v", cfg.SplitBy, splitModes)
+	}
+	if cfg.OutputDir != "" && (cfg.Bulk || cfg.Duration > 0 || cfg.WithProfiles || cfg.TemplateFile != "" || cfg.Ping || cfg.Scale > 0 ||
+		cfg.EraseUser != "" || cfg.Purge || cfg.BenchWrites > 0 || cfg.LoadTest || cfg.ConcurrencyDemo || cfg.PatchDemo || cfg.TargetRUs > 0 || cfg.PreLoadRUs > 0) {
+		return Config{}, fmt.Errorf("-output-dir only generates records to files and cannot be combined with -bulk, -duration, -with-profiles, " +
+			"-template, -ping, -scale, -erase-user, -purge, -bench-writes, -load-test-mode, -concurrency-demo, -patch-demo, -target-rus or -pre-load-rus")
+	}
+	if cfg.StartRPS < 1 {
+		return Config{}, fmt.Errorf("invalid -start-rps %d: must be at least 1", cfg.StartRPS)
+	}
+	if cfg.LoadTest && (cfg.Duration > 0 || cfg.Bulk || cfg.TemplateFile != "" || cfg.WithProfiles || cfg.TargetRUs > 0 || cfg.Mode == "replace") {
+		return Config{}, fmt.Errorf("-load-test-mode cannot be combined with -duration, -bulk, -template, -with-profiles, -target-rus or -mode replace")
+	}
+	if cfg.BenchWrites < 0 {
+		return Config{}, fmt.Errorf("invalid -bench-writes %d: must not be negative", cfg.BenchWrites)
+	}
+	if cfg.BenchCleanup && cfg.BenchWrites == 0 {
+		return Config{}, fmt.Errorf("-bench-cleanup requires -bench-writes")
+	}
+	if cfg.Purge && cfg.EraseUser != "" {
+		return Config{}, fmt.Errorf("-purge cannot be combined with -erase-user")
+	}
+
+	if cfg.EncryptPII {
+		if cfg.EncryptionKey == "" {
+			return Config{}, fmt.Errorf("-encrypt-pii requires -encryption-key")
+		}
+		cfg.PIIKey, err = pii.ParseKey(cfg.EncryptionKey)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid -encryption-key: %w", err)
+		}
+	}
+
+	if cfg.BatchSize < 1 || cfg.BatchSize > maxBatchOperations {
+		return Config{}, fmt.Errorf("invalid -batch-size %d: must be between 1 and %d", cfg.BatchSize, maxBatchOperations)
+	}
+	if cfg.Bulk && (cfg.Duration > 0 || cfg.TemplateFile != "" || cfg.WithProfiles || cfg.CheckpointFile != "" || cfg.ShardByTenant) {
+		return Config{}, fmt.Errorf("-bulk cannot be combined with -duration, -template, -with-profiles, -checkpoint-file or -shard-by-tenant")
+	}
+
+	if cfg.TemplateCheck && cfg.TemplateFile == "" {
+		return Config{}, fmt.Errorf("-template-check requires -template")
+	}
+	if cfg.TemplateFile != "" && cfg.Duration > 0 {
+		return Config{}, fmt.Errorf("-template cannot be combined with -duration")
+	}
+
+	seedSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			seedSet = true
+		}
+	})
+	if !seedSet {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	if cfg.Resume {
+		if cfg.CheckpointFile == "" {
+			return Config{}, fmt.Errorf("-resume requires -checkpoint-file")
+		}
+		if cfg.Duration > 0 || cfg.TemplateFile != "" {
+			return Config{}, fmt.Errorf("-resume cannot be combined with -duration or -template")
+		}
+		cp, err := readCheckpoint(cfg.CheckpointFile)
+		if err != nil {
+			return Config{}, err
+		}
+		if seedSet && cfg.Seed != cp.Seed {
+			return Config{}, fmt.Errorf("-seed %d does not match seed %d in checkpoint %s", cfg.Seed, cp.Seed, cfg.CheckpointFile)
+		}
+		if cp.Completed > cfg.RowCount {
+			return Config{}, fmt.Errorf("checkpoint %s already completed %d records, more than -rows %d", cfg.CheckpointFile, cp.Completed, cfg.RowCount)
+		}
+		cfg.Seed = cp.Seed
+		cfg.ResumeFrom = cp.Completed
+	}
+
+	cfg.IndexingPolicy, err = loadIndexingPolicy(cfg.IndexingPolicySource)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid -indexing-policy: %w", err)
+	}
+	if cfg.CompositeIndexes {
+		cfg.IndexingPolicy = withCompositeIndexes(cfg.IndexingPolicy)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/google/uuid"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/diag"
+)
+
+// conflictModes are the values of -on-conflict
+var conflictModes = []string{"skip", "retry-new-id", "fail"}
+
+// maxConflictRetries is how often -on-conflict retry-new-id generates a new id
+// for one record before leaving it unwritten
+const maxConflictRetries = 3
+
+// isUniqueKeyConflict reports whether err is a 409 caused by the container's
+// unique key policy rather than by an existing id. Those carry a substatus or
+// name the unique index, and a new id never resolves them
+func isUniqueKeyConflict(err error) bool {
+	if statusCode(err) != 409 {
+		return false
+	}
+	subStatus := diag.FromError("", err).SubStatus
+	if subStatus != "" && subStatus != "0" {
+		return true
+	}
+	return strings.Contains(err.Error(), "Unique index constraint violation")
+}
+
+// classifyConflict returns the outcome of a write that failed with 409, ok is
+// false for any other result. An id conflict is skipped unless -on-conflict
+// fail counts it as a failed write, a unique key conflict always is one
+func classifyConflict(config Config, err error) (o outcome, ok bool) {
+	switch {
+	case statusCode(err) != 409:
+		return 0, false
+	case isUniqueKeyConflict(err):
+		return outcomeUniqueConflict, true
+	case config.OnConflict == "fail":
+		return outcomeConflict, true
+	}
+	return outcomeSkipped, true
+}
+
+// createWithNewIDs retries a create of session that conflicted on its id, each
+// time with a newly generated id and the same partition key, up to
+// maxConflictRetries times. It returns the charge of the retries and the error
+// of the last one, session holds the id of the last attempt
+func createWithNewIDs(ctx context.Context, writer ItemWriter, partitionKey azcosmos.PartitionKey, session *UserSession) (float64, error) {
+	var charge float64
+	var err error
+	for range maxConflictRetries {
+		session.ID = uuid.NewString()
+		body, marshalErr := json.Marshal(session)
+		if marshalErr != nil {
+			return charge, fmt.Errorf("failed to marshal session: %w", marshalErr)
+		}
+
+		var attemptCharge float64
+		attemptCharge, err = writer.Create(ctx, partitionKey, body)
+		charge += attemptCharge
+		if statusCode(err) != 409 || isUniqueKeyConflict(err) {
+			return charge, err
+		}
+	}
+	return charge, err
+}
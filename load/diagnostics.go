@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/diag"
+)
+
+// printDiagnostics prints the request diagnostics of a failed write of rec
+// when -verbose is set
+func printDiagnostics(config Config, operation string, rec record, err error) {
+	if !config.Verbose {
+		return
+	}
+	writeDiagnostics(config, diag.FromError(operation, err, recordKeys(config, rec)...))
+}
+
+// printBatchDiagnostics prints the diagnostics of a transactional batch that
+// was rolled back when -verbose is set. The request itself succeeded, so they
+// come from the batch response rather than from an error
+func printBatchDiagnostics(config Config, rec record, resp azcosmos.TransactionalBatchResponse, status int, err error) {
+	if !config.Verbose {
+		return
+	}
+	writeDiagnostics(config, diag.Diagnostics{
+		Operation:     "transactional batch",
+		StatusCode:    status,
+		ActivityID:    resp.ActivityID,
+		RequestCharge: strconv.FormatFloat(float64(resp.RequestCharge), 'f', 2, 32),
+		PartitionKey:  recordKeys(config, rec),
+		Err:           err,
+	})
+}
+
+// recordKeys returns the partition key values of rec at the configured depth
+func recordKeys(config Config, rec record) []string {
+	keys := []string{rec.session.TenantID, rec.session.UserID, rec.session.SessionID}
+	return keys[:config.PKLevels]
+}
+
+// writeDiagnostics writes the block in one piece so the blocks of concurrent
+// workers do not interleave
+func writeDiagnostics(config Config, d diag.Diagnostics) {
+	var b bytes.Buffer
+	d.Print(&b, config.Redact)
+	os.Stderr.Write(b.Bytes())
+}
+
+// traceWrite returns a context recording the requests of one write when
+// -diagnostics is set, and a func printing them once the write is done
+func traceWrite(ctx context.Context, enabled bool, operation string) (context.Context, func()) {
+	if !enabled {
+		return ctx, func() {}
+	}
+	ctx, trace := diag.WithTrace(ctx, operation)
+	return ctx, func() {
+		var b bytes.Buffer
+		trace.Print(&b)
+		os.Stderr.Write(b.Bytes())
+	}
+}
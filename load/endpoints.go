@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// endpointCooldown is how long an endpoint that failed without a response or
+// with a 5xx is skipped by the round robin
+const endpointCooldown = 30 * time.Second
+
+// endpointWriter is one endpoint of a multiEndpointWriter with its counters,
+// which are guarded by mu
+type endpointWriter struct {
+	endpoint string
+	writer   ItemWriter
+
+	mu             sync.Mutex
+	successes      int
+	errors         int
+	latency        time.Duration // summed over every write
+	unhealthyUntil time.Time
+	cooldowns      int
+}
+
+// multiEndpointWriter spreads writes over the regional endpoints of a multi
+// region write account in round robin order, like an active-active
+// deployment where every region takes writes
+type multiEndpointWriter struct {
+	endpoints []*endpointWriter
+	next      atomic.Uint64
+}
+
+// newMultiEndpointWriter creates a client and a writer per endpoint of
+// config.Endpoints. Every endpoint must serve the database and container of
+// config, which the first one already ensured exist
+func newMultiEndpointWriter(config Config, limiter *ruLimiter) (*multiEndpointWriter, error) {
+	w := &multiEndpointWriter{}
+	for _, endpoint := range config.Endpoints {
+		connection := config.Connection
+		connection.Endpoint = endpoint
+		client, err := createCosmosClient(connection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client for %s: %w", endpoint, err)
+		}
+		containerClient, err := client.NewContainer(config.DatabaseName, config.ContainerName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create container client for %s: %w", endpoint, err)
+		}
+		w.endpoints = append(w.endpoints, &endpointWriter{
+			endpoint: endpoint,
+			writer:   newContainerWriter(containerClient, config, limiter),
+		})
+	}
+	return w, nil
+}
+
+// pick returns the next endpoint in round robin order that is not cooling
+// down. When every endpoint is, the one that recovers first is used
+func (w *multiEndpointWriter) pick() *endpointWriter {
+	start := w.next.Add(1) - 1
+	now := time.Now()
+
+	var soonest *endpointWriter
+	var soonestUntil time.Time
+	for i := range uint64(len(w.endpoints)) {
+		e := w.endpoints[(start+i)%uint64(len(w.endpoints))]
+		e.mu.Lock()
+		until := e.unhealthyUntil
+		e.mu.Unlock()
+		if !now.Before(until) {
+			return e
+		}
+		if soonest == nil || until.Before(soonestUntil) {
+			soonest, soonestUntil = e, until
+		}
+	}
+	return soonest
+}
+
+// write runs op against the next endpoint and records its outcome
+func (w *multiEndpointWriter) write(ctx context.Context, op func(ItemWriter) (float64, error)) (float64, error) {
+	e := w.pick()
+	start := time.Now()
+	charge, err := op(e.writer)
+	latency := time.Since(start)
+
+	// cancelled writes say nothing about the endpoint
+	if ctx.Err() != nil {
+		return charge, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.latency += latency
+	if err == nil {
+		e.successes++
+		return charge, nil
+	}
+	e.errors++
+
+	// 4xx responses come from a healthy endpoint rejecting the item itself
+	if code := statusCode(err); code == 0 || code >= 500 {
+		if time.Now().After(e.unhealthyUntil) {
+			log.Printf("Endpoint %s failed (%v), skipping it for %v", e.endpoint, err, endpointCooldown)
+			e.cooldowns++
+		}
+		e.unhealthyUntil = time.Now().Add(endpointCooldown)
+	}
+	return charge, err
+}
+
+// Upsert upserts the item through the next endpoint
+func (w *multiEndpointWriter) Upsert(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (float64, error) {
+	return w.write(ctx, func(writer ItemWriter) (float64, error) { return writer.Upsert(ctx, pk, body) })
+}
+
+// Create creates the item through the next endpoint
+func (w *multiEndpointWriter) Create(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (float64, error) {
+	return w.write(ctx, func(writer ItemWriter) (float64, error) { return writer.Create(ctx, pk, body) })
+}
+
+// Replace replaces the item through the next endpoint
+func (w *multiEndpointWriter) Replace(ctx context.Context, pk azcosmos.PartitionKey, id string, body []byte) (float64, error) {
+	return w.write(ctx, func(writer ItemWriter) (float64, error) { return writer.Replace(ctx, pk, id, body) })
+}
+
+// printSummary prints the writes, errors and average latency of every endpoint
+func (w *multiEndpointWriter) printSummary() {
+	fmt.Printf("\n📊 Endpoint Summary:\n")
+	fmt.Printf(" %-40s %10s %8s %12s %10s\n", "Endpoint", "Succeeded", "Errors", "Avg latency", "Cooldowns")
+	for _, e := range w.endpoints {
+		e.mu.Lock()
+		average := "-"
+		if writes := e.successes + e.errors; writes > 0 {
+			average = (e.latency / time.Duration(writes)).Round(time.Microsecond).String()
+		}
+		fmt.Printf(" %-40s %10d %8d %12s %10d\n", endpointHost(e.endpoint), e.successes, e.errors, average, e.cooldowns)
+		e.mu.Unlock()
+	}
+}
+
+// endpointHost returns the host of endpoint, or endpoint itself when it does
+// not parse
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	return u.Host
+}
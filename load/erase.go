@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// erasureAuditEntry is one line of the -audit-log file
+type erasureAuditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	UserID    string    `json:"userId"`
+	Deleted   int       `json:"deleted"`
+}
+
+// eraseUser deletes every item of userID. The same user ID can exist in
+// several tenants, so the items are found with a cross partition query and
+// each one is deleted with the partition key rebuilt from its own fields
+func eraseUser(ctx context.Context, containerClient *azcosmos.ContainerClient, userID string) (int, error) {
+	query := "SELECT c.id, c.tenantId, c.sessionId FROM c WHERE c.userId = @userId"
+
+	// the user is spread across tenants, so every partition has to be visited
+	emptyPartitionKey := azcosmos.NewPartitionKey()
+
+	pager := containerClient.NewQueryItemsPager(query, emptyPartitionKey, &azcosmos.QueryOptions{
+		QueryParameters: []azcosmos.QueryParameter{
+			{Name: "@userId", Value: userID},
+		},
+	})
+
+	// collect first so deletes do not disturb the continuation of the query
+	var items []UserSession
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to query items of user %s: %w", userID, err)
+		}
+		for _, _item := range page.Items {
+			var item UserSession
+			if err := json.Unmarshal(_item, &item); err != nil {
+				return 0, fmt.Errorf("failed to unmarshal item: %w", err)
+			}
+			item.UserID = userID
+			items = append(items, item)
+		}
+	}
+
+	deleted := 0
+	for _, item := range items {
+		partitionKey := azcosmos.NewPartitionKeyString(item.TenantID).AppendString(item.UserID).AppendString(item.SessionID)
+		_, err := containerClient.DeleteItem(ctx, partitionKey, item.ID, nil)
+		if statusCode(err) == 404 {
+			// already gone, for example expired through TTL
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete item %s of tenant %s: %w", item.ID, item.TenantID, err)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// appendErasureAudit appends an audit entry for an erasure to path as a JSON line
+func appendErasureAudit(path, userID string, deleted int) error {
+	line, err := json.Marshal(erasureAuditEntry{
+		Timestamp: time.Now().UTC(),
+		UserID:    userID,
+		Deleted:   deleted,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return file.Close()
+}
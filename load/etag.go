@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// PreconditionFailedError is returned by a write conditioned on an ETag when
+// the stored item has changed since that ETag was read (412 Precondition
+// Failed). The caller has to re-read the item and retry
+type PreconditionFailedError struct {
+	ID   string
+	ETag azcore.ETag
+	Err  error
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return fmt.Sprintf("item %s changed since ETag %s was read", e.ID, e.ETag)
+}
+
+func (e *PreconditionFailedError) Unwrap() error {
+	return e.Err
+}
+
+// ifMatch returns item options that make a write fail with 412 unless the
+// stored item still has etag
+func ifMatch(etag azcore.ETag) *azcosmos.ItemOptions {
+	return &azcosmos.ItemOptions{IfMatchEtag: &etag}
+}
+
+// preconditionError turns the 412 of a write conditioned on etag into a
+// *PreconditionFailedError and returns other errors unchanged
+func preconditionError(id string, etag azcore.ETag, err error) error {
+	if statusCode(err) == 412 {
+		return &PreconditionFailedError{ID: id, ETag: etag, Err: err}
+	}
+	return err
+}
+
+// updateIfUnchanged upserts item only if the stored item still has etag, the
+// write half of a read-modify-write. It returns the new ETag and the RU charge
+func updateIfUnchanged(ctx context.Context, containerClient *azcosmos.ContainerClient, pkLevels int, item UserSession, etag azcore.ETag) (azcore.ETag, float32, error) {
+	body, err := json.Marshal(item)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	partitionKey := buildPartitionKey(item, pkLevels)
+	resp, err := containerClient.UpsertItem(ctx, partitionKey, body, ifMatch(etag))
+	if err != nil {
+		return "", resp.RequestCharge, preconditionError(item.ID, etag, err)
+	}
+	return resp.ETag, resp.RequestCharge, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// split modes selectable with -split-by
+var splitModes = []string{"tenant", "user"}
+
+// maxOpenExportFiles bounds the file descriptors -split-by user keeps open. The
+// least recently opened file is closed first and reopened for append when needed
+const maxOpenExportFiles = 256
+
+// exportFile is one NDJSON output file and what was written to it
+type exportFile struct {
+	path    string
+	file    *os.File // nil while closed to stay under maxOpenExportFiles
+	buf     *bufio.Writer
+	records int
+	bytes   int64
+}
+
+// fileWriter is an ItemWriter that appends every record to an NDJSON file per
+// tenant, or per user below a directory per tenant, instead of writing it to
+// Cosmos DB. Files are created on first use and closed by close
+type fileWriter struct {
+	dir     string
+	splitBy string
+
+	mu    sync.Mutex
+	files map[string]*exportFile
+	open  []string // keys of the open files, oldest first
+}
+
+// newFileWriter returns a fileWriter writing below dir
+func newFileWriter(dir, splitBy string) (*fileWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return &fileWriter{dir: dir, splitBy: splitBy, files: map[string]*exportFile{}}, nil
+}
+
+// Upsert appends the record to its file. Writing to disk costs no RUs
+func (w *fileWriter) Upsert(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (float64, error) {
+	return 0, w.write(body)
+}
+
+// Create appends the record to its file. Unlike Cosmos DB, a file does not
+// detect an id that was already written
+func (w *fileWriter) Create(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (float64, error) {
+	return 0, w.write(body)
+}
+
+// Replace appends the record to its file. A file cannot tell whether the id
+// was written before, -mode replace is rejected together with -output-dir
+func (w *fileWriter) Replace(ctx context.Context, pk azcosmos.PartitionKey, id string, body []byte) (float64, error) {
+	return 0, w.write(body)
+}
+
+// write routes body to the file of its tenant or user
+func (w *fileWriter) write(body []byte) error {
+	var keys struct {
+		TenantID string `json:"tenantId"`
+		UserID   string `json:"userId"`
+	}
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return fmt.Errorf("failed to read record keys: %w", err)
+	}
+	if keys.TenantID == "" || (w.splitBy == "user" && keys.UserID == "") {
+		return fmt.Errorf("record has no %s to split by", w.splitBy)
+	}
+
+	path := filepath.Join(w.dir, fileName(keys.TenantID)+".ndjson")
+	if w.splitBy == "user" {
+		path = filepath.Join(w.dir, fileName(keys.TenantID), fileName(keys.UserID)+".ndjson")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	f, err := w.openFile(path)
+	if err != nil {
+		return err
+	}
+	n, err := f.buf.Write(append(body, '\n'))
+	f.bytes += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.path, err)
+	}
+	f.records++
+	return nil
+}
+
+// openFile returns the open file for path, creating it on first use and
+// closing the oldest open file when too many are open. Called with mu held
+func (w *fileWriter) openFile(path string) (*exportFile, error) {
+	f, ok := w.files[path]
+	if ok && f.file != nil {
+		return f, nil
+	}
+
+	if len(w.open) >= maxOpenExportFiles {
+		oldest := w.files[w.open[0]]
+		w.open = w.open[1:]
+		if err := oldest.close(); err != nil {
+			return nil, err
+		}
+	}
+
+	// a file seen before was closed to free a descriptor and is appended to
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if ok {
+		flags = os.O_WRONLY | os.O_APPEND
+	} else {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+		f = &exportFile{path: path}
+		w.files[path] = f
+	}
+
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	f.file = file
+	f.buf = bufio.NewWriter(file)
+	w.open = append(w.open, path)
+	return f, nil
+}
+
+// close flushes and closes the file
+func (f *exportFile) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.buf.Flush()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	f.file, f.buf = nil, nil
+	if err != nil {
+		return fmt.Errorf("failed to close %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// close flushes and closes every open file
+func (w *fileWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var firstErr error
+	for _, path := range w.open {
+		if err := w.files[path].close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.open = nil
+	return firstErr
+}
+
+// printFiles lists every output file with its record count and size
+func (w *fileWriter) printFiles() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	paths := make([]string, 0, len(w.files))
+	for path := range w.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var records int
+	var bytes int64
+	fmt.Printf("\n Output files (%d in %s):\n", len(paths), w.dir)
+	for _, path := range paths {
+		f := w.files[path]
+		name, err := filepath.Rel(w.dir, path)
+		if err != nil {
+			name = path
+		}
+		fmt.Printf("  %-40s %8d records %12d bytes\n", name, f.records, f.bytes)
+		records += f.records
+		bytes += f.bytes
+	}
+	fmt.Printf("  %-40s %8d records %12d bytes\n", "Total", records, bytes)
+}
+
+// fileName makes a tenant or user ID safe to use as a file name. Encrypted IDs
+// are base64 and may contain a slash
+func fileName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, id)
+	// . and .. would name a directory instead of a file
+	if strings.Trim(name, ".") == "" {
+		name = strings.ReplaceAll(name, ".", "_")
+	}
+	return name
+}
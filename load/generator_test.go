@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/pii"
+)
+
+// sessionIDPattern is "session-" and the first 8 hex digits of a UUID
+var sessionIDPattern = regexp.MustCompile(`^session-[0-9a-f]{8}$`)
+
+func TestGenerateUserSession(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	for _, tenant := range tenantTypes {
+		for _, seed := range []int64{1, 2, 42} {
+			t.Run(fmt.Sprintf("%s/seed %d", tenant.Name, seed), func(t *testing.T) {
+				rng := rand.New(rand.NewSource(seed))
+				for range 200 {
+					session := generateUserSession(rng, tenant, now)
+					checkSession(t, session, tenant, now)
+				}
+			})
+		}
+	}
+}
+
+// checkSession checks session was generated for tenant within the 30 days
+// before now
+func checkSession(t *testing.T, session UserSession, tenant TenantConfig, now time.Time) {
+	t.Helper()
+	if session.TenantID != tenant.Name {
+		t.Fatalf("tenantId = %q, want %q", session.TenantID, tenant.Name)
+	}
+	if !slices.ContainsFunc(tenantTypes, func(c TenantConfig) bool { return c.Name == session.TenantID }) {
+		t.Fatalf("tenantId %q is not one of tenantTypes", session.TenantID)
+	}
+
+	number, err := strconv.Atoi(strings.TrimPrefix(session.UserID, "user-"))
+	if !strings.HasPrefix(session.UserID, "user-") || err != nil {
+		t.Fatalf("userId = %q, want user-<number>", session.UserID)
+	}
+	if number < tenant.UserMin || number > tenant.UserMax {
+		t.Fatalf("userId %q is outside [%d, %d]", session.UserID, tenant.UserMin, tenant.UserMax)
+	}
+
+	if !sessionIDPattern.MatchString(session.SessionID) {
+		t.Fatalf("sessionId = %q, want session- and 8 hex digits", session.SessionID)
+	}
+
+	if session.Timestamp.After(now) || session.Timestamp.Before(now.AddDate(0, 0, -30)) {
+		t.Fatalf("timestamp %v is not within the 30 days before %v", session.Timestamp, now)
+	}
+	if err := session.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+}
+
+func TestGenerateUserSessionSeeded(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	tenant := tenantTypes[2]
+
+	first := generateUserSession(rand.New(rand.NewSource(7)), tenant, now)
+	second := generateUserSession(rand.New(rand.NewSource(7)), tenant, now)
+
+	// the ids are random UUIDs, everything drawn from rng repeats
+	first.ID, second.ID = "", ""
+	first.SessionID, second.SessionID = "", ""
+	if first != second {
+		t.Errorf("same seed generated\n%+v\n%+v", first, second)
+	}
+}
+
+func TestGenerateSessionEvents(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewSource(3))
+
+	for _, eventCount := range []int{1, 2, 5, 12} {
+		t.Run(strconv.Itoa(eventCount), func(t *testing.T) {
+			events := generateSessionEvents(rng, eventCount, tenantTypes[0], now)
+			if len(events) != eventCount {
+				t.Fatalf("got %d events, want %d", len(events), eventCount)
+			}
+			if eventCount > 1 && (events[0].Activity != "login" || events[eventCount-1].Activity != "logout") {
+				t.Errorf("session runs %s..%s, want login..logout", events[0].Activity, events[eventCount-1].Activity)
+			}
+			for i, event := range events {
+				if event.UserID != events[0].UserID || event.SessionID != events[0].SessionID {
+					t.Errorf("event %d is in %s/%s, want %s/%s", i, event.UserID, event.SessionID, events[0].UserID, events[0].SessionID)
+				}
+				if event.Timestamp.After(now) {
+					t.Errorf("event %d at %v is after %v", i, event.Timestamp, now)
+				}
+				if i > 0 && !event.Timestamp.After(events[i-1].Timestamp) {
+					t.Errorf("event %d at %v is not after event %d at %v", i, event.Timestamp, i-1, events[i-1].Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionGeneratorDeterministic(t *testing.T) {
+	generate := func(args ...string) []UserSession {
+		config := testConfig(t, append([]string{"-events-per-session", "1..6"}, args...)...)
+		generator, err := newSessionGenerator(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions := make([]UserSession, 500)
+		for i := range sessions {
+			sessions[i] = generator.next()
+		}
+		return sessions
+	}
+
+	first := generate("-seed", "9", "-deterministic-ids")
+	second := generate("-seed", "9", "-deterministic-ids")
+	if !slices.Equal(first, second) {
+		t.Error("the same seed with -deterministic-ids generated different records")
+	}
+
+	// without -deterministic-ids the ids and timestamps move, the draws do not
+	random := generate("-seed", "9")
+	for i := range first {
+		a, b := first[i], random[i]
+		if a.TenantID != b.TenantID || a.UserID != b.UserID || a.Activity != b.Activity {
+			t.Fatalf("record %d: %s/%s/%s, want %s/%s/%s", i, b.TenantID, b.UserID, b.Activity, a.TenantID, a.UserID, a.Activity)
+		}
+	}
+
+	other := generate("-seed", "10", "-deterministic-ids")
+	if slices.Equal(first, other) {
+		t.Error("different seeds generated the same records")
+	}
+}
+
+func TestSessionGeneratorStoresUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	generator, err := newSessionGenerator(testConfig(t, "-seed", "3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the query tool filters history with a UTC cutoff compared as a string
+	cutoff := time.Now().Add(-24 * time.Hour).UTC()
+	for i := range 50 {
+		session := generator.next()
+		body, err := json.Marshal(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stored struct {
+			Timestamp string `json:"timestamp"`
+		}
+		if err := json.Unmarshal(body, &stored); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(stored.Timestamp, "Z") {
+			t.Fatalf("record %d: timestamp %q, want UTC", i, stored.Timestamp)
+		}
+		before := stored.Timestamp < cutoff.Format(time.RFC3339Nano)
+		if before != session.Timestamp.Before(cutoff) {
+			t.Errorf("record %d: %q compares against cutoff %q unlike its time", i, stored.Timestamp, cutoff.Format(time.RFC3339Nano))
+		}
+	}
+}
+
+func TestSessionGeneratorEncryptsPII(t *testing.T) {
+	key := strings.Repeat("0f", pii.KeySize)
+	generate := func(args ...string) []UserSession {
+		config := testConfig(t, append([]string{"-seed", "5", "-deterministic-ids", "-events-per-session", "3"}, args...)...)
+		generator, err := newSessionGenerator(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions := make([]UserSession, 60)
+		for i := range sessions {
+			sessions[i] = generator.next()
+		}
+		return sessions
+	}
+	plain := generate()
+	encrypted := generate("-encrypt-pii", "-encryption-key", key)
+
+	parsed, err := pii.ParseKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := pii.NewCipher(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range plain {
+		userID, err := cipher.Decrypt(encrypted[i].UserID)
+		if err != nil || userID != plain[i].UserID {
+			t.Errorf("record %d: userId decrypts to %q, %v, want %q", i, userID, err, plain[i].UserID)
+		}
+		sessionID, err := cipher.Decrypt(encrypted[i].SessionID)
+		if err != nil || sessionID != plain[i].SessionID {
+			t.Errorf("record %d: sessionId decrypts to %q, %v, want %q", i, sessionID, err, plain[i].SessionID)
+		}
+		if encrypted[i].TenantID != plain[i].TenantID || encrypted[i].ID != plain[i].ID {
+			t.Errorf("record %d: tenantId and id changed, only userId and sessionId are encrypted", i)
+		}
+	}
+
+	// the events of a session keep one partition key
+	for i := 0; i < len(encrypted); i += 3 {
+		for _, event := range encrypted[i+1 : i+3] {
+			if event.UserID != encrypted[i].UserID || event.SessionID != encrypted[i].SessionID {
+				t.Errorf("record %d: the events of one session have different encrypted keys", i)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// keysOnlyIndexingPolicy indexes only the partition key paths and the timestamp,
+// which is all the query tool filters or sorts on, so writes pay for fewer index updates
+func keysOnlyIndexingPolicy() *azcosmos.IndexingPolicy {
+	return &azcosmos.IndexingPolicy{
+		Automatic:    true,
+		IndexingMode: azcosmos.IndexingModeConsistent,
+		IncludedPaths: []azcosmos.IncludedPath{
+			{Path: "/tenantId/?"},
+			{Path: "/userId/?"},
+			{Path: "/sessionId/?"},
+			{Path: "/timestamp/?"},
+		},
+		ExcludedPaths: []azcosmos.ExcludedPath{
+			{Path: "/*"},
+			{Path: "/\"_etag\"/?"},
+		},
+	}
+}
+
+// timestampCompositeIndexes serve ORDER BY c.tenantId ASC, c.timestamp DESC and
+// the same with c.userId, the recent sessions of a tenant or user that the
+// query tool's -query-mode recent-sessions reads
+var timestampCompositeIndexes = [][]azcosmos.CompositeIndex{
+	{
+		{Path: "/tenantId", Order: azcosmos.CompositeIndexAscending},
+		{Path: "/timestamp", Order: azcosmos.CompositeIndexDescending},
+	},
+	{
+		{Path: "/tenantId", Order: azcosmos.CompositeIndexAscending},
+		{Path: "/userId", Order: azcosmos.CompositeIndexAscending},
+		{Path: "/timestamp", Order: azcosmos.CompositeIndexDescending},
+	},
+}
+
+// defaultIndexingPolicy is the policy Cosmos DB gives a container by default,
+// every path indexed
+func defaultIndexingPolicy() *azcosmos.IndexingPolicy {
+	return &azcosmos.IndexingPolicy{
+		Automatic:     true,
+		IndexingMode:  azcosmos.IndexingModeConsistent,
+		IncludedPaths: []azcosmos.IncludedPath{{Path: "/*"}},
+		ExcludedPaths: []azcosmos.ExcludedPath{{Path: "/\"_etag\"/?"}},
+	}
+}
+
+// withCompositeIndexes adds the timestampCompositeIndexes that policy does not
+// have yet. A nil policy starts from defaultIndexingPolicy
+func withCompositeIndexes(policy *azcosmos.IndexingPolicy) *azcosmos.IndexingPolicy {
+	if policy == nil {
+		policy = defaultIndexingPolicy()
+	}
+	for _, index := range timestampCompositeIndexes {
+		if !slices.ContainsFunc(policy.CompositeIndexes, func(existing []azcosmos.CompositeIndex) bool {
+			return slices.Equal(existing, index)
+		}) {
+			policy.CompositeIndexes = append(policy.CompositeIndexes, index)
+		}
+	}
+	return policy
+}
+
+// loadIndexingPolicy resolves the -indexing-policy value: "" keeps the container
+// default, "keys" selects keysOnlyIndexingPolicy and anything else is read as a
+// JSON indexing policy file
+func loadIndexingPolicy(value string) (*azcosmos.IndexingPolicy, error) {
+	switch value {
+	case "":
+		return nil, nil
+	case "keys":
+		return keysOnlyIndexingPolicy(), nil
+	}
+
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexing policy file: %w", err)
+	}
+
+	var policy azcosmos.IndexingPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse indexing policy file %s: %w", value, err)
+	}
+	return &policy, nil
+}
+
+// sameIndexingPolicy reports whether an existing indexing policy already
+// matches the wanted one, ignoring system paths Cosmos DB adds by itself
+func sameIndexingPolicy(existing, wanted *azcosmos.IndexingPolicy) bool {
+	if existing == nil {
+		return false
+	}
+
+	includedPaths := func(paths []azcosmos.IncludedPath) []string {
+		var result []string
+		for _, p := range paths {
+			result = append(result, p.Path)
+		}
+		slices.Sort(result)
+		return result
+	}
+	excludedPaths := func(paths []azcosmos.ExcludedPath) []string {
+		var result []string
+		for _, p := range paths {
+			if p.Path == "/\"_etag\"/?" {
+				continue
+			}
+			result = append(result, p.Path)
+		}
+		slices.Sort(result)
+		return result
+	}
+
+	return slices.Equal(includedPaths(existing.IncludedPaths), includedPaths(wanted.IncludedPaths)) &&
+		slices.Equal(excludedPaths(existing.ExcludedPaths), excludedPaths(wanted.ExcludedPaths)) &&
+		slices.EqualFunc(existing.CompositeIndexes, wanted.CompositeIndexes, func(a, b []azcosmos.CompositeIndex) bool {
+			return slices.Equal(a, b)
+		})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// the emulator's well known account key, COSMOS_EMULATOR_KEY overrides it
+const emulatorKey = "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XyIDqw=="
+
+// TestEmulatorLoad loads a seeded dataset into a new database on the emulator
+// at COSMOS_EMULATOR_ENDPOINT and reads every record back with its full
+// partition key. The same seed is loaded into a fakeWriter first, which fixes
+// the records the emulator must hold
+func TestEmulatorLoad(t *testing.T) {
+	endpoint := os.Getenv("COSMOS_EMULATOR_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("COSMOS_EMULATOR_ENDPOINT is not set, e.g. https://localhost:8081")
+	}
+	key := os.Getenv("COSMOS_EMULATOR_KEY")
+	if key == "" {
+		key = emulatorKey
+	}
+
+	databaseName := fmt.Sprintf("load-test-%d", time.Now().UnixNano())
+	config := testConfig(t, "-rows", "30", "-workers", "2", "-seed", "54", "-deterministic-ids",
+		"-endpoint", endpoint, "-auth", "key", "-key", key, "-database", databaseName, "-container", "UserSessions")
+
+	expected := &fakeWriter{}
+	captureStdout(t, func() {
+		if _, err := loadSampleData(expected, config, nil); err != nil {
+			t.Fatalf("dry run: %v", err)
+		}
+	})
+
+	client, err := config.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var containerClient *azcosmos.ContainerClient
+	captureStdout(t, func() {
+		containerClient, err = ensureDatabaseAndContainer(client, config)
+	})
+	if err != nil {
+		t.Skipf("emulator at %s is not reachable: %v", endpoint, err)
+	}
+	t.Cleanup(func() {
+		database, err := client.NewDatabase(databaseName)
+		if err == nil {
+			_, err = database.Delete(context.Background(), nil)
+		}
+		if err != nil {
+			t.Logf("failed to delete database %s: %v", databaseName, err)
+		}
+	})
+
+	var stats *loadStats
+	captureStdout(t, func() {
+		stats, err = loadSampleData(newContainerWriter(containerClient, config, nil), config, nil)
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if stats.success != config.RowCount {
+		t.Errorf("wrote %d records, want %d", stats.success, config.RowCount)
+	}
+	if stats.charge.Total() <= 0 {
+		t.Errorf("charge = %v, want it above 0", stats.charge.Total())
+	}
+
+	for id, body := range expected.items {
+		var session UserSession
+		if err := json.Unmarshal(body, &session); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := containerClient.ReadItem(context.Background(), buildPartitionKey(session, config.PKLevels), id, nil)
+		if err != nil {
+			t.Errorf("failed to read %s: %v", id, err)
+			continue
+		}
+		var read UserSession
+		if err := json.Unmarshal(resp.Value, &read); err != nil {
+			t.Fatal(err)
+		}
+		if read.TenantID != session.TenantID || read.UserID != session.UserID || read.SessionID != session.SessionID ||
+			read.Activity != session.Activity || !read.Timestamp.Equal(session.Timestamp) {
+			t.Errorf("read %+v, want %+v", read, session)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// BenchmarkLoadSampleData loads b.N records through the generator, the
+// writer pool and the accounting into a fakeWriter charging 5.7 RU per write
+func BenchmarkLoadSampleData(b *testing.B) {
+	config := testConfig(b, "-rows", "1", "-workers", "4")
+	config.RowCount = b.N
+	writer := &fakeWriter{charge: 5.7}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var stats *loadStats
+	var err error
+	captureStdout(b, func() {
+		stats, err = loadSampleData(writer, config, nil)
+	})
+	b.StopTimer()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	reportLoad(b, stats)
+}
+
+// BenchmarkLoadBulkVsSequential loads b.N records one write at a time and as
+// transactional batches, side by side. Every call takes 1ms like a round trip
+// to the account, and a write costs 5.7 RU on its own or in a batch, so the
+// throughput shows what batching saves in round trips and RU/op what it costs
+func BenchmarkLoadBulkVsSequential(b *testing.B) {
+	const latency = time.Millisecond
+	args := []string{"-rows", "1", "-workers", "4", "-pk-levels", "1", "-batch-size", "50"}
+
+	b.Run("sequential", func(b *testing.B) {
+		config := testConfig(b, args...)
+		config.RowCount = b.N
+		writer := &fakeWriter{charge: 5.7, latency: latency}
+
+		b.ResetTimer()
+		var stats *loadStats
+		var err error
+		captureStdout(b, func() {
+			stats, err = loadSampleData(writer, config, nil)
+		})
+		b.StopTimer()
+		if err != nil {
+			b.Fatal(err)
+		}
+		reportLoad(b, stats)
+	})
+
+	b.Run("bulk", func(b *testing.B) {
+		config := testConfig(b, append(args, "-bulk")...)
+		config.RowCount = b.N
+		writer := &fakeWriter{charge: 5.7, latency: latency}
+		batches := &fakeBatchWriter{chargePerRecord: 5.7, latency: latency}
+
+		b.ResetTimer()
+		var stats *loadStats
+		var err error
+		captureStdout(b, func() {
+			stats, err = loadSampleDataBulk(batches, writer, config)
+		})
+		b.StopTimer()
+		if err != nil {
+			b.Fatal(err)
+		}
+		reportLoad(b, stats)
+		b.ReportMetric(float64(batches.calls), "batches")
+	})
+}
+
+// reportLoad reports the records written, the RU charge and the throughput of
+// a benchmarked load
+func reportLoad(b *testing.B, stats *loadStats) {
+	b.ReportMetric(float64(stats.success)/float64(b.N), "records/op")
+	b.ReportMetric(stats.charge.Total()/float64(b.N), "RU/op")
+	b.ReportMetric(float64(stats.success)/b.Elapsed().Seconds(), "records/s")
+}
+
+// BenchmarkGenerateUserSession measures the data generation alone
+func BenchmarkGenerateUserSession(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	now := time.Now()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		generateUserSession(rng, tenantTypes[i%len(tenantTypes)], now)
+	}
+}
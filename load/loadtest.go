@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// the load test raises the rate by loadTestStep every loadTestWindow until more
+// than loadTestMaxThrottled of the writes of a window are throttled
+const (
+	loadTestWindow       = 5 * time.Second
+	loadTestStep         = 1.10
+	loadTestMaxThrottled = 0.05
+)
+
+// loadTestBurst returns the burst of the load test's limiter at rps, a
+// tenth of a second worth of writes, so a raised rate takes effect without a
+// burst
+func loadTestBurst(rps float64) int {
+	return max(1, int(rps/10))
+}
+
+// loadTestWindowStats counts the writes of one window of the load test
+type loadTestWindowStats struct {
+	target    float64
+	ops       int
+	throttled int
+	errors    int
+	charge    float64
+}
+
+// achieved returns the successful writes per second of the window
+func (w loadTestWindowStats) achieved() float64 {
+	return float64(w.ops-w.throttled-w.errors) / loadTestWindow.Seconds()
+}
+
+// throttleRate returns the share of the window's writes rejected with 429
+func (w loadTestWindowStats) throttleRate() float64 {
+	if w.ops == 0 {
+		return 0
+	}
+	return float64(w.throttled) / float64(w.ops)
+}
+
+// runLoadTest writes generated records with config.Workers writers paced by a
+// token bucket, starting at config.StartRPS and raising the rate by 10% every
+// window until more than 5% of a window's writes are throttled. The last window
+// below that is the maximum sustainable rate. Writes are not retried, so every
+// 429 counts
+func runLoadTest(writer ItemWriter, config Config) error {
+	ctx, stop := runContext(config)
+	defer stop()
+
+	fmt.Printf("Running load test from %d records/sec, +%.0f%% every %v until more than %.0f%% of writes are throttled (Ctrl-C to stop early)...\n",
+		config.StartRPS, (loadTestStep-1)*100, loadTestWindow, loadTestMaxThrottled*100)
+
+	generator, err := newSessionGenerator(config)
+	if err != nil {
+		return err
+	}
+
+	rps := float64(config.StartRPS)
+	limiter := rate.NewLimiter(rate.Limit(rps), loadTestBurst(rps))
+
+	var mu sync.Mutex // guards generator and window
+	window := loadTestWindowStats{target: rps}
+
+	writersCtx, stopWriters := context.WithCancel(ctx)
+	defer stopWriters()
+	var wg sync.WaitGroup
+	for range config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for waitLimiter(writersCtx, limiter, 1) == nil {
+				mu.Lock()
+				session := generator.next()
+				mu.Unlock()
+
+				body, err := json.Marshal(session)
+				var charge float64
+				if err == nil {
+					charge, err = writeItem(writersCtx, writer, config.Mode, buildPartitionKey(session, config.PKLevels), body)
+				}
+				if writersCtx.Err() != nil {
+					return
+				}
+
+				mu.Lock()
+				window.ops++
+				window.charge += charge
+				switch {
+				case statusCode(err) == 429:
+					window.throttled++
+				case config.Mode == "insert" && statusCode(err) == 409:
+				case err != nil:
+					window.errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(loadTestWindow)
+	defer ticker.Stop()
+
+	fmt.Printf(" %12s %12s %10s %8s %8s\n", "Target/sec", "Written/sec", "RU/s", "429 %", "Errors")
+	var best loadTestWindowStats
+	found := false
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+
+		rps *= loadTestStep
+		mu.Lock()
+		last := window
+		window = loadTestWindowStats{target: rps}
+		mu.Unlock()
+
+		fmt.Printf(" %12.1f %12.1f %10.1f %7.1f%% %8d\n",
+			last.target, last.achieved(), last.charge/loadTestWindow.Seconds(), last.throttleRate()*100, last.errors)
+		if last.throttleRate() > loadTestMaxThrottled {
+			break
+		}
+		best, found = last, true
+		limiter.SetLimit(rate.Limit(rps))
+		limiter.SetBurst(loadTestBurst(rps))
+	}
+	stopWriters()
+	wg.Wait()
+
+	fmt.Printf("\n📊 Load Test Summary:\n")
+	if !found {
+		fmt.Printf(" No sustainable rate found: more than %.0f%% of writes were throttled at %d records/sec, lower -start-rps\n",
+			loadTestMaxThrottled*100, config.StartRPS)
+	} else {
+		fmt.Printf(" Maximum sustainable rate: %.1f records/sec (target %.1f)\n", best.achieved(), best.target)
+		fmt.Printf(" RU/s at that rate: %.1f\n", best.charge/loadTestWindow.Seconds())
+		// the writers fall behind the target when each write takes too long
+		if best.achieved() < best.target*0.9 {
+			fmt.Printf(" Note: writes lagged the target rate, raise -workers to push further\n")
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Println(" Interrupted before throttling set in, the maximum may be higher")
+			return nil
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			fmt.Println(" -deadline reached before throttling set in, the maximum may be higher")
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -9,41 +9,41 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
 	"github.com/google/uuid"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/config"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/pii"
 )
 
-// user session data model with heirarchical partition keys
-// key/column/field with highest cardinality comes first/level 1 as the
-// sample partitioned keys /tenantId/userId/sessionId
-type UserSession struct {
-	ID        string    `json:"id"`
-	TenantID  string    `json:"tenantId"`  // level 1: Tenant Isolation
-	UserID    string    `json:"userId"`    // level 2: User distribution
-	SessionID string    `json:"sessionId"` // level 3: session granularity
-	Activity  string    `json:"activity"`
-	Timestamp time.Time `json:"timestamp"`
+// UserSession is the session document written by the loader
+type UserSession = model.UserSession
+
+// hierarchical partition key paths, ordered from level 1 to level 3
+var partitionKeyPaths = []string{
+	"/tenantId",  // Level 1: Tenant isolation
+	"/userId",    // Level 2: User Distribution
+	"/sessionId", // Level 3: Session granularity
 }
 
-// configuration for Azure Cosmos DB connection
-type Config struct {
-	Endpoint      string
-	DatabaseName  string
-	ContainerName string
-	RowCount      int
+// TenantConfig describes a tenant type and the size of its user base
+type TenantConfig struct {
+	Name     string `json:"name"`
+	UserMin  int    `json:"userMin"`
+	UserMax  int    `json:"userMax"`
+	Sessions int    `json:"sessions"`
 }
 
 // sample tenant types with different characteristics
-var tenantTypes = []struct {
-	name     string
-	userMin  int
-	userMax  int
-	sessions int
-}{
+var tenantTypes = []TenantConfig{
 	{"Global-Corp", 2000, 10000, 100},   // Very large enterprise
 	{"Enterprise-Corp", 1000, 5000, 50}, // large enterprise
 	{"MidMarket-Inc", 100, 500, 20},     // Mid-market company
@@ -51,70 +51,366 @@ var tenantTypes = []struct {
 	{"LocalShops-SME", 10, 50, 5},       // Small business
 }
 
-// sample activities for realistic data generation
-var activities = []string{
-	"login",
-	"logout",
-	"view_dashboard",
-	"create_document",
-	"edit_document",
-	"delete_document",
-	"upload_file",
-	"download_file",
-	"send_message",
-	"view_report",
-	"export_data",
-	"change_settings",
-	"invite_user",
-	"join_meeting",
-	"schedule_event",
+// sample activities for realistic data generation, weighted like real usage:
+// every session logs in and out, destructive and bulk actions are rare
+var weightedActivities = []ActivityWeight{
+	{"login", 20},
+	{"logout", 18},
+	{"view_dashboard", 15},
+	{"send_message", 10},
+	{"view_report", 8},
+	{"edit_document", 7},
+	{"create_document", 5},
+	{"download_file", 4},
+	{"upload_file", 3},
+	{"join_meeting", 3},
+	{"schedule_event", 2},
+	{"change_settings", 1},
+	{"invite_user", 1},
+	{"export_data", 0.5},
+	{"delete_document", 0.5},
 }
 
+// activities are the names of weightedActivities
+var activities = activityNames(weightedActivities)
+
 func main() {
-	// parse command line flags
-	var rowCount = flag.Int("rows", 10, "Number of rows to generate (default: 10)")
-	var endpoint = flag.String("endpoint", "", "Azure Cosmos DB endpoint URL")
-	var database = flag.String("database", "sampleDB", "Database name (default: sampleDB)")
-	var container = flag.String("container", "UserSessions", "Container name (default: Usersessions)")
-	flag.Parse()
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-	// get endpoint from env if not provided via flag
-	endpointURL := *endpoint
-	if endpointURL == "" {
-		endpointURL = os.Getenv("COSMOS_ENDPOINT")
-		if endpointURL == "" {
-			log.Fatal("Please provide Azure Cosmos DB endpoint via -endpoint flag or COSMOS_ENDPOINT environment variable")
+	// replace the built-in tenant types when a file is given
+	if config.TenantsFile != "" {
+		fileTenants, err := loadTenants(config.TenantsFile)
+		if err != nil {
+			log.Fatalf("Failed to load tenants: %v", err)
 		}
+		tenantTypes = fileTenants
 	}
 
-	config := Config{
-		Endpoint:      endpointURL,
-		DatabaseName:  *database,
-		ContainerName: *container,
-		RowCount:      *rowCount,
+	// the row count follows from the final tenant list
+	if config.RowsPerTenant > 0 {
+		config.RowCount = config.RowsPerTenant * len(tenantTypes)
+	}
+
+	// replace the built-in activities when a file is given
+	weightedActivities, err = activitiesFrom(config.ActivitiesFile)
+	if err != nil {
+		log.Fatalf("Failed to load activities: %v", err)
 	}
+	activities = activityNames(weightedActivities)
 
+	// sessions always start with login and end with logout, and the mass
+	// deletion anomaly writes delete_document whatever the activity list is
+	model.RegisterActivities(activities...)
+	model.RegisterActivities("login", "logout", "delete_document")
+
+	// weights refer to the final activity list so they are applied after the file
+	if config.ActivityWeights != "" {
+		weights, err := parseActivityWeights(config.ActivityWeights)
+		if err == nil {
+			err = setActivityWeights(weights)
+		}
+		if err != nil {
+			log.Fatalf("Invalid activity weights: %v", err)
+		}
+	}
+	if err := setActivityDistribution(weightedActivities); err != nil {
+		log.Fatalf("Invalid activity weights: %v", err)
+	}
+
+	// a template replaces the UserSession generator, check it before connecting
+	var documentTemplate *template.Template
+	if config.TemplateFile != "" {
+		documentTemplate, err = loadDocumentTemplate(config.TemplateFile)
+		if err != nil {
+			log.Fatalf("Invalid template: %v", err)
+		}
+		if config.TemplateCheck {
+			err = checkTemplate(documentTemplate, config.PKLevels)
+			if err != nil {
+				log.Fatalf("Template check failed: %v", err)
+			}
+			return
+		}
+	}
+
+	if config.IsEmulator() {
+		fmt.Printf("[EMULATOR MODE] local emulator endpoint detected, TLS verification is disabled\n")
+	}
 	fmt.Printf("Starting data load with configuration:\n")
-	fmt.Printf(" Endpoint: %s\n", config.Endpoint)
+	if len(config.Endpoints) > 1 {
+		fmt.Printf(" Endpoints: %s (writes in round robin order)\n", strings.Join(config.Endpoints, ", "))
+	} else {
+		fmt.Printf(" Endpoint: %s\n", config.Endpoint)
+	}
+	fmt.Printf(" Auth: %s\n", config.AuthMode)
 	fmt.Printf(" Database: %s\n", config.DatabaseName)
 	fmt.Printf(" Container: %s\n", config.ContainerName)
-	fmt.Printf(" Rows to generate: %d\n", config.RowCount)
+	if config.ApplicationRegion != "" {
+		fmt.Printf(" Application region: %s\n", config.ApplicationRegion)
+	}
+	if regions := config.Regions(); len(regions) > 0 {
+		fmt.Printf(" Preferred regions: %s\n", strings.Join(regions, ", "))
+	}
+	fmt.Printf(" SDK retries: %s\n", config.RetrySummary())
+	if config.HTTPProxy != "" {
+		fmt.Printf(" HTTP proxy: %s\n", config.RedactedProxy())
+	}
+	if config.UserAgentSuffix != "" {
+		fmt.Printf(" User agent suffix: %s\n", config.UserAgentSuffix)
+	}
+	if config.LoadTest {
+		fmt.Printf(" Load test: from %d records/sec with %d workers, retries disabled\n", config.StartRPS, config.Workers)
+	} else if config.Duration > 0 {
+		fmt.Printf(" Sustained load: %v at %d ops/sec\n", config.Duration, config.TargetOps)
+	} else {
+		fmt.Printf(" Rows to generate: %d\n", config.RowCount)
+		if config.RowsPerTenant > 0 {
+			fmt.Printf(" Rows per tenant: %d for each of %d tenants\n", config.RowsPerTenant, len(tenantTypes))
+		}
+	}
+	fmt.Printf(" Partition key levels: %d\n", config.PKLevels)
+	fmt.Printf(" Seed: %d\n", config.Seed)
+	if config.EncryptPII {
+		fmt.Printf(" PII encryption: userId and sessionId encrypted with AES-256-GCM\n")
+	}
+	if config.DeterministicIDs {
+		fmt.Printf(" Deterministic IDs: re-running with this seed today overwrites the same items\n")
+	}
+	fmt.Printf(" Write mode: %s\n", config.Mode)
+	if config.Duration == 0 && config.TemplateFile == "" {
+		fmt.Printf(" Workers: %d (buffer %d)\n", config.Workers, config.Buffer)
+		if config.ShardByTenant {
+			fmt.Printf(" Sharding writers by tenant\n")
+		}
+	}
+	if config.EventsMax > 1 {
+		fmt.Printf(" Events per session: %d..%d\n", config.EventsMin, config.EventsMax)
+	}
+	if config.HotTenant != "" {
+		fmt.Printf(" Hot tenant: %s (%.0f%% of records)\n", config.HotTenant, config.HotRatio*100)
+		if config.HotUser != "" {
+			fmt.Printf(" Hot user: %s\n", config.HotUser)
+		}
+	}
+	if config.AnomalyRate > 0 {
+		fmt.Printf(" Anomaly rate: %.2f%% of sessions\n", config.AnomalyRate*100)
+	}
+	if config.SkewFactor > 0 {
+		fmt.Printf(" Tenant skew factor: %.2f\n", config.SkewFactor)
+	}
+	if config.TenantsFile != "" {
+		fmt.Printf(" Tenants: %d loaded from %s\n", len(tenantTypes), config.TenantsFile)
+	}
+	if config.ActivitiesFile != "" {
+		fmt.Printf(" Activities: %d loaded from %s\n", len(activities), config.ActivitiesFile)
+	}
+	if config.ActivityWeights != "" {
+		fmt.Printf(" Activity weights: %s\n", config.ActivityWeights)
+	}
+	if config.TTL != 0 {
+		fmt.Printf(" Container TTL: %d seconds\n", config.TTL)
+	}
+	if config.IndexingPolicySource != "" {
+		fmt.Printf(" Indexing policy: %s\n", config.IndexingPolicySource)
+	}
+	if config.CompositeIndexes {
+		fmt.Printf(" Composite indexes: tenantId/timestamp and tenantId/userId/timestamp\n")
+	}
+	if config.WithProfiles {
+		if config.ProfilesContainer != "" {
+			fmt.Printf(" User profiles: container %s\n", config.ProfilesContainer)
+		} else {
+			fmt.Printf(" User profiles: same container (type %q)\n", model.ProfileType)
+		}
+	}
+	if config.TargetRUs > 0 {
+		fmt.Printf(" RU budget: %d RU/s\n", config.TargetRUs)
+	}
+	if config.PreLoadRUs > 0 {
+		fmt.Printf(" Pre-load throughput: %d RU/s (original value restored afterwards)\n", config.PreLoadRUs)
+	}
+	if config.RecordTTL != 0 {
+		fmt.Printf(" Record TTL: %d seconds\n", config.RecordTTL)
+	}
+	if config.TTLByAge > 0 {
+		fmt.Printf(" Record TTL: expire %d days after timestamp\n", config.TTLByAge)
+		// per-item ttl is ignored unless TTL is enabled on the container
+		if config.TTL == 0 {
+			fmt.Println(" Note: pass -ttl -1 to enable TTL on a new container without a default expiry")
+		}
+	}
+	if config.OutputDir != "" {
+		fmt.Printf(" Output: NDJSON files in %s, one per %s\n", config.OutputDir, config.SplitBy)
+	}
 	fmt.Println()
 
+	// generating to files needs no Cosmos DB account
+	if config.OutputDir != "" {
+		err = runExport(config)
+		if err != nil {
+			log.Fatalf("Failed to export sample data: %v", err)
+		}
+		fmt.Printf("Successfully wrote %d records to %s\n", config.RowCount, config.OutputDir)
+		return
+	}
+
 	// Initialize Azure Cosmos DB client
-	client, err := createCosmosClient(config.Endpoint)
+	client, err := createCosmosClient(config.Connection)
 	if err != nil {
 		log.Fatalf("Failed to create Cosmos DB client: %v", err)
 	}
 
+	// confirm which regional endpoint the region settings route to
+	if len(config.Regions()) > 0 {
+		host, err := config.ServingEndpoint(context.Background(), client)
+		if err != nil {
+			log.Fatalf("Connectivity check failed: %v", err)
+		}
+		fmt.Printf("Connectivity check: first request served by %s\n\n", host)
+	}
+
+	// preflight only checks connectivity and exits
+	if config.Ping {
+		err = runPreflight(client, config)
+		if err != nil {
+			log.Fatalf("Preflight failed: %v", err)
+		}
+		return
+	}
+
+	// scaling only changes the throughput of the existing container and exits
+	if config.Scale > 0 {
+		containerClient, err := client.NewContainer(config.DatabaseName, config.ContainerName)
+		if err != nil {
+			log.Fatalf("Failed to create container client: %v", err)
+		}
+		err = scaleThroughput(containerClient, config.Scale)
+		if err != nil {
+			log.Fatalf("Scaling failed: %v", err)
+		}
+		return
+	}
+
+	// erasure deletes one user's items from the existing container and exits
+	if config.EraseUser != "" {
+		containerClient, err := client.NewContainer(config.DatabaseName, config.ContainerName)
+		if err != nil {
+			log.Fatalf("Failed to create container client: %v", err)
+		}
+
+		// encrypted user IDs are stored as their deterministic ciphertext
+		userID := config.EraseUser
+		if config.EncryptPII {
+			cipher, err := pii.NewCipher(config.PIIKey)
+			if err != nil {
+				log.Fatalf("Invalid encryption key: %v", err)
+			}
+			userID = cipher.Encrypt(userID)
+		}
+
+		deleted, err := eraseUser(context.Background(), containerClient, userID)
+		fmt.Printf("Erased %d items of user %s\n", deleted, config.EraseUser)
+		if config.AuditLog != "" {
+			if auditErr := appendErasureAudit(config.AuditLog, config.EraseUser, deleted); auditErr != nil {
+				log.Printf("Failed to write audit log: %v", auditErr)
+			}
+		}
+		if err != nil {
+			log.Fatalf("Erasure failed: %v", err)
+		}
+		return
+	}
+
+	// purging deletes every item of the existing container and exits
+	if config.Purge {
+		containerClient, err := client.NewContainer(config.DatabaseName, config.ContainerName)
+		if err != nil {
+			log.Fatalf("Failed to create container client: %v", err)
+		}
+		err = purgeContainer(containerClient, config, newRULimiter(config.TargetRUs))
+		if err != nil {
+			log.Fatalf("Purge failed: %v", err)
+		}
+		fmt.Printf("Purged container %s, its throughput and indexing policy are unchanged\n", config.ContainerName)
+		return
+	}
+
 	// ensure database and container exists
-	containerClient, err := ensureDatabaseAndContainer(client, config.DatabaseName, config.ContainerName)
+	containerClient, err := ensureDatabaseAndContainer(client, config)
 	if err != nil {
 		log.Fatalf("Failed to ensure database and container exist: %v", err)
 	}
 
-	// generate and load sample data
-	err = loadSampleData(containerClient, config.RowCount)
+	// the write benchmark compares write strategies instead of loading
+	if config.BenchWrites > 0 {
+		err = runWriteBenchmark(containerClient, config)
+		if err != nil {
+			log.Fatalf("Write benchmark failed: %v", err)
+		}
+		return
+	}
+
+	// the concurrency demo writes and removes a single item instead of loading
+	if config.ConcurrencyDemo {
+		err = runConcurrencyDemo(containerClient, config)
+		if err != nil {
+			log.Fatalf("Concurrency demo failed: %v", err)
+		}
+		return
+	}
+
+	// the patch demo updates a single item instead of loading
+	if config.PatchDemo {
+		err = runPatchDemo(containerClient, config)
+		if err != nil {
+			log.Fatalf("Patch demo failed: %v", err)
+		}
+		return
+	}
+
+	// one RU budget is shared by every write of the load
+	limiter := newRULimiter(config.TargetRUs)
+
+	// profiles go to the sessions container unless a separate one is named
+	var profiles *profileTarget
+	if config.WithProfiles {
+		profiles, err = ensureProfileTarget(client, containerClient, config, limiter)
+		if err != nil {
+			log.Fatalf("Failed to prepare profiles container: %v", err)
+		}
+	}
+
+	stats, err := runLoad(containerClient, config, documentTemplate, profiles, limiter)
+	if config.Duration > 0 {
+		if err != nil {
+			log.Fatalf("Sustained load failed: %v", err)
+		}
+		return
+	}
+	if config.LoadTest {
+		if err != nil {
+			log.Fatalf("Load test failed: %v", err)
+		}
+		return
+	}
+
+	// metrics are written for failed runs too so the failure is visible to monitoring
+	if config.MetricsFile != "" && stats != nil {
+		if metricsErr := writeMetricsFile(config.MetricsFile, stats); metricsErr != nil {
+			log.Printf("Failed to write metrics: %v", metricsErr)
+		} else {
+			fmt.Printf("Wrote metrics to %s\n", config.MetricsFile)
+		}
+	}
+	if config.ReportDir != "" && stats != nil {
+		writeLoadReport(config, stats, err)
+	}
 	if err != nil {
 		log.Fatalf("Failed to load sample data: %v", err)
 	}
@@ -122,25 +418,122 @@ func main() {
 	fmt.Printf("Successfully loaded %d records into Azure Cosmos DB\n", config.RowCount)
 }
 
-// createCosmosClient creates and returns an Azrure Cosmos DB client
-func createCosmosClient(endpoint string) (*azcosmos.Client, error) {
+// runLoad runs the configured load, raising the container throughput to
+// config.PreLoadRUs first and restoring it afterwards when requested. Writes are
+// paced by limiter
+func runLoad(containerClient *azcosmos.ContainerClient, config Config, documentTemplate *template.Template, profiles *profileTarget, limiter *ruLimiter) (*loadStats, error) {
+	if config.PreLoadRUs > 0 {
+		restore, err := preScaleThroughput(context.Background(), containerClient, config.PreLoadRUs)
+		if err != nil {
+			return nil, err
+		}
+		defer restore()
+	}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	single := newContainerWriter(containerClient, config, limiter)
+	var writer ItemWriter = single
+	if len(config.Endpoints) > 1 {
+		multi, err := newMultiEndpointWriter(config, limiter)
+		if err != nil {
+			return nil, err
+		}
+		defer multi.printSummary()
+		writer = multi
+	}
+
+	// the load test ramps the rate until throttling instead of loading a row count
+	if config.LoadTest {
+		return nil, runLoadTest(writer, config)
+	}
+
+	// sustained load mode runs for a fixed duration instead of a fixed row count
+	if config.Duration > 0 {
+		return nil, runSustainedLoad(writer, config)
+	}
+
+	// generate and load sample data
+	if documentTemplate != nil {
+		return loadTemplateData(writer, config, documentTemplate)
+	}
+	if config.Bulk {
+		// -bulk cannot be combined with several -endpoints, so writer is single
+		return loadSampleDataBulk(single, writer, config)
+	}
+	return loadSampleData(writer, config, profiles)
+}
+
+// runExport generates the sample data into NDJSON files split by tenant or
+// user, then closes the files and lists them
+func runExport(config Config) error {
+	writer, err := newFileWriter(config.OutputDir, config.SplitBy)
+	if err != nil {
+		return err
+	}
+
+	stats, err := loadSampleData(writer, config, nil)
+	if closeErr := writer.close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	writer.printFiles()
+
+	if config.MetricsFile != "" && stats != nil {
+		if metricsErr := writeMetricsFile(config.MetricsFile, stats); metricsErr != nil {
+			log.Printf("Failed to write metrics: %v", metricsErr)
+		}
+	}
+	if config.ReportDir != "" && stats != nil {
+		writeLoadReport(config, stats, err)
+	}
+	return err
+}
+
+// writeLoadReport writes the -report-dir report, which like the metrics file
+// is written for failed runs too
+func writeLoadReport(config Config, stats *loadStats, loadErr error) {
+	path, err := writeReport(config.ReportDir, config, stats, loadErr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create credential: %w", err)
+		log.Printf("Failed to write report: %v", err)
+		return
 	}
+	fmt.Printf("Wrote report to %s\n", path)
+}
 
-	// create cosmos db client
-	client, err := azcosmos.NewClient(endpoint, cred, nil)
+// ensureProfileTarget returns where profiles are written. A separate profiles
+// container is created on demand and partitioned by /tenantId, /userId only
+func ensureProfileTarget(client *azcosmos.Client, containerClient *azcosmos.ContainerClient, config Config, limiter *ruLimiter) (*profileTarget, error) {
+	if config.ProfilesContainer == "" {
+		return &profileTarget{
+			writer:   newContainerWriter(containerClient, config, limiter),
+			pkLevels: config.PKLevels,
+			padded:   config.PKLevels == 3,
+		}, nil
+	}
+
+	profileConfig := config
+	profileConfig.ContainerName = config.ProfilesContainer
+	profileConfig.PKLevels = min(config.PKLevels, 2)
+	profileConfig.CreateTenantsContainer = false
+	profileClient, err := ensureDatabaseAndContainer(client, profileConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create client: %w", err)
+		return nil, err
 	}
-	return client, nil
+	return &profileTarget{
+		writer:   newContainerWriter(profileClient, config, limiter),
+		pkLevels: profileConfig.PKLevels,
+	}, nil
+}
+
+// createCosmosClient creates and returns an Azrure Cosmos DB client, authenticated
+// with the credential selected by -auth
+func createCosmosClient(connection config.Connection) (*azcosmos.Client, error) {
+	return connection.NewClient()
 }
 
 // ensureDatabaseAndContainer creates the database and container if they don't exist
-func ensureDatabaseAndContainer(client *azcosmos.Client, databaseName, containerName string) (*azcosmos.ContainerClient, error) {
+func ensureDatabaseAndContainer(client *azcosmos.Client, config Config) (*azcosmos.ContainerClient, error) {
 	ctx := context.Background()
+	databaseName := config.DatabaseName
+	containerName := config.ContainerName
 
 	fmt.Printf("Checking if database %s exists ...\n", databaseName)
 
@@ -167,29 +560,42 @@ func ensureDatabaseAndContainer(client *azcosmos.Client, databaseName, container
 		return nil, fmt.Errorf("failed to create database client: %w", err)
 	}
 
+	// the tenants reference container is used to demonstrate client side joins
+	if config.CreateTenantsContainer {
+		err = ensureTenantsContainer(ctx, databaseClient, config.TenantsContainer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	fmt.Printf("Checking if container %s exists...\n", containerName)
 
 	// Define hierarchical partition key definition
-	// this creates a 3-level hierarchy: /tennatId, /userId, /sessionId
-	partitionKeyDef := azcosmos.PartitionKeyDefinition{
-		Kind:    azcosmos.PartitionKeyKindMultiHash,
-		Version: 2, //ver 2 is required for hierarchical partition keys
-		Paths: []string{
-			"/tenantId",  // Level 1: Tenant isolation
-			"/userId",    // Level 2: User Distribution
-			"/sessionId", // Level 3: Session granularity
-		},
-	}
+	// with 3 levels this creates the hierarchy: /tenantId, /userId, /sessionId
+	partitionKeyDef := partitionKeyDefinition(config.PKLevels)
 
 	// create container properties
 	containerProperties := azcosmos.ContainerProperties{
 		ID:                     containerName,
 		PartitionKeyDefinition: partitionKeyDef,
 	}
+	if config.TTL != 0 {
+		defaultTTL := int32(config.TTL)
+		containerProperties.DefaultTimeToLive = &defaultTTL
+	}
+	if config.IndexingPolicy != nil {
+		containerProperties.IndexingPolicy = config.IndexingPolicy
+	}
 
 	// create container with 400 RU/s throughput
 	throughputProperties := azcosmos.NewManualThroughputProperties(400) // request unit/second
 
+	// get container client
+	containerClient, err := databaseClient.NewContainer(containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container client: %w", err)
+	}
+
 	_, err = databaseClient.CreateContainer(ctx, containerProperties, &azcosmos.CreateContainerOptions{
 		ThroughputProperties: &throughputProperties,
 	})
@@ -200,115 +606,482 @@ func ensureDatabaseAndContainer(client *azcosmos.Client, databaseName, container
 			return nil, fmt.Errorf("failed to create container: %w", err)
 		}
 		fmt.Printf("Container %s already exists\n", containerName)
+
+		// the existing container must route items the same way we write them
+		err = verifyPartitionKeyDefinition(containerClient, partitionKeyDef.Paths)
+		if err != nil {
+			if !config.Force {
+				return nil, fmt.Errorf("%w (use -force to proceed anyway)", err)
+			}
+			fmt.Printf("WARNING: %v, proceeding because of -force\n", err)
+		}
+
+		containerResponse, err := containerClient.Read(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read container properties: %w", err)
+		}
+
+		// bring the default TTL and indexing policy of the existing container in line with the flags
+		existingProperties := containerResponse.ContainerProperties
+		var updates []string
+		if config.TTL != 0 && (existingProperties.DefaultTimeToLive == nil || *existingProperties.DefaultTimeToLive != int32(config.TTL)) {
+			defaultTTL := int32(config.TTL)
+			existingProperties.DefaultTimeToLive = &defaultTTL
+			updates = append(updates, fmt.Sprintf("default TTL %d seconds", config.TTL))
+		}
+		if config.IndexingPolicy != nil && !sameIndexingPolicy(existingProperties.IndexingPolicy, config.IndexingPolicy) {
+			existingProperties.IndexingPolicy = config.IndexingPolicy
+			updates = append(updates, "indexing policy")
+		}
+		if len(updates) > 0 {
+			_, err = containerClient.Replace(ctx, *existingProperties, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update container: %w", err)
+			}
+			fmt.Printf("Updated container %s: %s\n", containerName, strings.Join(updates, ", "))
+		}
 	} else {
 		fmt.Printf("Created container %s with heirarchical partition keys:\n", containerName)
-		fmt.Printf(" Level 1:/ tenantId\n")
-		fmt.Printf(" Level 2:/ userId\n")
-		fmt.Printf(" Level 3:/ sessionId\n")
+		for i, path := range partitionKeyDef.Paths {
+			fmt.Printf(" Level %d: %s\n", i+1, path)
+		}
 	}
 
-	// get container client
-	containerClient, err := databaseClient.NewContainer(containerName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create container client: %w", err)
+	return containerClient, nil
+}
+
+// writeItem writes a single item according to the write mode
+func writeItem(ctx context.Context, writer ItemWriter, mode string, partitionKey azcosmos.PartitionKey, item []byte) (float64, error) {
+	if mode == "replace" {
+		// replace the record using ReplaceItem, a missing id is a 404 rather than an insert
+		var doc struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(item, &doc); err != nil || doc.ID == "" {
+			return 0, fmt.Errorf("record has no id to replace")
+		}
+		return writer.Replace(ctx, partitionKey, doc.ID, item)
+	}
+	if mode == "insert" {
+		// insert the record using CreateItem, an existing id is a conflict rather than an overwrite
+		return writer.Create(ctx, partitionKey, item)
 	}
 
-	return containerClient, nil
+	// insert the record using UpsertItem (insert or update if exists)
+	return writer.Upsert(ctx, partitionKey, item)
 }
 
-// loadSampleData generates and inserts sampler userSession records
-func loadSampleData(containerClient *azcosmos.ContainerClient, rowCount int) error {
-	ctx := context.Background()
+// statusCode returns the HTTP status code of a Cosmos DB error, or 0 if err is not a response error
+func statusCode(err error) int {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode
+	}
+	return 0
+}
 
-	fmt.Printf("Generating %d sample records...\n", rowCount)
+// partitionKeyDefinition returns the partition key definition for the given number of levels
+func partitionKeyDefinition(pkLevels int) azcosmos.PartitionKeyDefinition {
+	if pkLevels == 1 {
+		// a single path is a plain hash partition key
+		return azcosmos.PartitionKeyDefinition{
+			Kind:    azcosmos.PartitionKeyKindHash,
+			Version: 2,
+			Paths:   partitionKeyPaths[:1],
+		}
+	}
 
-	successCount := 0
-	errorCount := 0
+	return azcosmos.PartitionKeyDefinition{
+		Kind:    azcosmos.PartitionKeyKindMultiHash,
+		Version: 2, //ver 2 is required for hierarchical partition keys
+		Paths:   partitionKeyPaths[:pkLevels],
+	}
+}
 
-	for i := range rowCount {
-		// generate a sample UserSession record
-		session := generateUserSession()
+// verifyPartitionKeyDefinition reads the container properties and checks that the
+// container is partitioned on exactly the expected paths, with the kind and version
+// partitionKeyDefinition would use for them
+func verifyPartitionKeyDefinition(containerClient *azcosmos.ContainerClient, expected []string) error {
+	containerResponse, err := containerClient.Read(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to read container properties: %w", err)
+	}
 
-		//convert to json
-		sessionJSON, err := json.Marshal(session)
-		if err != nil {
-			log.Printf("Failed to marshal session %d: %v", i+1, err)
-			errorCount++
-			continue
+	existingDef := containerResponse.ContainerProperties.PartitionKeyDefinition
+	expectedDef := partitionKeyDefinition(len(expected))
+	expectedDef.Paths = expected
+	if samePartitionKeyDefinition(existingDef, expectedDef) {
+		return nil
+	}
+
+	var mismatches []string
+	for i := range max(len(existingDef.Paths), len(expected)) {
+		existingPath, expectedPath := "(none)", "(none)"
+		if i < len(existingDef.Paths) {
+			existingPath = existingDef.Paths[i]
+		}
+		if i < len(expected) {
+			expectedPath = expected[i]
 		}
+		if existingPath != expectedPath {
+			mismatches = append(mismatches, fmt.Sprintf("level %d: container has %s, expected %s", i+1, existingPath, expectedPath))
+		}
+	}
+	if len(mismatches) == 0 {
+		mismatches = append(mismatches, "paths match but kind or version differ")
+	}
 
-		// create hierarchical partition key (TenantID, UserID, SessionID)
-		partitionKey := azcosmos.NewPartitionKeyString(session.TenantID).AppendString(session.UserID).AppendString(session.SessionID)
+	return fmt.Errorf("container %s partition key definition does not match:\n %s\n existing: %s\n expected: %s",
+		containerClient.ID(), strings.Join(mismatches, "\n "), describePartitionKeyDefinition(existingDef), describePartitionKeyDefinition(expectedDef))
+}
 
-		// insert the record using UpsertItem (insert or update if exists)
-		_, err = containerClient.UpsertItem(ctx, partitionKey, sessionJSON, nil)
-		if err != nil {
-			log.Printf("Failed to insert session %d: %v", i+1, err)
-			errorCount++
-			continue
-		}
+// samePartitionKeyDefinition reports whether two partition key definitions have the same kind, version and paths
+func samePartitionKeyDefinition(a, b azcosmos.PartitionKeyDefinition) bool {
+	// an unset version on an existing container means version 1
+	aVersion, bVersion := a.Version, b.Version
+	if aVersion == 0 {
+		aVersion = 1
+	}
+	if bVersion == 0 {
+		bVersion = 1
+	}
 
-		successCount++
+	return a.Kind == b.Kind && aVersion == bVersion && slices.Equal(a.Paths, b.Paths)
+}
 
-		// progress indicator
-		if (i+1)%10 == 0 || i+1 == rowCount {
-			fmt.Printf(" Progress: %d/%d records processed\n", i+1, rowCount)
-		}
+// describePartitionKeyDefinition formats a partition key definition for error messages
+func describePartitionKeyDefinition(def azcosmos.PartitionKeyDefinition) string {
+	return fmt.Sprintf("kind=%s version=%d paths=%v", def.Kind, def.Version, def.Paths)
+}
+
+// buildPartitionKey creates the partition key for a session using the first pkLevels components
+func buildPartitionKey(session UserSession, pkLevels int) azcosmos.PartitionKey {
+	partitionKey := azcosmos.NewPartitionKeyString(session.TenantID)
+	if pkLevels >= 2 {
+		partitionKey = partitionKey.AppendString(session.UserID)
+	}
+	if pkLevels >= 3 {
+		partitionKey = partitionKey.AppendString(session.SessionID)
+	}
+	return partitionKey
+}
+
+// maximum length of a single activity name read from an activities file
+const maxActivityLength = 64
+
+// activitiesFrom returns the activities of the file at path, or the built-in
+// weightedActivities when path is empty
+func activitiesFrom(path string) ([]ActivityWeight, error) {
+	if path == "" {
+		return weightedActivities, nil
+	}
+	return loadActivities(path)
+}
+
+// loadActivities reads a JSON array of activities from path. An entry is an
+// activity name, weighing 1, or an object with a name and a weight
+func loadActivities(path string) ([]ActivityWeight, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read activities file: %w", err)
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse activities file %s: %w", path, err)
 	}
 
-	fmt.Printf("\n📊 Load Summary:\n")
-	fmt.Printf(" Successful inserts: %d\n", successCount)
-	if errorCount > 0 {
-		fmt.Printf(" Failed inserts: %d\n", errorCount)
-		return fmt.Errorf("completed with %d errors out of %d total records", errorCount, rowCount)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("activities file %s must contain at least one activity", path)
+	}
+	fileActivities := make([]ActivityWeight, 0, len(entries))
+	for i, entry := range entries {
+		activity := ActivityWeight{Weight: 1}
+		if err := json.Unmarshal(entry, &activity.Name); err != nil {
+			var weighted struct {
+				Name   string   `json:"name"`
+				Weight *float64 `json:"weight"`
+			}
+			if err := json.Unmarshal(entry, &weighted); err != nil {
+				return nil, fmt.Errorf("activities file %s: entry %d must be a name or an object with name and weight", path, i)
+			}
+			activity.Name = weighted.Name
+			if weighted.Weight != nil {
+				activity.Weight = *weighted.Weight
+			}
+		}
+		if activity.Name == "" {
+			return nil, fmt.Errorf("activities file %s: entry %d is empty", path, i)
+		}
+		if len(activity.Name) > maxActivityLength {
+			return nil, fmt.Errorf("activities file %s: entry %d %q exceeds %d characters", path, i, activity.Name, maxActivityLength)
+		}
+		if activity.Weight < 0 {
+			return nil, fmt.Errorf("activities file %s: entry %d %q has a negative weight", path, i, activity.Name)
+		}
+		fileActivities = append(fileActivities, activity)
 	}
-	return nil
+
+	return fileActivities, nil
 }
 
-// generateUserSession creates a realistic UserSessoin record with hierarchical partition key
-func generateUserSession() UserSession {
-	// select a random tenant type
-	tenant := tenantTypes[rand.Intn(len(tenantTypes))]
+// loadTenants reads a JSON array of TenantConfig from path
+func loadTenants(path string) ([]TenantConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+
+	var fileTenants []TenantConfig
+	if err := json.Unmarshal(data, &fileTenants); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file %s: %w", path, err)
+	}
+
+	if len(fileTenants) == 0 {
+		return nil, fmt.Errorf("tenants file %s must contain at least one tenant", path)
+	}
+	for i, tenant := range fileTenants {
+		if tenant.Name == "" {
+			return nil, fmt.Errorf("tenants file %s: entry %d has an empty name", path, i)
+		}
+		if tenant.UserMin > tenant.UserMax {
+			return nil, fmt.Errorf("tenants file %s: entry %d (%s) has userMin %d greater than userMax %d", path, i, tenant.Name, tenant.UserMin, tenant.UserMax)
+		}
+		if tenant.Sessions <= 0 {
+			return nil, fmt.Errorf("tenants file %s: entry %d (%s) must have sessions > 0, got %d", path, i, tenant.Name, tenant.Sessions)
+		}
+	}
+
+	return fileTenants, nil
+}
 
+// generateUserSession creates a realistic UserSessoin record with hierarchical partition key,
+// drawing every random choice from rng. Timestamps fall within the 30 days before now
+func generateUserSession(rng *rand.Rand, tenant TenantConfig, now time.Time) UserSession {
 	// generate user ID within the tenant's user range
-	userNum := rand.Intn(tenant.userMax-tenant.userMin+1) + tenant.userMin
+	userNum := rng.Intn(tenant.UserMax-tenant.UserMin+1) + tenant.UserMin
 	userID := fmt.Sprintf("user-%d", userNum)
 
 	// generate session id
 	sessionID := fmt.Sprintf("session-%s", uuid.New().String()[:8]) // e.g output session-b08fa8a4
 
 	// select random activity
-	activity := activities[rand.Intn(len(activities))]
+	activity := weightedRandomActivity(rng)
 
 	// generate timestamp within the last 30 days
-	now := time.Now()
-	daysAgo := rand.Intn(30)
-	hoursAgo := rand.Intn(24)
-	minutesAgo := rand.Intn(60)
+	daysAgo := rng.Intn(30)
+	hoursAgo := rng.Intn(24)
+	minutesAgo := rng.Intn(60)
 	timestamp := now.AddDate(0, 0, -daysAgo).Add(-time.Duration(hoursAgo) * time.Hour).Add(-time.Duration(minutesAgo) * time.Minute)
 
-	return UserSession{
-		ID:        uuid.NewString(),
-		TenantID:  tenant.name,
-		UserID:    userID,
-		SessionID: sessionID,
-		Activity:  activity,
-		Timestamp: timestamp,
+	session := UserSession{
+		ID:            uuid.NewString(),
+		TenantID:      tenant.Name,
+		UserID:        userID,
+		SessionID:     sessionID,
+		Activity:      activity,
+		Timestamp:     timestamp,
+		SchemaVersion: model.SchemaVersion,
+	}
+	assignClientAttributes(rng, &session)
+	return session
+}
+
+// sessionGenerator hands out generated records one at a time, keeping the
+// records of a multi-event session together
+type sessionGenerator struct {
+	config    Config
+	now       func() time.Time
+	rng       *rand.Rand
+	tenants   *tenantSelector
+	pending   []UserSession
+	generated int            // records handed out, picks the tenant with -rows-per-tenant
+	anomalies map[string]int // injected anomalous sessions per type
+	pii       *pii.Cipher    // encrypts userId and sessionId, nil without -encrypt-pii
+	users     *userPool      // users kept stable across runs, nil without -user-pool
+}
+
+// newSessionGenerator creates a generator drawing tenants from tenantTypes. The
+// same config.Seed produces the same sequence of tenants, users and activities
+func newSessionGenerator(config Config) (*sessionGenerator, error) {
+	rng := rand.New(rand.NewSource(config.Seed))
+	tenants := newTenantSelector(rng, tenantTypes, config.SkewFactor)
+	if config.HotTenant != "" {
+		if err := tenants.setHotTenant(config.HotTenant, config.HotRatio); err != nil {
+			return nil, fmt.Errorf("invalid -hot-tenant: %w", err)
+		}
+	}
+
+	// timestamps are stored in UTC, the query tool compares them as strings
+	// against a UTC cutoff. Deterministic IDs hash the timestamps, so they are
+	// anchored to the start of the day instead of the current time
+	now := func() time.Time { return time.Now().UTC() }
+	if config.DeterministicIDs {
+		day := time.Now().UTC().Truncate(24 * time.Hour)
+		now = func() time.Time { return day }
+	}
+
+	generator := &sessionGenerator{
+		config:    config,
+		now:       now,
+		rng:       rng,
+		tenants:   tenants,
+		anomalies: make(map[string]int),
+	}
+	if config.EncryptPII {
+		var err error
+		generator.pii, err = pii.NewCipher(config.PIIKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -encryption-key: %w", err)
+		}
+	}
+	if config.UserPool != "" {
+		var err error
+		generator.users, err = loadUserPool(config.UserPool, config.GrowUsers, tenantTypes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return generator, nil
+}
+
+// skip generates and discards n records
+func (g *sessionGenerator) skip(n int) {
+	for range n {
+		g.next()
 	}
 }
 
-func getEndpointFlagorEnv(flagName, envVar, usage string) string {
-	flagValue := flag.String(flagName, "", usage)
-	flag.Parse()
+// next returns the next generated record
+func (g *sessionGenerator) next() UserSession {
+	if len(g.pending) == 0 {
+		eventCount := g.config.EventsMin + g.rng.Intn(g.config.EventsMax-g.config.EventsMin+1)
+		tenant := g.tenants.pick()
+		if g.config.RowsPerTenant > 0 {
+			tenant = tenantTypes[(g.generated/g.config.RowsPerTenant)%len(tenantTypes)]
+		}
+		g.pending = generateSessionEvents(g.rng, eventCount, tenant, g.now())
+		if g.users != nil {
+			g.users.assign(g.rng, tenant.Name, g.pending)
+		}
+
+		// pin the hot tenant's sessions to a single user when asked to
+		if g.config.HotUser != "" && g.tenants.isHot(tenant) {
+			for i := range g.pending {
+				g.pending[i].UserID = g.config.HotUser
+			}
+		}
+
+		if g.config.AnomalyRate > 0 && g.rng.Float64() < g.config.AnomalyRate {
+			var kind string
+			g.pending, kind = injectAnomaly(g.rng, g.pending)
+			g.anomalies[kind]++
+		}
 
-	if *flagValue != "" {
-		return *flagValue
+		// a session never spills over into the rows of the next tenant
+		if g.config.RowsPerTenant > 0 {
+			remaining := g.config.RowsPerTenant - g.generated%g.config.RowsPerTenant
+			g.pending = g.pending[:min(len(g.pending), remaining)]
+		}
+
+		if g.config.DeterministicIDs {
+			assignDeterministicIDs(g.pending)
+		}
+
+		// encryption is deterministic, so every event of the session still
+		// shares one encrypted partition key
+		if g.pii != nil {
+			for i := range g.pending {
+				g.pending[i].UserID = g.pii.Encrypt(g.pending[i].UserID)
+				g.pending[i].SessionID = g.pii.Encrypt(g.pending[i].SessionID)
+			}
+		}
 	}
 
-	if envValue := os.Getenv(envVar); envValue != "" {
-		return envValue
+	session := g.pending[0]
+	g.pending = g.pending[1:]
+	g.generated++
+	session.TTL = g.config.RecordTTL
+	if g.config.TTLByAge > 0 {
+		session.TTL = ttlByAge(session.Timestamp, g.now(), g.config.TTLByAge)
+	}
+	return session
+}
+
+// generateSessionEvents creates eventCount records sharing one tenantId/userId/sessionId
+// with increasing timestamps. Sessions with more than one event start with "login",
+// end with "logout" and chain realistic actions in between
+func generateSessionEvents(rng *rand.Rand, eventCount int, tenant TenantConfig, now time.Time) []UserSession {
+	first := generateUserSession(rng, tenant, now)
+	if eventCount <= 1 {
+		return []UserSession{first}
+	}
+
+	events := make([]UserSession, eventCount)
+	timestamp := first.Timestamp
+	for i := range events {
+		event := first
+		event.ID = uuid.NewString()
+		event.Timestamp = timestamp
+
+		switch i {
+		case 0:
+			event.Activity = "login"
+		case eventCount - 1:
+			event.Activity = "logout"
+		default:
+			event.Activity = pickSessionAction(rng, events[i-1].Activity)
+		}
+		events[i] = event
+
+		// next event happens between 1 and 10 minutes later
+		timestamp = timestamp.Add(time.Duration(rng.Intn(10)+1) * time.Minute)
+	}
+
+	// shift the whole session back if it would end in the future
+	if overshoot := events[eventCount-1].Timestamp.Sub(now); overshoot > 0 {
+		for i := range events {
+			events[i].Timestamp = events[i].Timestamp.Add(-overshoot)
+		}
+	}
+
+	return events
+}
+
+// assignDeterministicIDs replaces the random IDs of the events of one session
+// with IDs derived from their content. The session ID hashes the tenant, user
+// and start time, every item ID is a UUID v5 of its fields, so the same seed
+// yields the same IDs and a re-run overwrites instead of duplicating
+func assignDeterministicIDs(events []UserSession) {
+	first := events[0]
+	sessionUUID := uuid.NewSHA1(uuid.NameSpaceURL, []byte(first.TenantID+"/"+first.UserID+"/"+first.Timestamp.String()))
+	sessionID := fmt.Sprintf("session-%s", sessionUUID.String()[:8])
+
+	for i := range events {
+		event := &events[i]
+		event.SessionID = sessionID
+		event.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte(event.TenantID+event.UserID+event.SessionID+event.Activity+event.Timestamp.String())).String()
+	}
+}
+
+// parseRange parses "N" or "min..max" into its bounds
+func parseRange(value string) (int, int, error) {
+	minText, maxText, found := strings.Cut(value, "..")
+	if !found {
+		maxText = minText
+	}
+
+	minValue, err := strconv.Atoi(strings.TrimSpace(minText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range start %q: %w", minText, err)
+	}
+	maxValue, err := strconv.Atoi(strings.TrimSpace(maxText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range end %q: %w", maxText, err)
+	}
+	if minValue > maxValue {
+		return 0, 0, fmt.Errorf("range start %d is greater than end %d", minValue, maxValue)
 	}
 
-	log.Fatal("Missing required endpoint. Provide it via -%s flag or %s environment variable.", flagName, envVar)
-	return ""
+	return minValue, maxValue, nil
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+)
+
+func TestMain(m *testing.M) {
+	// the tests check the counters, the per record log lines are only noise
+	log.SetOutput(io.Discard)
+
+	// main registers the activities and their weights before generating
+	model.RegisterActivities(activities...)
+	model.RegisterActivities("login", "logout", "delete_document")
+	if err := setActivityDistribution(weightedActivities); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// testConfig parses args on top of the connection settings every load needs,
+// with a fixed seed and no progress output
+func testConfig(t testing.TB, args ...string) Config {
+	t.Helper()
+	base := []string{"-endpoint", "https://localhost:8081", "-database", "test", "-container", "test", "-quiet", "-seed", "1"}
+	config, err := loadConfig(append(base, args...))
+	if err != nil {
+		t.Fatalf("loadConfig(%v) = %v", args, err)
+	}
+	return config
+}
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t testing.TB, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
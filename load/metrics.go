@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeMetricsFile writes the load results in the Prometheus text exposition
+// format. The file is written to a temporary name and renamed so a scraper
+// never reads a partial file
+func writeMetricsFile(path string, stats *loadStats) error {
+	var b strings.Builder
+
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, kind)
+		fmt.Fprintf(&b, "%s %g\n", name, value)
+	}
+	metric("cosmos_load_success_total", "counter", "Records written successfully.", float64(stats.success))
+	metric("cosmos_load_errors_total", "counter", "Records that failed to write.", float64(stats.errors))
+	metric("cosmos_load_ru_total", "counter", "Request units consumed by the load.", stats.charge.Total())
+	metric("cosmos_load_duration_seconds", "gauge", "Wall clock duration of the load.", stats.elapsed.Seconds())
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".metrics-*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move metrics file into place: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// runPatchDemo compares a partial update with a full replace of the same item.
+// The item is the first record the generator produces, so with -seed and
+// -deterministic-ids it is an item an earlier load already wrote. A missing
+// item fails the demo unless -upsert-on-missing creates it first. With
+// -if-match the patch only applies while the item still has that ETag
+func runPatchDemo(containerClient *azcosmos.ContainerClient, config Config) error {
+	ctx := context.Background()
+
+	generator, err := newSessionGenerator(config)
+	if err != nil {
+		return err
+	}
+	session := generator.next()
+	partitionKey := buildPartitionKey(session, config.PKLevels)
+
+	fmt.Printf("Patch demo on item %s\n", session.ID)
+	fmt.Printf(" Partition key: %s / %s / %s\n", session.TenantID, session.UserID, session.SessionID)
+
+	// set the activity and add a view counter, addressed by id and the full key
+	patch := azcosmos.PatchOperations{}
+	patch.AppendSet("/activity", "view_report")
+	patch.AppendAdd("/viewCount", 1)
+
+	var patchOptions *azcosmos.ItemOptions
+	if config.IfMatch != "" {
+		patchOptions = ifMatch(azcore.ETag(config.IfMatch))
+	}
+
+	patchResponse, err := containerClient.PatchItem(ctx, partitionKey, session.ID, patch, patchOptions)
+	if statusCode(err) == 404 {
+		if !config.UpsertOnMissing {
+			return fmt.Errorf("item %s does not exist, load it first with the same -seed and -deterministic-ids or pass -upsert-on-missing", session.ID)
+		}
+		body, err := json.Marshal(session)
+		if err != nil {
+			return fmt.Errorf("failed to marshal session: %w", err)
+		}
+		createResponse, err := containerClient.CreateItem(ctx, partitionKey, body, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create missing item: %w", err)
+		}
+		fmt.Printf(" Item was missing, created it (RU %.2f)\n", createResponse.RequestCharge)
+
+		patchResponse, err = containerClient.PatchItem(ctx, partitionKey, session.ID, patch, patchOptions)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to patch item: %w", preconditionError(session.ID, azcore.ETag(config.IfMatch), err))
+	}
+	fmt.Printf(" Patch set /activity, add /viewCount: RU %.2f, ETag %s\n", patchResponse.RequestCharge, patchResponse.ETag)
+
+	// the same change as a full replace needs the whole document, conditioned
+	// on the ETag it was read with so a concurrent write is not overwritten
+	readResponse, err := containerClient.ReadItem(ctx, partitionKey, session.ID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read item: %w", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(readResponse.Value, &doc); err != nil {
+		return fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+	doc["activity"] = "view_report"
+	doc["viewCount"] = 1
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item: %w", err)
+	}
+	replaceResponse, err := containerClient.ReplaceItem(ctx, partitionKey, session.ID, body, ifMatch(readResponse.ETag))
+	if err != nil {
+		return fmt.Errorf("failed to replace item: %w", preconditionError(session.ID, readResponse.ETag, err))
+	}
+	fmt.Printf(" Read for replace: RU %.2f\n", readResponse.RequestCharge)
+	fmt.Printf(" Full replace: RU %.2f\n", replaceResponse.RequestCharge)
+
+	saved := replaceResponse.RequestCharge + readResponse.RequestCharge - patchResponse.RequestCharge
+	fmt.Printf(" Patch saved %.2f RU against read + replace\n", saved)
+	return nil
+}
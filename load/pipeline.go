@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// record is one generated session queued for the writers
+type record struct {
+	index   int
+	session UserSession
+}
+
+// workerStats holds the counters of one writer goroutine, it is only touched
+// by its own worker until the load finishes
+type workerStats struct {
+	records int
+	charge  float64
+	tenants map[string]bool
+}
+
+// loadRun holds the state shared by the generator and the writers of one load
+type loadRun struct {
+	config     Config
+	writer     ItemWriter
+	stats      *loadStats
+	progress   *progress
+	checkpoint *checkpointer  // nil without -checkpoint-file
+	profiles   *profileTarget // nil without -with-profiles
+	users      userSet        // users whose profile was written
+	cancel     context.CancelCauseFunc
+}
+
+// loadSampleData generates config.RowCount records on a single goroutine and
+// writes them with config.Workers writer goroutines. The bounded channel
+// between them keeps generation from running ahead of the writers. Once the
+// run is cancelled the writers keep draining the channel so every generated
+// record is counted exactly once. With config.ShardByTenant every worker gets
+// its own channel and only receives the tenants that hash to it, so records
+// of a tenant are written in the order they were generated. A resumed run
+// regenerates and skips the first config.ResumeFrom records. When profiles is
+// set the first session of every user also writes that user's profile
+func loadSampleData(writer ItemWriter, config Config, profiles *profileTarget) (*loadStats, error) {
+	ctx, stop := runContext(config)
+	defer stop()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	remaining := config.RowCount - config.ResumeFrom
+	if config.ResumeFrom > 0 {
+		fmt.Printf("Resuming after %d completed records, generating the remaining %d with %d workers...\n", config.ResumeFrom, remaining, config.Workers)
+	} else {
+		fmt.Printf("Generating %d sample records with %d workers...\n", config.RowCount, config.Workers)
+	}
+
+	run := &loadRun{
+		config:   config,
+		writer:   writer,
+		stats:    &loadStats{total: remaining, mode: config.Mode},
+		progress: newProgress(remaining, config.Quiet),
+		profiles: profiles,
+		cancel:   cancel,
+	}
+	if config.CheckpointFile != "" {
+		run.checkpoint = newCheckpointer(config.CheckpointFile, config.Seed, config.RowCount, config.ResumeFrom)
+	}
+	stats := run.stats
+	start := time.Now()
+
+	generator, err := newSessionGenerator(config)
+	if err != nil {
+		return nil, err
+	}
+
+	run.progress.begin()
+
+	queues := make([]chan record, 1)
+	if config.ShardByTenant {
+		queues = make([]chan record, config.Workers)
+	}
+	for i := range queues {
+		queues[i] = make(chan record, config.Buffer)
+	}
+
+	generator.skip(config.ResumeFrom)
+	go run.produce(ctx, queues, generator)
+
+	workers := make([]workerStats, config.Workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run.consume(ctx, queues[i%len(queues)], &workers[i])
+		}()
+	}
+	wg.Wait()
+
+	run.progress.end()
+	stats.elapsed = time.Since(start)
+
+	if run.checkpoint != nil {
+		if err := run.checkpoint.save(); err != nil {
+			log.Printf("Failed to save checkpoint: %v", err)
+		} else {
+			fmt.Printf("Checkpoint: %d of %d records completed, saved to %s\n", run.checkpoint.completed(), config.RowCount, config.CheckpointFile)
+		}
+	}
+
+	stats.printSummary()
+	stats.printFailures()
+	generator.saveUserPool()
+	if config.ShardByTenant {
+		printWorkerThroughput(workers, stats.elapsed)
+	}
+	if config.AnomalyRate > 0 {
+		printAnomalies(generator.anomalies)
+	}
+	if config.TTLByAge > 0 {
+		printTTLBuckets(stats.ttlBuckets, config.TTLByAge)
+	}
+	// a hot tenant is only visible next to the other tenants
+	if config.PrintDistribution || config.HotTenant != "" {
+		generator.tenants.printDistribution(stats.generated, stats.tenants)
+	}
+	if err := context.Cause(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return stats, fmt.Errorf("interrupted after %d of %d records", stats.generated, stats.total)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return stats, fmt.Errorf("-deadline reached after %d of %d records", stats.generated, stats.total)
+		}
+		return stats, err
+	}
+	return stats, stats.err()
+}
+
+// produce sends the remaining generated records to the queues and closes them.
+// With more than one queue a record goes to the queue its tenant hashes to. It
+// stops early when ctx is cancelled; only records that were handed to a writer
+// are counted as generated
+func (r *loadRun) produce(ctx context.Context, queues []chan record, generator *sessionGenerator) {
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+	for i := r.config.ResumeFrom; i < r.config.RowCount; i++ {
+		session := generator.next()
+		out := queues[tenantShard(session.TenantID, len(queues))]
+		select {
+		case out <- record{index: i, session: session}:
+			r.stats.record(outcomeGenerated, 0)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// consume validates and writes records until in is closed. After ctx is
+// cancelled the remaining records are drained and counted as cancelled
+func (r *loadRun) consume(ctx context.Context, in <-chan record, worker *workerStats) {
+	worker.tenants = make(map[string]bool)
+	for rec := range in {
+		if ctx.Err() != nil {
+			r.stats.record(outcomeCancelled, 0)
+			continue
+		}
+		outcome, charge := r.write(ctx, rec)
+		r.stats.record(outcome, charge)
+		worker.records++
+		worker.charge += charge
+		worker.tenants[rec.session.TenantID] = true
+		if outcome == outcomeSuccess {
+			r.stats.countTenant(rec.session.TenantID)
+			if r.config.TTLByAge > 0 {
+				r.stats.countTTL(rec.session.TTL)
+			}
+			if r.profiles != nil && r.users.claim(rec.session.TenantID, rec.session.UserID) {
+				profileCharge, err := writeProfile(ctx, r.profiles, rec.session)
+				if err != nil {
+					log.Printf("Failed to write profile of %s/%s: %v", rec.session.TenantID, rec.session.UserID, err)
+				}
+				r.stats.recordProfile(err == nil, profileCharge)
+				charge += profileCharge
+			}
+		}
+		if r.checkpoint != nil && (outcome == outcomeSuccess || outcome == outcomeSkipped || outcome == outcomeNotFound || outcome == outcomeInvalid) {
+			if err := r.checkpoint.complete(rec.index); err != nil {
+				log.Printf("Failed to save checkpoint: %v", err)
+			}
+		}
+		r.progress.add(1, charge)
+	}
+}
+
+// write writes a single record and reports how it ended
+func (r *loadRun) write(ctx context.Context, rec record) (outcome, float64) {
+	config := r.config
+
+	// catch partition key values Cosmos DB would reject before sending them
+	if err := validatePartitionKey(rec.session, config.PKLevels); err != nil {
+		if config.Strict {
+			r.cancel(fmt.Errorf("record %d: %w", rec.index+1, err))
+			return outcomeCancelled, 0
+		}
+		log.Printf("Skipping session %d: %v", rec.index+1, err)
+		return outcomeInvalid, 0
+	}
+
+	if config.TTLByAge > 0 {
+		if err := validateTTL(rec.session.TTL); err != nil {
+			log.Printf("Skipping session %d: %v", rec.index+1, err)
+			return outcomeInvalid, 0
+		}
+	}
+
+	if err := rec.session.Validate(); err != nil {
+		if config.Strict {
+			r.cancel(fmt.Errorf("record %d: %w", rec.index+1, err))
+			return outcomeCancelled, 0
+		}
+		log.Printf("Skipping session %d: %v", rec.index+1, err)
+		return outcomeRejected, 0
+	}
+
+	//convert to json
+	sessionJSON, err := json.Marshal(rec.session)
+	if err != nil {
+		log.Printf("Failed to marshal session %d: %v", rec.index+1, err)
+		return outcomeError, 0
+	}
+
+	// an oversized item would only come back as a 400 after the round trip
+	if err := checkDocumentSize(sessionJSON); err != nil {
+		log.Printf("Skipping session %d (id %s): %v", rec.index+1, rec.session.ID, err)
+		return outcomeOversized, 0
+	}
+
+	// create hierarchical partition key (TenantID, UserID, SessionID) up to the configured level
+	partitionKey := buildPartitionKey(rec.session, config.PKLevels)
+
+	charge, err := writeItem(ctx, r.writer, config.Mode, partitionKey, sessionJSON)
+	if config.OnConflict == "retry-new-id" && statusCode(err) == 409 && !isUniqueKeyConflict(err) {
+		var retryCharge float64
+		retryCharge, err = createWithNewIDs(ctx, r.writer, partitionKey, &rec.session)
+		charge += retryCharge
+		if err == nil {
+			r.stats.countNewID()
+		}
+	}
+	if o, ok := classifyConflict(config, err); ok {
+		if o != outcomeSkipped {
+			r.stats.recordFailure("Conflict inserting", rec, statusCode(err), err)
+			printDiagnostics(config, config.Mode+" of session", rec, err)
+		}
+		return o, charge
+	}
+	switch {
+	case config.Mode == "replace" && statusCode(err) == 404:
+		return outcomeNotFound, charge
+	case err != nil && ctx.Err() != nil:
+		return outcomeCancelled, charge
+	case statusCode(err) == 429:
+		r.stats.recordFailure("Throttled inserting", rec, statusCode(err), err)
+		printDiagnostics(config, config.Mode+" of session", rec, err)
+		return outcomeThrottled, charge
+	case errors.Is(err, timeout.ErrOpTimeout):
+		r.stats.recordFailure("Timed out inserting", rec, statusCode(err), err)
+		printDiagnostics(config, config.Mode+" of session", rec, err)
+		return outcomeTimeout, charge
+	case err != nil:
+		r.stats.recordFailure("Failed to insert", rec, statusCode(err), err)
+		printDiagnostics(config, config.Mode+" of session", rec, err)
+		return outcomeError, charge
+	}
+	return outcomeSuccess, charge
+}
+
+// tenantShard maps a tenant to one of shards queues
+func tenantShard(tenant string, shards int) int {
+	if shards == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(tenant))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// printWorkerThroughput prints the records, rate and tenants handled per worker
+func printWorkerThroughput(workers []workerStats, elapsed time.Duration) {
+	fmt.Printf("\n👷 Worker Throughput:\n")
+	for i, worker := range workers {
+		rate := 0.0
+		if elapsed > 0 {
+			rate = float64(worker.records) / elapsed.Seconds()
+		}
+		tenants := slices.Sorted(maps.Keys(worker.tenants))
+		fmt.Printf(" Worker %d: %d records, %.1f records/sec, %.2f RU, tenants: %s\n",
+			i+1, worker.records, rate, worker.charge, strings.Join(tenants, ", "))
+	}
+}
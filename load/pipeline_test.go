@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadSampleDataCancelled(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"shared queue", []string{"-workers", "4"}},
+		{"shared queue without buffer", []string{"-workers", "4", "-buffer", "0"}},
+		{"sharded by tenant", []string{"-workers", "3", "-shard-by-tenant"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig(t, append([]string{"-rows", "5000"}, tt.args...)...)
+			config.DeadlineAt = time.Now().Add(100 * time.Millisecond)
+			writer := &fakeWriter{charge: 1, latency: 2 * time.Millisecond}
+
+			var stats *loadStats
+			var err error
+			captureStdout(t, func() {
+				stats, err = loadSampleData(writer, config, nil)
+			})
+			if err == nil || !strings.Contains(err.Error(), "-deadline reached") {
+				t.Fatalf("loadSampleData() err = %v, want the deadline", err)
+			}
+
+			if stats.generated == 0 || stats.generated == config.RowCount {
+				t.Fatalf("generated %d of %d records, want the deadline to stop the load part way", stats.generated, config.RowCount)
+			}
+			// every record handed to a writer ends exactly once
+			if ended := stats.success + stats.cancelled + stats.errors; ended != stats.generated {
+				t.Errorf("success %d + cancelled %d + errors %d = %d, want the %d generated", stats.success, stats.cancelled, stats.errors, ended, stats.generated)
+			}
+			if stats.errors != 0 {
+				t.Errorf("errors = %d, want writes cut short by the deadline counted as cancelled", stats.errors)
+			}
+			if written := writer.written(); written != stats.success {
+				t.Errorf("writer holds %d writes, want the %d successes", written, stats.success)
+			}
+			if len(writer.items) != len(writer.order) {
+				t.Errorf("%d writes for %d ids, want every record written once", len(writer.order), len(writer.items))
+			}
+		})
+	}
+}
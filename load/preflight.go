@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// runPreflight checks that the credentials and endpoint work by reading the
+// database and container, then prints where the request was served, the
+// partition key definition and the provisioned throughput
+func runPreflight(client *azcosmos.Client, config Config) error {
+	ctx := context.Background()
+
+	fmt.Printf("Running preflight against %s...\n", config.Endpoint)
+
+	databaseClient, err := client.NewDatabase(config.DatabaseName)
+	if err != nil {
+		return fmt.Errorf("failed to create database client: %w", err)
+	}
+	databaseResponse, err := databaseClient.Read(ctx, nil)
+	if err != nil {
+		return describePreflightError("read database "+config.DatabaseName, err)
+	}
+	fmt.Printf(" Database: %s\n", config.DatabaseName)
+	if databaseResponse.RawResponse != nil && databaseResponse.RawResponse.Request != nil {
+		fmt.Printf(" Served by: %s\n", databaseResponse.RawResponse.Request.URL.Host)
+	}
+
+	containerClient, err := databaseClient.NewContainer(config.ContainerName)
+	if err != nil {
+		return fmt.Errorf("failed to create container client: %w", err)
+	}
+	containerResponse, err := containerClient.Read(ctx, nil)
+	if err != nil {
+		return describePreflightError("read container "+config.ContainerName, err)
+	}
+	fmt.Printf(" Container: %s\n", config.ContainerName)
+	fmt.Printf(" Partition key: %s\n", describePartitionKeyDefinition(containerResponse.ContainerProperties.PartitionKeyDefinition))
+
+	throughputResponse, err := containerClient.ReadThroughput(ctx, nil)
+	switch {
+	case statusCode(err) == 404:
+		// the container shares the database throughput
+		fmt.Printf(" Throughput: not provisioned on the container (shared database throughput)\n")
+	case err != nil:
+		return describePreflightError("read container throughput", err)
+	default:
+		if manual, ok := throughputResponse.ThroughputProperties.ManualThroughput(); ok {
+			fmt.Printf(" Throughput: %d RU/s (manual)\n", manual)
+		} else if autoscaleMax, ok := throughputResponse.ThroughputProperties.AutoscaleMaxThroughput(); ok {
+			fmt.Printf(" Throughput: up to %d RU/s (autoscale)\n", autoscaleMax)
+		}
+	}
+
+	fmt.Println("Preflight succeeded")
+	return nil
+}
+
+// describePreflightError wraps err with a remediation hint that tells credential
+// problems apart from network problems
+func describePreflightError(operation string, err error) error {
+	var authErr *azidentity.AuthenticationFailedError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &authErr) || strings.Contains(err.Error(), "failed to acquire a token"):
+		return fmt.Errorf("credential error during %s: %w\nremediation: sign in with `az login` or set AZURE_CLIENT_ID/AZURE_TENANT_ID/AZURE_CLIENT_SECRET", operation, err)
+	case statusCode(err) == 401 || statusCode(err) == 403:
+		return fmt.Errorf("authorization error during %s: %w\nremediation: grant the identity a Cosmos DB data plane role (e.g. Cosmos DB Built-in Data Contributor) on the account", operation, err)
+	case statusCode(err) == 404:
+		return fmt.Errorf("not found during %s: %w\nremediation: check -database and -container, or run the loader without -ping to create them", operation, err)
+	case errors.As(err, &netErr):
+		return fmt.Errorf("network error during %s: %w\nremediation: check the -endpoint URL, DNS and firewall rules for the account", operation, err)
+	default:
+		return fmt.Errorf("failed to %s: %w", operation, err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+)
+
+// subscription plans assigned to generated profiles
+var profilePlans = []string{"free", "pro", "enterprise"}
+
+// profileTarget is where profiles are written and how many partition key
+// levels that container uses
+type profileTarget struct {
+	writer   ItemWriter
+	pkLevels int
+	padded   bool // the container is partitioned down to /sessionId
+}
+
+// userSet records which (tenantId, userId) pairs already have a profile, claim
+// is safe to call from several goroutines at once
+type userSet struct {
+	mu   sync.Mutex
+	seen map[[2]string]bool
+}
+
+// claim reports whether the user was not seen before and marks it as seen
+func (u *userSet) claim(tenantID, userID string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := [2]string{tenantID, userID}
+	if u.seen[key] {
+		return false
+	}
+	if u.seen == nil {
+		u.seen = make(map[[2]string]bool)
+	}
+	u.seen[key] = true
+	return true
+}
+
+// newUserProfile builds the profile of a user. The fields are derived from the
+// tenant and user IDs so a re-run upserts the same profile
+func newUserProfile(tenantID, userID string, padded bool) model.UserProfile {
+	h := fnv.New32a()
+	h.Write([]byte(tenantID + "/" + userID))
+	sum := h.Sum32()
+
+	profile := model.UserProfile{
+		ID:          "profile-" + userID,
+		Type:        model.ProfileType,
+		TenantID:    tenantID,
+		UserID:      userID,
+		DisplayName: fmt.Sprintf("%s (%s)", strings.ReplaceAll(userID, "-", " "), tenantID),
+		Plan:        profilePlans[sum%uint32(len(profilePlans))],
+		CreatedAt:   time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -int(sum%365)),
+	}
+	if padded {
+		profile.SessionID = model.ProfileSessionID
+	}
+	return profile
+}
+
+// profilePartitionKey builds the partition key of a profile up to pkLevels
+func profilePartitionKey(profile model.UserProfile, pkLevels int) azcosmos.PartitionKey {
+	partitionKey := azcosmos.NewPartitionKeyString(profile.TenantID)
+	if pkLevels >= 2 {
+		partitionKey = partitionKey.AppendString(profile.UserID)
+	}
+	if pkLevels >= 3 {
+		partitionKey = partitionKey.AppendString(profile.SessionID)
+	}
+	return partitionKey
+}
+
+// writeProfile upserts the profile of the session's user
+func writeProfile(ctx context.Context, target *profileTarget, session UserSession) (float64, error) {
+	profile := newUserProfile(session.TenantID, session.UserID, target.padded)
+	body, err := json.Marshal(profile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal profile %s: %w", profile.ID, err)
+	}
+	return target.writer.Upsert(ctx, profilePartitionKey(profile, target.pkLevels), body)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// how often the progress line is redrawn, how often a progress line is printed
+// when stdout is redirected, and how far back the rate looks
+const (
+	progressInterval     = 500 * time.Millisecond
+	progressLineInterval = 5 * time.Second
+	progressWindow       = 10 * time.Second
+)
+
+// progressSample is the processed count at a point in time
+type progressSample struct {
+	at   time.Time
+	done int64
+}
+
+// progress renders a single updating line with percent complete, rows/sec over
+// a sliding window, consumed RUs and an ETA. When stdout is not a terminal it
+// prints a progress line periodically instead. add is safe to call from several
+// goroutines at once
+type progress struct {
+	total int64
+	live  bool
+	quiet bool
+	start time.Time
+
+	done atomic.Int64
+
+	charge RUAccumulator
+
+	mu      sync.Mutex // guards samples
+	samples []progressSample
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newProgress creates a progress display for total records. The live line is
+// only drawn when stdout is a terminal, quiet disables all progress output
+func newProgress(total int, quiet bool) *progress {
+	return &progress{
+		total:   int64(total),
+		live:    !quiet && stdoutIsTerminal(),
+		quiet:   quiet,
+		start:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// stdoutIsTerminal reports whether stdout is attached to a terminal
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// begin starts reporting progress in the background
+func (p *progress) begin() {
+	if p.quiet {
+		close(p.stopped)
+		return
+	}
+
+	interval := progressInterval
+	if !p.live {
+		interval = progressLineInterval
+	}
+
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				if p.live {
+					fmt.Printf("\r\033[K%s", p.render())
+				} else {
+					fmt.Println(p.render())
+				}
+			}
+		}
+	}()
+}
+
+// add records n processed records and the RU charge they consumed
+func (p *progress) add(n int, charge float64) {
+	p.done.Add(int64(n))
+	p.charge.Add(charge)
+}
+
+// end stops reporting and clears the live line so the summary replaces it
+func (p *progress) end() {
+	close(p.stop)
+	<-p.stopped
+	if p.live {
+		fmt.Print("\r\033[K")
+	} else if !p.quiet {
+		fmt.Println(p.render())
+	}
+}
+
+// render formats the current progress line
+func (p *progress) render() string {
+	now := time.Now()
+	done := p.done.Load()
+
+	charge := p.charge.Total()
+
+	p.mu.Lock()
+	p.samples = append(p.samples, progressSample{at: now, done: done})
+	for len(p.samples) > 1 && now.Sub(p.samples[0].at) > progressWindow {
+		p.samples = p.samples[1:]
+	}
+	oldest := p.samples[0]
+	p.mu.Unlock()
+
+	// rows/sec over the sliding window, falling back to the whole run at the start
+	rate := 0.0
+	if elapsed := now.Sub(oldest.at).Seconds(); elapsed > 0 {
+		rate = float64(done-oldest.done) / elapsed
+	} else if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(done) / elapsed
+	}
+
+	percent := 100.0
+	if p.total > 0 {
+		percent = float64(done) / float64(p.total) * 100
+	}
+
+	eta := "--"
+	if rate > 0 {
+		eta = (time.Duration(float64(p.total-done)/rate) * time.Second).Round(time.Second).String()
+	}
+
+	return fmt.Sprintf(" Progress: %5.1f%% %d/%d | %.1f rows/s | %.2f RU | ETA %s", percent, done, p.total, rate, charge, eta)
+}
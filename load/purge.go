@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// purgeStats is the outcome of a purge. The counters are updated by several
+// workers at once and guarded by mu
+type purgeStats struct {
+	mu       sync.Mutex
+	found    int
+	deleted  int
+	missing  int // already gone, for example expired through TTL
+	skipped  int // items without the fields of the partition key
+	failed   int
+	charge   RUAccumulator
+	elapsed  time.Duration
+	lastErr  error
+	levels   int
+	queryRUs float64
+}
+
+// purgeContainer deletes every item of the container and keeps the container
+// itself, with its throughput and indexing policy. The items are found with a
+// cross partition query and each one is deleted with the partition key rebuilt
+// from its own fields, by config.Workers workers paced by limiter
+func purgeContainer(containerClient *azcosmos.ContainerClient, config Config, limiter *ruLimiter) error {
+	ctx, stop := runContext(config)
+	defer stop()
+
+	containerResponse, err := containerClient.Read(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read container properties: %w", err)
+	}
+	stats := &purgeStats{levels: len(containerResponse.ContainerProperties.PartitionKeyDefinition.Paths)}
+
+	start := time.Now()
+	items, err := purgeCandidates(ctx, containerClient, stats)
+	if err != nil {
+		return err
+	}
+	stats.found = len(items)
+
+	fmt.Printf("Deleting %d items with %d workers...\n", len(items), config.Workers)
+	progress := newProgress(len(items), config.Quiet)
+	progress.begin()
+
+	work := make(chan UserSession)
+	var wg sync.WaitGroup
+	for range config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				charge := deleteItem(ctx, containerClient, config, limiter, item, stats)
+				progress.add(1, charge)
+			}
+		}()
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- item
+	}
+	close(work)
+	wg.Wait()
+
+	progress.end()
+	stats.elapsed = time.Since(start)
+	stats.printSummary()
+
+	if err := ctx.Err(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("interrupted after deleting %d of %d items", stats.deleted, stats.found)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("-deadline reached after deleting %d of %d items", stats.deleted, stats.found)
+		}
+		return err
+	}
+	if stats.failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d items, last error: %w", stats.failed, stats.found, stats.lastErr)
+	}
+	return nil
+}
+
+// purgeCandidates returns the id and partition key fields of every item.
+// Items without the fields the container's partition key needs are logged and
+// counted as skipped, a delete could not address them
+func purgeCandidates(ctx context.Context, containerClient *azcosmos.ContainerClient, stats *purgeStats) ([]UserSession, error) {
+	query := "SELECT c.id, c.tenantId, c.userId, c.sessionId FROM c"
+
+	// every item is deleted, so every partition has to be visited
+	emptyPartitionKey := azcosmos.NewPartitionKey()
+
+	pager := containerClient.NewQueryItemsPager(query, emptyPartitionKey, nil)
+
+	// collect first so deletes do not disturb the continuation of the query
+	var items []UserSession
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query items: %w", err)
+		}
+		stats.charge.Add(float64(page.RequestCharge))
+		stats.queryRUs += float64(page.RequestCharge)
+
+		for _, _item := range page.Items {
+			var item UserSession
+			if err := json.Unmarshal(_item, &item); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal item: %w", err)
+			}
+			if missing := missingKeyField(item, stats.levels); missing != "" {
+				log.Printf("Skipping item %s: no %s to build its partition key from", item.ID, missing)
+				stats.skipped++
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// missingKeyField returns the first partition key field of the first levels
+// that item lacks, or "" when all are set
+func missingKeyField(item UserSession, levels int) string {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"tenantId", item.TenantID},
+		{"userId", item.UserID},
+		{"sessionId", item.SessionID},
+	}
+	for _, field := range fields[:min(levels, len(fields))] {
+		if field.value == "" {
+			return field.name
+		}
+	}
+	return ""
+}
+
+// deleteItem deletes one item with the retry policy, -op-timeout and the RU
+// budget of a load, counts the outcome and returns the RUs it consumed
+func deleteItem(ctx context.Context, containerClient *azcosmos.ContainerClient, config Config, limiter *ruLimiter, item UserSession, stats *purgeStats) float64 {
+	partitionKey := buildPartitionKey(item, stats.levels)
+
+	var resp azcosmos.ItemResponse
+	err := config.RetryPolicy.Execute(ctx, func() error {
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+		return timeout.WithOpTimeout(ctx, config.OpTimeout, func(ctx context.Context) error {
+			var err error
+			resp, err = containerClient.DeleteItem(ctx, partitionKey, item.ID, nil)
+			limiter.take(float64(resp.RequestCharge))
+			return err
+		})
+	})
+	charge := float64(resp.RequestCharge)
+	stats.charge.Add(charge)
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	switch {
+	case statusCode(err) == 404:
+		stats.missing++
+	case ctx.Err() != nil:
+		// interrupted, reported by purgeContainer
+	case err != nil:
+		log.Printf("Failed to delete item %s of tenant %s: %v", item.ID, item.TenantID, err)
+		stats.failed++
+		stats.lastErr = err
+	default:
+		stats.deleted++
+	}
+	return charge
+}
+
+// printSummary prints the purge summary
+func (s *purgeStats) printSummary() {
+	fmt.Printf("\n📊 Purge Summary:\n")
+	fmt.Printf(" Items deleted: %d of %d\n", s.deleted, s.found)
+	if s.missing > 0 {
+		fmt.Printf(" Already gone: %d\n", s.missing)
+	}
+	if s.skipped > 0 {
+		fmt.Printf(" Skipped (missing partition key fields): %d\n", s.skipped)
+	}
+	if s.failed > 0 {
+		fmt.Printf(" Failed deletes: %d\n", s.failed)
+	}
+	fmt.Printf(" Total RU consumed: %.2f (query %.2f)\n", s.charge.Total(), s.queryRUs)
+	if s.deleted > 0 {
+		fmt.Printf(" Average RU per delete: %.2f\n", (s.charge.Total()-s.queryRUs)/float64(s.deleted))
+	}
+	fmt.Printf(" Elapsed: %v\n", s.elapsed.Round(time.Millisecond))
+	if s.deleted > 0 && s.elapsed > 0 {
+		fmt.Printf(" Throughput: %.1f deletes/sec\n", float64(s.deleted)/s.elapsed.Seconds())
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ruTokens is the number of tokens per request unit, RU charges carry
+// fractions and rate.Limiter counts whole tokens
+const ruTokens = 1000
+
+// ruLimiter is a token bucket holding request units. It refills at the target
+// RU/s up to one second worth of RUs. The charge of a write is only known once
+// it completes, so writes wait until the bucket is no longer in debt and the
+// actual charge is taken afterwards, which keeps the average at the target. A
+// nil *ruLimiter does not limit
+type ruLimiter struct {
+	limiter *rate.Limiter
+}
+
+// newRULimiter returns a limiter pacing writes to targetRUs RU/s, or nil when
+// targetRUs is 0
+func newRULimiter(targetRUs int) *ruLimiter {
+	if targetRUs <= 0 {
+		return nil
+	}
+	return &ruLimiter{limiter: rate.NewLimiter(rate.Limit(targetRUs*ruTokens), targetRUs*ruTokens)}
+}
+
+// wait blocks until the bucket has RUs left or ctx is done
+func (l *ruLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	// waiting for no tokens waits until the debt of earlier charges is paid
+	return waitLimiter(ctx, l.limiter, 0)
+}
+
+// take removes the RU charge of a completed request from the bucket
+func (l *ruLimiter) take(charge float64) {
+	if l == nil {
+		return
+	}
+	// a reservation may put the bucket in debt but not take more than a
+	// burst at once, so large charges are taken in parts
+	now := time.Now()
+	for tokens := int(charge * ruTokens); tokens > 0; tokens -= l.limiter.Burst() {
+		l.limiter.ReserveN(now, min(tokens, l.limiter.Burst()))
+	}
+}
+
+// waitLimiter waits for n tokens of limiter or until ctx is done. The limiter
+// fails at once when the wait would outlast the deadline of ctx, that is
+// reported as ctx.Err() once the deadline has passed, like a cancelled wait
+func waitLimiter(ctx context.Context, limiter *rate.Limiter, n int) error {
+	if err := limiter.WaitN(ctx, n); err != nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// reportTimeFormat names report files, without colons so the names are valid
+// on every file system and sort by time
+const reportTimeFormat = "20060102T150405Z"
+
+// loadReport is the JSON report -report-dir writes after a load
+type loadReport struct {
+	Timestamp      time.Time      `json:"timestamp"`
+	Seed           int64          `json:"seed"`
+	Config         Config         `json:"config"`
+	Records        reportRecords  `json:"records"`
+	Tenants        map[string]int `json:"tenants"`
+	TotalRU        float64        `json:"totalRU"`
+	AverageRU      float64        `json:"averageRU"`
+	ElapsedSeconds float64        `json:"elapsedSeconds"`
+	Error          string         `json:"error,omitempty"`
+	Failures       []reportError  `json:"failures"`
+}
+
+// reportRecords counts the records of a load by outcome
+type reportRecords struct {
+	Total     int `json:"total"`
+	Generated int `json:"generated"`
+	Success   int `json:"success"`
+	Errors    int `json:"errors"`
+	Throttled int `json:"throttled"`
+	Timeouts  int `json:"timeouts"`
+	Skipped   int `json:"skipped"`
+	Invalid   int `json:"invalid"`
+	Rejected  int `json:"rejected"`
+	Oversized int `json:"oversized"`
+	Cancelled int `json:"cancelled"`
+	Profiles  int `json:"profiles,omitempty"`
+
+	Conflicts          int `json:"conflicts"`
+	UniqueKeyConflicts int `json:"uniqueKeyConflicts"`
+	NewIDs             int `json:"newIds,omitempty"`
+}
+
+// reportError is a failed write in the report
+type reportError struct {
+	Record    int    `json:"record"`
+	TenantID  string `json:"tenantId"`
+	UserID    string `json:"userId"`
+	SessionID string `json:"sessionId"`
+	Status    int    `json:"status,omitempty"`
+	Error     string `json:"error"`
+}
+
+// writeReport writes the outcome of a load to load-report-<timestamp>.json in
+// dir and returns the path. loadErr is the error the load ended with, if any.
+// Unlike the failures table the report lists every failed write
+func writeReport(dir string, config Config, stats *loadStats, loadErr error) (string, error) {
+	now := time.Now().UTC()
+	report := loadReport{
+		Timestamp: now,
+		Seed:      config.Seed,
+		Config:    redactedConfig(config),
+		Records: reportRecords{
+			Total:     stats.total,
+			Generated: stats.generated,
+			Success:   stats.success,
+			Errors:    stats.errors,
+			Throttled: stats.throttled,
+			Timeouts:  stats.timeouts,
+			Skipped:   stats.skipped,
+			Invalid:   stats.invalid,
+			Rejected:  stats.rejected,
+			Oversized: stats.oversizedCount,
+			Cancelled: stats.cancelled,
+			Profiles:  stats.profiles,
+
+			Conflicts:          stats.conflicts,
+			UniqueKeyConflicts: stats.uniqueConflicts,
+			NewIDs:             stats.newIDs,
+		},
+		Tenants:        stats.tenants,
+		TotalRU:        stats.charge.Total(),
+		ElapsedSeconds: stats.elapsed.Seconds(),
+		Failures:       []reportError{},
+	}
+	if stats.success > 0 {
+		report.AverageRU = stats.writeCharge.Total() / float64(stats.success)
+	}
+	if loadErr != nil {
+		report.Error = loadErr.Error()
+	}
+
+	stats.mu.Lock()
+	sort.Slice(stats.failures, func(i, j int) bool { return stats.failures[i].index < stats.failures[j].index })
+	for _, f := range stats.failures {
+		report.Failures = append(report.Failures, reportError{
+			Record:    f.index + 1,
+			TenantID:  f.tenantID,
+			UserID:    f.userID,
+			SessionID: f.sessionID,
+			Status:    f.status,
+			Error:     f.err,
+		})
+	}
+	stats.mu.Unlock()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	path := filepath.Join(dir, "load-report-"+now.Format(reportTimeFormat)+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return path, nil
+}
+
+// redactedConfig returns config without the account key, the PII encryption
+// key and proxy credentials, which must not end up in a report file
+func redactedConfig(config Config) Config {
+	config.Key = ""
+	config.EncryptionKey = ""
+	config.PIIKey = nil
+	config.HTTPProxy = config.RedactedProxy()
+	return config
+}
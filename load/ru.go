@@ -0,0 +1,26 @@
+package main
+
+import "sync"
+
+// RUAccumulator sums request unit charges from several goroutines. Charges are
+// fractional, so they cannot be summed with the integer atomics used for counts
+type RUAccumulator struct {
+	mu    sync.Mutex
+	total float64
+}
+
+// Add adds the charge of one request
+func (a *RUAccumulator) Add(v float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.total += v
+}
+
+// Total returns the sum of all charges added so far
+func (a *RUAccumulator) Total() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.total
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRUAccumulatorConcurrentAdd(t *testing.T) {
+	var acc RUAccumulator
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				acc.Add(0.25)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := acc.Total(); got != 2000 {
+		t.Errorf("Total() = %v, want 2000", got)
+	}
+}
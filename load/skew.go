@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+// tenantSelector picks the tenant for each generated session. With a skew
+// factor of 0 every tenant is equally likely, above 0 tenants are ranked by
+// their sessions weight and picked from a Zipf distribution so the heaviest
+// tenants accumulate most of the sessions. A hot tenant takes a fixed share of
+// all sessions on top of that. It is not safe for concurrent use
+type tenantSelector struct {
+	rng    *rand.Rand
+	ranked []TenantConfig
+	zipf   *rand.Zipf
+	shares []float64
+
+	hot      int // index into ranked, -1 without a hot tenant
+	hotRatio float64
+}
+
+// zipf parameters for a skew factor: the exponent grows and the offset that
+// flattens the head shrinks as the skew factor goes from 0 to 1
+func zipfParameters(skew float64) (s, v float64) {
+	return 1.01 + 2*skew, 1 + 10*(1-skew)
+}
+
+// newTenantSelector creates a selector over tenants for the given skew factor
+// drawing from rng
+func newTenantSelector(rng *rand.Rand, tenants []TenantConfig, skew float64) *tenantSelector {
+	ranked := slices.Clone(tenants)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Sessions > ranked[j].Sessions
+	})
+
+	selector := &tenantSelector{rng: rng, ranked: ranked, shares: make([]float64, len(ranked)), hot: -1}
+	if skew == 0 {
+		for i := range selector.shares {
+			selector.shares[i] = 1 / float64(len(ranked))
+		}
+		return selector
+	}
+
+	s, v := zipfParameters(skew)
+	selector.zipf = rand.NewZipf(rng, s, v, uint64(len(ranked)-1))
+
+	// P(k) is proportional to (v+k)^-s, normalised over the ranked tenants
+	total := 0.0
+	for k := range selector.shares {
+		selector.shares[k] = math.Pow(v+float64(k), -s)
+		total += selector.shares[k]
+	}
+	for k := range selector.shares {
+		selector.shares[k] /= total
+	}
+	return selector
+}
+
+// setHotTenant sends ratio of all sessions to the named tenant, the rest keep
+// following the configured distribution
+func (t *tenantSelector) setHotTenant(name string, ratio float64) error {
+	hot := slices.IndexFunc(t.ranked, func(tenant TenantConfig) bool { return tenant.Name == name })
+	if hot < 0 {
+		return fmt.Errorf("unknown tenant %q", name)
+	}
+
+	for k := range t.shares {
+		t.shares[k] *= 1 - ratio
+	}
+	t.shares[hot] += ratio
+	t.hot = hot
+	t.hotRatio = ratio
+	return nil
+}
+
+// isHot reports whether tenant is the hot tenant
+func (t *tenantSelector) isHot(tenant TenantConfig) bool {
+	return t.hot >= 0 && t.ranked[t.hot].Name == tenant.Name
+}
+
+// pick returns the tenant for the next session
+func (t *tenantSelector) pick() TenantConfig {
+	if t.hot >= 0 && t.rng.Float64() < t.hotRatio {
+		return t.ranked[t.hot]
+	}
+	if t.zipf == nil {
+		return t.ranked[t.rng.Intn(len(t.ranked))]
+	}
+	return t.ranked[t.zipf.Uint64()]
+}
+
+// printDistribution prints the expected and realized record count per tenant
+func (t *tenantSelector) printDistribution(rows int, actual map[string]int) {
+	fmt.Printf("\n📈 Tenant Distribution:\n")
+	fmt.Printf(" %-20s %10s %10s\n", "Tenant", "Expected", "Actual")
+	for k, tenant := range t.ranked {
+		fmt.Printf(" %-20s %10.0f %10d\n", tenant.Name, t.shares[k]*float64(rows), actual[tenant.Name])
+	}
+}
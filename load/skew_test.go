@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTenantSelectorDistribution(t *testing.T) {
+	tests := []struct {
+		name      string
+		skew      float64
+		hotTenant string
+		hotRatio  float64
+	}{
+		{name: "uniform"},
+		{name: "skewed", skew: 0.5},
+		{name: "strongly skewed", skew: 1},
+		{name: "hot tenant", hotTenant: "LocalShops-SME", hotRatio: 0.6},
+		{name: "hot tenant and skew", skew: 0.5, hotTenant: "MidMarket-Inc", hotRatio: 0.3},
+	}
+
+	const draws = 200000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector := newTenantSelector(rand.New(rand.NewSource(1)), tenantTypes, tt.skew)
+			if tt.hotTenant != "" {
+				if err := selector.setHotTenant(tt.hotTenant, tt.hotRatio); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			counts := make(map[string]int)
+			for range draws {
+				counts[selector.pick().Name]++
+			}
+			for i, tenant := range selector.ranked {
+				got := float64(counts[tenant.Name]) / draws
+				if want := selector.shares[i]; math.Abs(got-want) > 0.01 {
+					t.Errorf("%s picked %.3f of the time, want %.3f", tenant.Name, got, want)
+				}
+			}
+			if tt.hotTenant != "" && float64(counts[tt.hotTenant])/draws < tt.hotRatio {
+				t.Errorf("hot tenant %s picked %d of %d times, want at least %.0f%%", tt.hotTenant, counts[tt.hotTenant], draws, tt.hotRatio*100)
+			}
+		})
+	}
+}
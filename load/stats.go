@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outcome is how a single record of a load ended
+type outcome int
+
+const (
+	outcomeGenerated outcome = iota
+	outcomeSuccess
+	outcomeError
+	outcomeSkipped
+	outcomeInvalid
+	outcomeCancelled
+	outcomeThrottled // a failed write rejected with 429
+	outcomeRejected  // a record that failed UserSession.Validate
+	outcomeOversized // a record above maxDocumentSizeBytes
+	outcomeTimeout   // a failed write whose last attempt ran past -op-timeout
+	outcomeNotFound  // a -mode replace write of an id that does not exist
+	outcomeConflict  // a failed -mode insert write of an id that already exists, with -on-conflict fail
+
+	// a failed write rejected with 409 by the container's unique key policy
+	outcomeUniqueConflict
+)
+
+// loadStats accumulates the outcome of a load. record is safe to call from
+// several goroutines at once
+type loadStats struct {
+	mu        sync.Mutex
+	total     int
+	generated int
+	success   int
+	errors    int
+	throttled int
+	skipped   int
+	invalid   int
+	cancelled int
+	tenants   map[string]int // successful writes per tenant
+	charge    RUAccumulator  // writeCharge plus profileCharge
+	elapsed   time.Duration
+
+	profiles      int
+	profileErrors int
+
+	ttlBuckets map[int]int // successful writes per ttlBucket
+
+	rejected       int // records that failed validation, never sent
+	oversizedCount int // records above the item size limit, never sent
+	timeouts       int // failed writes that timed out, also counted in errors
+	notFound       int // -mode replace writes of ids that do not exist
+
+	// failed writes rejected with 409, also counted in errors: conflicts on
+	// the id with -on-conflict fail and unique key policy violations.
+	// newIDs counts records written under a new id by -on-conflict retry-new-id
+	conflicts       int
+	uniqueConflicts int
+	newIDs          int
+
+	failures []writeFailure
+
+	// RU charge per operation type. mode is the -mode the items were
+	// written with. A load sends no reads, so the breakdown is by the kind
+	// of write rather than insert against read
+	mode          string
+	writeCharge   RUAccumulator
+	profileCharge RUAccumulator
+}
+
+// maxFailureRows caps the failures table, the log has every failure
+const maxFailureRows = 50
+
+// writeFailure is a failed write with the keys of the record it was for
+type writeFailure struct {
+	index     int
+	tenantID  string
+	userID    string
+	sessionID string
+	status    int
+	err       string
+}
+
+// chargeWrite counts the RUs of a write, also those of a write that records
+// no outcome, like a batch split because it was too large
+func (s *loadStats) chargeWrite(charge float64) {
+	s.charge.Add(charge)
+	s.writeCharge.Add(charge)
+}
+
+// record counts one record outcome and the RUs it consumed
+func (s *loadStats) record(o outcome, charge float64) {
+	// the accumulators have their own locks, taking them under s.mu would
+	// make every write wait on both
+	s.chargeWrite(charge)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch o {
+	case outcomeGenerated:
+		s.generated++
+	case outcomeSuccess:
+		s.success++
+	case outcomeError:
+		s.errors++
+	case outcomeThrottled:
+		s.errors++
+		s.throttled++
+	case outcomeSkipped:
+		s.skipped++
+	case outcomeInvalid:
+		s.invalid++
+	case outcomeCancelled:
+		s.cancelled++
+	case outcomeRejected:
+		s.rejected++
+	case outcomeOversized:
+		s.oversizedCount++
+	case outcomeTimeout:
+		s.errors++
+		s.timeouts++
+	case outcomeNotFound:
+		s.notFound++
+	case outcomeConflict:
+		s.errors++
+		s.conflicts++
+	case outcomeUniqueConflict:
+		s.errors++
+		s.uniqueConflicts++
+	}
+}
+
+// countNewID counts a record written under a new id after an id conflict
+func (s *loadStats) countNewID() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.newIDs++
+}
+
+// recordProfile counts a profile write and the RUs it consumed
+func (s *loadStats) recordProfile(ok bool, charge float64) {
+	s.charge.Add(charge)
+	s.profileCharge.Add(charge)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ok {
+		s.profiles++
+	} else {
+		s.profileErrors++
+	}
+}
+
+// countTenant counts a successful write for tenant
+func (s *loadStats) countTenant(tenant string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tenants == nil {
+		s.tenants = make(map[string]int)
+	}
+	s.tenants[tenant]++
+}
+
+// countTTL counts a successful write in the bucket of its ttl
+func (s *loadStats) countTTL(ttl int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ttlBuckets == nil {
+		s.ttlBuckets = make(map[int]int)
+	}
+	s.ttlBuckets[ttlBucket(ttl)]++
+}
+
+// recordFailure logs a failed write of rec with its keys and HTTP status and
+// keeps it for printFailures. action starts the log line, e.g. "Failed to insert"
+func (s *loadStats) recordFailure(action string, rec record, status int, err error) {
+	log.Printf("%s session %d (tenant %s, user %s, session %s, status %s): %v",
+		action, rec.index+1, rec.session.TenantID, rec.session.UserID, rec.session.SessionID, statusText(status), err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, writeFailure{
+		index:     rec.index,
+		tenantID:  rec.session.TenantID,
+		userID:    rec.session.UserID,
+		sessionID: rec.session.SessionID,
+		status:    status,
+		err:       err.Error(),
+	})
+}
+
+// printFailures prints the failed writes as a table, sorted by record
+func (s *loadStats) printFailures() {
+	if len(s.failures) == 0 {
+		return
+	}
+	sort.Slice(s.failures, func(i, j int) bool { return s.failures[i].index < s.failures[j].index })
+
+	fmt.Printf("\n❌ Failed writes:\n")
+	fmt.Printf(" %-8s %-12s %-12s %-38s %-6s %s\n", "Record", "Tenant", "User", "Session", "Status", "Error")
+	for i, f := range s.failures {
+		if i == maxFailureRows {
+			fmt.Printf(" ... and %d more\n", len(s.failures)-maxFailureRows)
+			break
+		}
+		fmt.Printf(" %-8d %-12s %-12s %-38s %-6s %s\n", f.index+1, f.tenantID, f.userID, f.sessionID, statusText(f.status), firstLine(f.err))
+	}
+}
+
+// statusText formats an HTTP status code, "-" when the error had none
+func statusText(status int) string {
+	if status == 0 {
+		return "-"
+	}
+	return strconv.Itoa(status)
+}
+
+// firstLine returns the first line of s, azcore errors span several
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// printSummary prints the load summary
+func (s *loadStats) printSummary() {
+	fmt.Printf("\n📊 Load Summary:\n")
+	if s.generated != s.total {
+		fmt.Printf(" Generated: %d of %d\n", s.generated, s.total)
+	}
+	fmt.Printf(" Successful inserts: %d\n", s.success)
+	if s.skipped > 0 {
+		fmt.Printf(" Skipped (already exist): %d\n", s.skipped)
+	}
+	if s.newIDs > 0 {
+		fmt.Printf(" Written with a new id after a conflict: %d\n", s.newIDs)
+	}
+	if s.notFound > 0 {
+		fmt.Printf(" Skipped (not found): %d\n", s.notFound)
+	}
+	if s.invalid > 0 {
+		fmt.Printf(" Skipped (invalid partition key): %d\n", s.invalid)
+	}
+	if s.rejected > 0 {
+		fmt.Printf(" Skipped (failed validation): %d\n", s.rejected)
+	}
+	if s.oversizedCount > 0 {
+		fmt.Printf(" Skipped (over %d bytes): %d\n", maxDocumentSizeBytes, s.oversizedCount)
+	}
+	if s.cancelled > 0 {
+		fmt.Printf(" Not written (cancelled): %d\n", s.cancelled)
+	}
+	if s.errors > 0 {
+		fmt.Printf(" Failed inserts: %d (%d throttled, %d timed out, %d id conflicts, %d unique key conflicts)\n",
+			s.errors, s.throttled, s.timeouts, s.conflicts, s.uniqueConflicts)
+	}
+	if s.profiles > 0 || s.profileErrors > 0 {
+		fmt.Printf(" Profiles written: %d\n", s.profiles)
+		if s.profileErrors > 0 {
+			fmt.Printf(" Failed profiles: %d\n", s.profileErrors)
+		}
+	}
+	fmt.Printf(" Total RU consumed: %.2f\n", s.charge.Total())
+	if s.profiles > 0 || s.profileErrors > 0 {
+		fmt.Printf(" RU by operation: %s %.2f, profile %.2f\n", s.mode, s.writeCharge.Total(), s.profileCharge.Total())
+	}
+	if s.success > 0 {
+		fmt.Printf(" Average RU per record: %.2f\n", s.writeCharge.Total()/float64(s.success))
+	}
+	fmt.Printf(" Elapsed: %v\n", s.elapsed.Round(time.Millisecond))
+	if s.success > 0 && s.elapsed > 0 {
+		fmt.Printf(" Throughput: %.1f records/sec\n", float64(s.success)/s.elapsed.Seconds())
+	}
+}
+
+// err reports failed inserts as an error
+func (s *loadStats) err() error {
+	if s.errors > 0 {
+		return fmt.Errorf("completed with %d errors out of %d total records", s.errors, s.total)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+func TestLoadSampleDataOutcomes(t *testing.T) {
+	const rows = 20
+
+	tests := []struct {
+		name    string
+		args    []string
+		fail    func(int, string) error
+		prefill bool // write every record once before the load
+		want    counts
+		wantErr bool
+	}{
+		{
+			name: "all written",
+			want: counts{success: rows},
+		},
+		{
+			name:    "throttled",
+			fail:    failFirst(rows, responseError(429, 0)),
+			want:    counts{errors: rows, throttled: rows},
+			wantErr: true,
+		},
+		{
+			name:    "some throttled",
+			fail:    failFirst(5, responseError(429, 0)),
+			want:    counts{success: rows - 5, errors: 5, throttled: 5},
+			wantErr: true,
+		},
+		{
+			name:    "timed out",
+			fail:    failFirst(rows, timeout.ErrOpTimeout),
+			want:    counts{errors: rows, timeouts: rows},
+			wantErr: true,
+		},
+		{
+			name:    "bad request",
+			fail:    failFirst(rows, responseError(400, 0)),
+			want:    counts{errors: rows},
+			wantErr: true,
+		},
+		{
+			name:    "insert conflicts skipped",
+			args:    []string{"-mode", "insert"},
+			prefill: true,
+			want:    counts{skipped: rows},
+		},
+		{
+			name:    "insert conflicts failed",
+			args:    []string{"-mode", "insert", "-on-conflict", "fail"},
+			prefill: true,
+			want:    counts{errors: rows, conflicts: rows},
+			wantErr: true,
+		},
+		{
+			name:    "insert conflicts written with new ids",
+			args:    []string{"-mode", "insert", "-on-conflict", "retry-new-id"},
+			prefill: true,
+			want:    counts{success: rows, newIDs: rows},
+		},
+		{
+			name:    "unique key conflicts failed",
+			fail:    failFirst(rows, uniqueKeyConflict()),
+			want:    counts{errors: rows, uniqueConflicts: rows},
+			wantErr: true,
+		},
+		{
+			name: "replace missing",
+			args: []string{"-mode", "replace"},
+			want: counts{notFound: rows},
+		},
+		{
+			name:    "replace existing",
+			args:    []string{"-mode", "replace"},
+			prefill: true,
+			want:    counts{success: rows},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig(t, append([]string{"-rows", "20", "-workers", "4", "-deterministic-ids"}, tt.args...)...)
+			writer := &fakeWriter{charge: 2.5}
+			if tt.prefill {
+				prefill := config
+				prefill.Mode = "upsert"
+				captureStdout(t, func() {
+					if _, err := loadSampleData(writer, prefill, nil); err != nil {
+						t.Fatalf("prefill: %v", err)
+					}
+				})
+				writer.calls = 0
+			}
+			writer.fail = tt.fail
+
+			var stats *loadStats
+			var err error
+			captureStdout(t, func() {
+				stats, err = loadSampleData(writer, config, nil)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSampleData() err = %v, want error %v", err, tt.wantErr)
+			}
+
+			if got := countsOf(stats); got != tt.want {
+				t.Errorf("stats = %+v, want %+v", got, tt.want)
+			}
+			if stats.generated != rows {
+				t.Errorf("generated = %d, want %d", stats.generated, rows)
+			}
+			if want := 2.5 * float64(writer.calls); stats.charge.Total() != want {
+				t.Errorf("charge = %v, want %v", stats.charge.Total(), want)
+			}
+			if len(stats.failures) != stats.errors {
+				t.Errorf("failures = %d, want one per error (%d)", len(stats.failures), stats.errors)
+			}
+		})
+	}
+}
+
+// counts are the write outcome counters of a loadStats
+type counts struct {
+	success, errors, throttled, timeouts, skipped, notFound int
+	conflicts, uniqueConflicts, newIDs                      int
+}
+
+// countsOf returns the write outcome counters of s
+func countsOf(s *loadStats) counts {
+	return counts{s.success, s.errors, s.throttled, s.timeouts, s.skipped, s.notFound, s.conflicts, s.uniqueConflicts, s.newIDs}
+}
+
+func TestRecordCountsOutcomes(t *testing.T) {
+	stats := &loadStats{}
+	for _, o := range []outcome{outcomeGenerated, outcomeGenerated, outcomeSuccess, outcomeThrottled, outcomeTimeout, outcomeConflict, outcomeUniqueConflict, outcomeError} {
+		stats.record(o, 1)
+	}
+	stats.recordProfile(true, 2)
+	stats.recordProfile(false, 3)
+
+	if stats.generated != 2 || stats.success != 1 {
+		t.Errorf("generated, success = %d, %d, want 2, 1", stats.generated, stats.success)
+	}
+	// every failed write counts as an error as well as by its kind
+	if stats.errors != 5 || stats.throttled != 1 || stats.timeouts != 1 || stats.conflicts != 1 || stats.uniqueConflicts != 1 {
+		t.Errorf("counts = %+v, uniqueConflicts = %d", countsOf(stats), stats.uniqueConflicts)
+	}
+	if stats.profiles != 1 || stats.profileErrors != 1 {
+		t.Errorf("profiles, profileErrors = %d, %d, want 1, 1", stats.profiles, stats.profileErrors)
+	}
+	if stats.charge.Total() != 13 || stats.writeCharge.Total() != 8 || stats.profileCharge.Total() != 5 {
+		t.Errorf("charge, write, profile = %v, %v, %v, want 13, 8, 5", stats.charge.Total(), stats.writeCharge.Total(), stats.profileCharge.Total())
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		stats   func() *loadStats
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "all written",
+			stats: func() *loadStats {
+				s := &loadStats{total: 4, generated: 4, success: 4, elapsed: 2 * time.Second, mode: "upsert"}
+				s.writeCharge.Add(40)
+				s.charge.Add(40)
+				return s
+			},
+			want: []string{
+				" Successful inserts: 4\n",
+				" Total RU consumed: 40.00\n",
+				" Average RU per record: 10.00\n",
+				" Elapsed: 2s\n",
+				" Throughput: 2.0 records/sec\n",
+			},
+			notWant: []string{"Generated:", "Failed inserts", "Skipped", "RU by operation"},
+		},
+		{
+			name: "failures",
+			stats: func() *loadStats {
+				return &loadStats{total: 10, generated: 8, success: 3, errors: 5, throttled: 1, timeouts: 1, conflicts: 2, uniqueConflicts: 1, cancelled: 2}
+			},
+			want: []string{
+				" Generated: 8 of 10\n",
+				" Successful inserts: 3\n",
+				" Not written (cancelled): 2\n",
+				" Failed inserts: 5 (1 throttled, 1 timed out, 2 id conflicts, 1 unique key conflicts)\n",
+			},
+			notWant: []string{"Throughput"},
+		},
+		{
+			name: "skipped",
+			stats: func() *loadStats {
+				return &loadStats{total: 5, generated: 5, skipped: 1, notFound: 1, invalid: 1, rejected: 1, oversizedCount: 1}
+			},
+			want: []string{
+				" Skipped (already exist): 1\n",
+				" Skipped (not found): 1\n",
+				" Skipped (invalid partition key): 1\n",
+				" Skipped (failed validation): 1\n",
+				" Skipped (over 2097152 bytes): 1\n",
+			},
+			notWant: []string{"Average RU per record"},
+		},
+		{
+			name: "profiles",
+			stats: func() *loadStats {
+				s := &loadStats{total: 2, generated: 2, success: 2, profileErrors: 1, mode: "insert"}
+				s.charge.Add(10)
+				s.writeCharge.Add(10)
+				s.recordProfile(true, 4)
+				return s
+			},
+			want: []string{
+				" Profiles written: 1\n",
+				" Failed profiles: 1\n",
+				" RU by operation: insert 10.00, profile 4.00\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := tt.stats()
+			out := captureStdout(t, stats.printSummary)
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("summary is missing %q:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("summary has %q:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintFailures(t *testing.T) {
+	stats := &loadStats{}
+	for i := maxFailureRows + 2; i > 0; i-- {
+		stats.failures = append(stats.failures, writeFailure{index: i - 1, tenantID: "t", userID: "u", sessionID: "s", status: 429, err: "throttled\nsecond line"})
+	}
+
+	out := captureStdout(t, stats.printFailures)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	// the title, the header, maxFailureRows rows and the overflow line
+	if len(lines) != maxFailureRows+3 {
+		t.Fatalf("printed %d lines, want %d:\n%s", len(lines), maxFailureRows+3, out)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(lines[2]), "1 ") {
+		t.Errorf("first row = %q, want record 1 first", lines[2])
+	}
+	if strings.Contains(out, "second line") {
+		t.Errorf("printed more than the first line of an error:\n%s", out)
+	}
+	if !strings.Contains(lines[len(lines)-1], "and 2 more") {
+		t.Errorf("last line = %q, want the overflow count", lines[len(lines)-1])
+	}
+}
+
+func TestLoadStatsErr(t *testing.T) {
+	if err := (&loadStats{total: 3, success: 3}).err(); err != nil {
+		t.Errorf("err() = %v, want nil", err)
+	}
+	err := (&loadStats{total: 3, success: 1, errors: 2}).err()
+	if err == nil || err.Error() != "completed with 2 errors out of 3 total records" {
+		t.Errorf("err() = %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sustainedMinute holds the counters for one minute of a sustained load
+type sustainedMinute struct {
+	ops       int
+	errors    int
+	throttled int
+	charge    float64
+}
+
+// runSustainedLoad keeps generating and writing records at config.TargetOps per second
+// until config.Duration elapses or the run is interrupted, then prints a per-minute report
+func runSustainedLoad(writer ItemWriter, config Config) error {
+	ctx, stop := runContext(config)
+	defer stop()
+
+	fmt.Printf("Running sustained load for %v at %d ops/sec (Ctrl-C to stop early)...\n", config.Duration, config.TargetOps)
+
+	generator, err := newSessionGenerator(config)
+	if err != nil {
+		return err
+	}
+
+	// the ticker paces writes, ticks that arrive while a write is in flight are dropped
+	ticker := time.NewTicker(time.Second / time.Duration(config.TargetOps))
+	defer ticker.Stop()
+	deadline := time.NewTimer(config.Duration)
+	defer deadline.Stop()
+
+	start := time.Now()
+	var minutes []sustainedMinute
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				fmt.Println("\n-deadline reached, stopping sustained load")
+			} else {
+				fmt.Println("\nInterrupted, stopping sustained load")
+			}
+			break loop
+		case <-deadline.C:
+			break loop
+		case <-ticker.C:
+		}
+
+		minute := int(time.Since(start) / time.Minute)
+		for len(minutes) <= minute {
+			minutes = append(minutes, sustainedMinute{})
+		}
+		bucket := &minutes[minute]
+
+		session := generator.next()
+		if err := validatePartitionKey(session, config.PKLevels); err != nil {
+			if config.Strict {
+				printSustainedReport(minutes, time.Since(start))
+				return err
+			}
+			bucket.errors++
+			continue
+		}
+		sessionJSON, err := json.Marshal(session)
+		if err != nil {
+			bucket.errors++
+			continue
+		}
+
+		charge, err := writeItem(ctx, writer, config.Mode, buildPartitionKey(session, config.PKLevels), sessionJSON)
+		bucket.ops++
+		bucket.charge += charge
+		if err != nil {
+			if ctx.Err() != nil {
+				break loop
+			}
+			if statusCode(err) == 429 {
+				bucket.throttled++
+			}
+			bucket.errors++
+		}
+	}
+
+	printSustainedReport(minutes, time.Since(start))
+	if config.AnomalyRate > 0 {
+		printAnomalies(generator.anomalies)
+	}
+	return nil
+}
+
+// printSustainedReport prints achieved ops/sec, RU/s and 429 rate for every minute of the run
+func printSustainedReport(minutes []sustainedMinute, elapsed time.Duration) {
+	fmt.Printf("\n📊 Sustained Load Summary (%v):\n", elapsed.Round(time.Second))
+	fmt.Printf(" %-8s %10s %10s %10s %8s\n", "Minute", "Ops/sec", "RU/s", "Errors", "429 %")
+
+	var totalOps, totalErrors, totalThrottled int
+	var totalCharge float64
+	for i, minute := range minutes {
+		// the last minute is usually partial
+		seconds := 60.0
+		if i == len(minutes)-1 {
+			seconds = (elapsed - time.Duration(i)*time.Minute).Seconds()
+			if seconds <= 0 {
+				seconds = 1
+			}
+		}
+
+		throttleRate := 0.0
+		if minute.ops > 0 {
+			throttleRate = float64(minute.throttled) / float64(minute.ops) * 100
+		}
+		fmt.Printf(" %-8d %10.1f %10.1f %10d %7.1f%%\n", i+1, float64(minute.ops)/seconds, minute.charge/seconds, minute.errors, throttleRate)
+
+		totalOps += minute.ops
+		totalErrors += minute.errors
+		totalThrottled += minute.throttled
+		totalCharge += minute.charge
+	}
+
+	fmt.Printf(" Total writes: %d\n", totalOps)
+	fmt.Printf(" Failed writes: %d (%d throttled)\n", totalErrors, totalThrottled)
+	fmt.Printf(" Total RU consumed: %.2f\n", totalCharge)
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		fmt.Printf(" Average: %.1f ops/sec, %.1f RU/s\n", float64(totalOps)/seconds, totalCharge/seconds)
+	}
+}
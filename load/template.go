@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/google/uuid"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// number of documents -template-check renders
+const templateCheckSamples = 3
+
+// templateData is the data a document template is executed with
+type templateData struct {
+	Index  int
+	Tenant TenantConfig
+}
+
+// templateFuncs are the helper functions available inside document templates
+var templateFuncs = template.FuncMap{
+	"uuid": uuid.NewString,
+	"randInt": func(min, max int) int {
+		return min + rand.Intn(max-min+1)
+	},
+	"choice": func(values ...string) string {
+		return values[rand.Intn(len(values))]
+	},
+	"now": time.Now,
+}
+
+// loadDocumentTemplate parses a Go text/template that renders one JSON document
+// per record. Parse errors carry the template line number
+func loadDocumentTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderDocument executes the template for one record and parses the result as a JSON object
+func renderDocument(tmpl *template.Template, index int) (map[string]any, []byte, error) {
+	data := templateData{
+		Index:  index,
+		Tenant: tenantTypes[rand.Intn(len(tenantTypes))],
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(rendered.Bytes(), &doc); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := 1 + bytes.Count(rendered.Bytes()[:syntaxErr.Offset], []byte("\n"))
+			return nil, nil, fmt.Errorf("rendered document is not valid JSON at line %d: %w", line, err)
+		}
+		return nil, nil, fmt.Errorf("rendered document is not a JSON object: %w", err)
+	}
+	if _, ok := doc["id"].(string); !ok {
+		return nil, nil, fmt.Errorf("rendered document has no string id field")
+	}
+
+	return doc, rendered.Bytes(), nil
+}
+
+// documentPartitionKey builds the partition key of a rendered document from the
+// first pkLevels partition key paths
+func documentPartitionKey(doc map[string]any, pkLevels int) (azcosmos.PartitionKey, error) {
+	var partitionKey azcosmos.PartitionKey
+	for i, path := range partitionKeyPaths[:pkLevels] {
+		var value any = doc
+		for _, segment := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+			object, ok := value.(map[string]any)
+			if !ok {
+				value = nil
+				break
+			}
+			value = object[segment]
+		}
+
+		text, ok := value.(string)
+		if !ok || text == "" {
+			return azcosmos.PartitionKey{}, fmt.Errorf("rendered document has no string value at partition key path %s", path)
+		}
+		if i == 0 {
+			partitionKey = azcosmos.NewPartitionKeyString(text)
+		} else {
+			partitionKey = partitionKey.AppendString(text)
+		}
+	}
+	return partitionKey, nil
+}
+
+// checkTemplate renders a few documents to stdout without writing anything
+func checkTemplate(tmpl *template.Template, pkLevels int) error {
+	for i := range templateCheckSamples {
+		doc, _, err := renderDocument(tmpl, i)
+		if err != nil {
+			return fmt.Errorf("sample %d: %w", i+1, err)
+		}
+		if _, err := documentPartitionKey(doc, pkLevels); err != nil {
+			return fmt.Errorf("sample %d: %w", i+1, err)
+		}
+
+		pretty, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return fmt.Errorf("sample %d: %w", i+1, err)
+		}
+		fmt.Printf("Sample %d:\n%s\n", i+1, pretty)
+	}
+	return nil
+}
+
+// loadTemplateData renders and writes config.RowCount documents from the template.
+// A template error stops the run immediately since every record would hit it
+func loadTemplateData(writer ItemWriter, config Config, tmpl *template.Template) (*loadStats, error) {
+	ctx, stop := runContext(config)
+	defer stop()
+	rowCount := config.RowCount
+
+	fmt.Printf("Generating %d documents from template %s...\n", rowCount, config.TemplateFile)
+
+	stats := &loadStats{total: rowCount, mode: config.Mode}
+	start := time.Now()
+
+	progress := newProgress(rowCount, config.Quiet)
+	progress.begin()
+
+	for i := range rowCount {
+		// Ctrl+C or -deadline stops the run, the remaining records are not written
+		if ctx.Err() != nil {
+			stats.record(outcomeCancelled, 0)
+			continue
+		}
+		doc, body, err := renderDocument(tmpl, i)
+		if err != nil {
+			progress.end()
+			stats.elapsed = time.Since(start)
+			return stats, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		partitionKey, err := documentPartitionKey(doc, config.PKLevels)
+		if err != nil {
+			progress.end()
+			stats.elapsed = time.Since(start)
+			return stats, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		stats.record(outcomeGenerated, 0)
+
+		charge, err := writeItem(ctx, writer, config.Mode, partitionKey, body)
+		progress.add(1, charge)
+		if conflict, ok := classifyConflict(config, err); ok {
+			if conflict != outcomeSkipped {
+				log.Printf("Conflict inserting document %d: %v", i+1, err)
+			}
+			stats.record(conflict, charge)
+			continue
+		}
+		if config.Mode == "replace" && statusCode(err) == 404 {
+			stats.record(outcomeNotFound, charge)
+			continue
+		}
+		if err != nil && ctx.Err() != nil {
+			stats.record(outcomeCancelled, charge)
+			continue
+		}
+		if errors.Is(err, timeout.ErrOpTimeout) {
+			log.Printf("Timed out inserting document %d: %v", i+1, err)
+			stats.record(outcomeTimeout, charge)
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to insert document %d: %v", i+1, err)
+			stats.record(outcomeError, charge)
+			continue
+		}
+		stats.record(outcomeSuccess, charge)
+	}
+
+	progress.end()
+	stats.elapsed = time.Since(start)
+
+	stats.printSummary()
+	if err := ctx.Err(); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return stats, fmt.Errorf("-deadline reached after %d of %d records", stats.generated, stats.total)
+		}
+		return stats, fmt.Errorf("interrupted after %d of %d records", stats.generated, stats.total)
+	}
+	return stats, stats.err()
+}
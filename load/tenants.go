@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+)
+
+// ensureTenantsContainer creates the tenants reference container partitioned
+// by /tenantId and upserts one document per tenant type
+func ensureTenantsContainer(ctx context.Context, databaseClient *azcosmos.DatabaseClient, containerName string) error {
+	containerProperties := azcosmos.ContainerProperties{
+		ID:                     containerName,
+		PartitionKeyDefinition: partitionKeyDefinition(1),
+	}
+	throughputProperties := azcosmos.NewManualThroughputProperties(400)
+
+	_, err := databaseClient.CreateContainer(ctx, containerProperties, &azcosmos.CreateContainerOptions{
+		ThroughputProperties: &throughputProperties,
+	})
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if !(errors.As(err, &respErr) && respErr.StatusCode == 409) {
+			return fmt.Errorf("failed to create tenants container: %w", err)
+		}
+		fmt.Printf("Container %s already exists\n", containerName)
+	} else {
+		fmt.Printf("Created tenants container %s partitioned by /tenantId\n", containerName)
+	}
+
+	containerClient, err := databaseClient.NewContainer(containerName)
+	if err != nil {
+		return fmt.Errorf("failed to create tenants container client: %w", err)
+	}
+
+	for _, tenant := range tenantTypes {
+		doc := model.Tenant{
+			ID:       tenant.Name,
+			TenantID: tenant.Name,
+			UserMin:  tenant.UserMin,
+			UserMax:  tenant.UserMax,
+			Sessions: tenant.Sessions,
+		}
+		body, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tenant %s: %w", tenant.Name, err)
+		}
+		_, err = containerClient.UpsertItem(ctx, azcosmos.NewPartitionKeyString(tenant.Name), body, nil)
+		if err != nil {
+			return fmt.Errorf("failed to upsert tenant %s: %w", tenant.Name, err)
+		}
+	}
+	fmt.Printf("Upserted %d tenants into %s\n", len(tenantTypes), containerName)
+
+	return nil
+}
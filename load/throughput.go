@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// scaleContainerThroughput sets the container's manual throughput to rus
+func scaleContainerThroughput(ctx context.Context, containerClient *azcosmos.ContainerClient, rus int) error {
+	_, err := containerClient.ReplaceThroughput(ctx, azcosmos.NewManualThroughputProperties(int32(rus)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to set container throughput to %d RU/s: %w", rus, err)
+	}
+	return nil
+}
+
+// preScaleThroughput raises the container's manual throughput to rus for the
+// duration of a load. The returned function puts the original value back and
+// must always be called. Containers on autoscale or shared database throughput
+// are left alone
+func preScaleThroughput(ctx context.Context, containerClient *azcosmos.ContainerClient, rus int) (func(), error) {
+	noop := func() {}
+
+	throughputResponse, err := containerClient.ReadThroughput(ctx, nil)
+	if statusCode(err) == 404 {
+		fmt.Printf("Warning: container has no dedicated throughput (shared database throughput), skipping -pre-load-rus\n")
+		return noop, nil
+	}
+	if err != nil {
+		return noop, fmt.Errorf("failed to read container throughput: %w", err)
+	}
+
+	original, ok := throughputResponse.ThroughputProperties.ManualThroughput()
+	if !ok {
+		fmt.Printf("Warning: container uses autoscale throughput, skipping -pre-load-rus\n")
+		return noop, nil
+	}
+
+	if err := scaleContainerThroughput(ctx, containerClient, rus); err != nil {
+		return noop, err
+	}
+	fmt.Printf(" Throughput: %d RU/s -> %d RU/s for the load\n", original, rus)
+
+	return func() {
+		// the load context may be cancelled by now, restoring must still happen
+		if err := scaleContainerThroughput(context.Background(), containerClient, int(original)); err != nil {
+			log.Printf("Failed to restore container throughput, it is still %d RU/s: %v", rus, err)
+			return
+		}
+		fmt.Printf(" Throughput: restored to %d RU/s\n", original)
+	}, nil
+}
+
+// scaleThroughput changes the container's provisioned throughput to ru RU/s,
+// keeping its current mode: the manual value or the autoscale maximum is
+// replaced. It prints the provisioned value reported back by the service
+func scaleThroughput(containerClient *azcosmos.ContainerClient, ru int) error {
+	ctx := context.Background()
+
+	throughputResponse, err := containerClient.ReadThroughput(ctx, nil)
+	if statusCode(err) == 404 {
+		return fmt.Errorf("container has no dedicated throughput, it shares the database throughput")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read container throughput: %w", err)
+	}
+
+	properties := azcosmos.NewManualThroughputProperties(int32(ru))
+	mode := "manual"
+	if _, ok := throughputResponse.ThroughputProperties.AutoscaleMaxThroughput(); ok {
+		properties = azcosmos.NewAutoscaleThroughputProperties(int32(ru))
+		mode = "autoscale"
+	}
+
+	replaceResponse, err := containerClient.ReplaceThroughput(ctx, properties, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set %s throughput to %d RU/s: %w", mode, ru, err)
+	}
+
+	if manual, ok := replaceResponse.ThroughputProperties.ManualThroughput(); ok {
+		fmt.Printf("Provisioned throughput: %d RU/s (manual)\n", manual)
+	} else if autoscaleMax, ok := replaceResponse.ThroughputProperties.AutoscaleMaxThroughput(); ok {
+		fmt.Printf("Provisioned throughput: up to %d RU/s (autoscale)\n", autoscaleMax)
+	}
+	if replaceResponse.IsReplacePending {
+		fmt.Println("The change is still being applied by the service")
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// runContext returns the context a load runs under. It is cancelled on Ctrl+C
+// and, with -deadline, once the deadline counted from startup has passed
+func runContext(config Config) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if config.DeadlineAt.IsZero() {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithDeadline(ctx, config.DeadlineAt)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// minAgeTTL is the ttl in seconds given to documents that are already older than
+// -ttl-by-age, so they expire right after being written
+const minAgeTTL = 1
+
+// maxTTLByAgeDays keeps days*86400 within the int32 ttl Cosmos DB accepts
+const maxTTLByAgeDays = math.MaxInt32 / 86400
+
+// ttlByAge returns the ttl in seconds that makes a document with the given
+// timestamp expire days after it, measured from now
+func ttlByAge(timestamp, now time.Time, days int) int {
+	expiry := timestamp.AddDate(0, 0, days)
+	remaining := int(expiry.Sub(now) / time.Second)
+	if remaining < minAgeTTL {
+		return minAgeTTL
+	}
+	return remaining
+}
+
+// validateTTL checks that a per-item ttl is a positive int32
+func validateTTL(ttl int) error {
+	if ttl < 1 || ttl > math.MaxInt32 {
+		return fmt.Errorf("invalid ttl %d: must be a positive int32", ttl)
+	}
+	return nil
+}
+
+// ttlBucket groups a ttl by the whole days left before expiry, documents given
+// the minimal ttl are counted apart as -1
+func ttlBucket(ttl int) int {
+	if ttl == minAgeTTL {
+		return -1
+	}
+	return ttl / 86400
+}
+
+// printTTLBuckets prints how many written documents fell into each ttl bucket
+func printTTLBuckets(buckets map[int]int, days int) {
+	fmt.Printf("\n⏳ TTL by age (expire %d days after timestamp):\n", days)
+	for _, bucket := range slices.Sorted(maps.Keys(buckets)) {
+		if bucket == -1 {
+			fmt.Printf(" Already older, minimal ttl %ds: %d\n", minAgeTTL, buckets[bucket])
+			continue
+		}
+		fmt.Printf(" Expire in %d-%d days: %d\n", bucket, bucket+1, buckets[bucket])
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// userPoolEntry is one user of a -user-pool file
+type userPoolEntry struct {
+	TenantID string `json:"tenantId"`
+	UserID   string `json:"userId"`
+}
+
+// userPool is the set of users per tenant that -user-pool keeps stable across
+// runs. Sessions of a tenant with users in the file only go to those users.
+// Tenants without users in the file, which is every tenant on the first run,
+// keep their generated users and those are added to the pool
+type userPool struct {
+	path   string
+	users  map[string][]string // user IDs per tenant, in the order they joined
+	seen   map[[2]string]bool
+	fixed  map[string]bool // tenants whose sessions are drawn from the pool
+	loaded int             // users read from the file
+	grown  int             // users added by -grow-users
+}
+
+// loadUserPool reads the pool at path, a missing file starts an empty pool.
+// grow adds that many new users to every tenant of tenants, numbered after
+// the tenant's highest user, and needs an existing file
+func loadUserPool(path string, grow int, tenants []TenantConfig) (*userPool, error) {
+	pool := &userPool{
+		path:  path,
+		users: make(map[string][]string),
+		seen:  make(map[[2]string]bool),
+		fixed: make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if grow > 0 {
+			return nil, fmt.Errorf("-grow-users needs an existing user pool, %s does not exist yet: run once with -user-pool alone to create it", path)
+		}
+		return pool, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user pool: %w", err)
+	}
+
+	var entries []userPoolEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse user pool %s: %w", path, err)
+	}
+	for i, entry := range entries {
+		if entry.TenantID == "" || entry.UserID == "" {
+			return nil, fmt.Errorf("user pool %s: entry %d needs a tenantId and a userId", path, i)
+		}
+		pool.add(entry.TenantID, entry.UserID)
+		pool.fixed[entry.TenantID] = true
+	}
+	pool.loaded = len(pool.seen)
+
+	for _, tenant := range tenants {
+		next := tenant.UserMax + 1
+		for _, userID := range pool.users[tenant.Name] {
+			if n, err := strconv.Atoi(strings.TrimPrefix(userID, "user-")); err == nil && n >= next {
+				next = n + 1
+			}
+		}
+		for i := range grow {
+			pool.add(tenant.Name, fmt.Sprintf("user-%d", next+i))
+		}
+		if grow > 0 {
+			pool.fixed[tenant.Name] = true
+			pool.grown += grow
+		}
+	}
+	return pool, nil
+}
+
+// add puts a user into the pool unless it is already there
+func (p *userPool) add(tenantID, userID string) {
+	key := [2]string{tenantID, userID}
+	if p.seen[key] {
+		return
+	}
+	p.seen[key] = true
+	p.users[tenantID] = append(p.users[tenantID], userID)
+}
+
+// assign gives the events of one session a user of the pool when the tenant
+// has pool users, otherwise it adds the generated user to the pool
+func (p *userPool) assign(rng *rand.Rand, tenantID string, events []UserSession) {
+	if !p.fixed[tenantID] {
+		p.add(tenantID, events[0].UserID)
+		return
+	}
+	users := p.users[tenantID]
+	userID := users[rng.Intn(len(users))]
+	for i := range events {
+		events[i].UserID = userID
+	}
+}
+
+// save writes the pool sorted by tenant to a temporary file and renames it
+// into place, so an interrupted save keeps the previous pool
+func (p *userPool) save() error {
+	tenantIDs := make([]string, 0, len(p.users))
+	for tenantID := range p.users {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+
+	entries := make([]userPoolEntry, 0, len(p.seen))
+	for _, tenantID := range tenantIDs {
+		for _, userID := range p.users[tenantID] {
+			entries = append(entries, userPoolEntry{TenantID: tenantID, UserID: userID})
+		}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal user pool: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), ".user-pool-*")
+	if err != nil {
+		return fmt.Errorf("failed to create user pool file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write user pool file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write user pool file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p.path); err != nil {
+		return fmt.Errorf("failed to move user pool file into place: %w", err)
+	}
+	return nil
+}
+
+// saveUserPool saves the generator's user pool, if any, and prints its size
+func (g *sessionGenerator) saveUserPool() {
+	if g.users == nil {
+		return
+	}
+	if err := g.users.save(); err != nil {
+		log.Printf("Failed to save user pool: %v", err)
+		return
+	}
+	fmt.Printf("User pool: %d users of %d tenants saved to %s (%d new, %d from -grow-users)\n",
+		len(g.users.seen), len(g.users.users), g.users.path, len(g.users.seen)-g.users.loaded-g.users.grown, g.users.grown)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// partition key size limits, kept below the service limits so invalid values
+// fail locally with a clear message instead of an opaque 400
+const (
+	maxPartitionKeyComponentBytes = 1024
+	maxPartitionKeyTotalBytes     = 2048
+)
+
+// maxDocumentSizeBytes is the largest item Cosmos DB accepts, larger items are
+// rejected with a 400
+const maxDocumentSizeBytes = 2 * 1024 * 1024
+
+// PartitionKeyError describes a partition key value that would be rejected by Cosmos DB
+type PartitionKeyError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *PartitionKeyError) Error() string {
+	value := e.Value
+	if len(value) > 64 {
+		value = value[:64] + "..."
+	}
+	return fmt.Sprintf("invalid partition key %s %q: %s", e.Field, value, e.Reason)
+}
+
+// validatePartitionKey checks the first pkLevels partition key components of a
+// session for empty values, control characters and the size limits
+func validatePartitionKey(session UserSession, pkLevels int) error {
+	components := []struct {
+		field string
+		value string
+	}{
+		{"tenantId", session.TenantID},
+		{"userId", session.UserID},
+		{"sessionId", session.SessionID},
+	}[:pkLevels]
+
+	total := 0
+	for _, component := range components {
+		if component.value == "" {
+			return &PartitionKeyError{Field: component.field, Value: component.value, Reason: "value is empty"}
+		}
+		if len(component.value) > maxPartitionKeyComponentBytes {
+			return &PartitionKeyError{Field: component.field, Value: component.value,
+				Reason: fmt.Sprintf("value is %d bytes, the limit is %d", len(component.value), maxPartitionKeyComponentBytes)}
+		}
+		for _, r := range component.value {
+			if unicode.IsControl(r) {
+				return &PartitionKeyError{Field: component.field, Value: component.value,
+					Reason: fmt.Sprintf("value contains control character %U", r)}
+			}
+		}
+		total += len(component.value)
+	}
+
+	if total > maxPartitionKeyTotalBytes {
+		last := components[len(components)-1]
+		return &PartitionKeyError{Field: last.field, Value: last.value,
+			Reason: fmt.Sprintf("combined partition key is %d bytes, the limit is %d", total, maxPartitionKeyTotalBytes)}
+	}
+	return nil
+}
+
+// checkDocumentSize rejects a marshaled document above the 2 MB item limit
+func checkDocumentSize(body []byte) error {
+	if len(body) > maxDocumentSizeBytes {
+		return fmt.Errorf("document is %d bytes, the limit is %d", len(body), maxDocumentSizeBytes)
+	}
+	return nil
+}
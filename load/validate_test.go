@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDocumentSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{"small", 512, false},
+		{"at the limit", maxDocumentSizeBytes, false},
+		{"one byte over", maxDocumentSizeBytes + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDocumentSize(make([]byte, tt.size))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkDocumentSize(%d bytes) = %v, want error %v", tt.size, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// oversizedSession returns a valid session whose user agent pads its JSON
+// past maxDocumentSizeBytes. Validate does not check the user agent, so the
+// session reaches the size guard without registering anything globally
+func oversizedSession(t *testing.T) UserSession {
+	t.Helper()
+	session := generateUserSession(rand.New(rand.NewSource(1)), tenantTypes[0], time.Now())
+	session.UserAgent = strings.Repeat("a", maxDocumentSizeBytes)
+	body, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) <= maxDocumentSizeBytes {
+		t.Fatalf("padded session is %d bytes, want it over %d", len(body), maxDocumentSizeBytes)
+	}
+	return session
+}
+
+func TestWriteSkipsOversizedSession(t *testing.T) {
+	writer := &fakeWriter{}
+	run := &loadRun{
+		config: testConfig(t),
+		writer: writer,
+		stats:  &loadStats{},
+		cancel: func(error) {},
+	}
+
+	outcome, charge := run.write(context.Background(), record{index: 0, session: oversizedSession(t)})
+	if outcome != outcomeOversized || charge != 0 {
+		t.Errorf("write() = %v, %v, want outcomeOversized and no charge", outcome, charge)
+	}
+	if writer.calls != 0 {
+		t.Errorf("the oversized session was sent %d times, want it skipped before the round trip", writer.calls)
+	}
+
+	run.stats.record(outcome, charge)
+	out := captureStdout(t, run.stats.printSummary)
+	if !strings.Contains(out, " Skipped (over 2097152 bytes): 1\n") {
+		t.Errorf("summary does not count the oversized session:\n%s", out)
+	}
+}
+
+func TestWriteBulkGroupSkipsOversizedSession(t *testing.T) {
+	config := testConfig(t, "-bulk")
+	writer := &fakeWriter{charge: 1}
+	stats := &loadStats{}
+	normal := generateUserSession(rand.New(rand.NewSource(1)), tenantTypes[1], time.Now())
+	group := bulkGroup{
+		partitionKey: buildPartitionKey(normal, config.PKLevels),
+		records:      []record{{index: 0, session: oversizedSession(t)}, {index: 1, session: normal}},
+	}
+
+	// one record is left, so it is written on its own rather than as a batch
+	writeBulkGroup(context.Background(), nil, writer, config, group, stats, newProgress(2, true))
+
+	if stats.oversizedCount != 1 || stats.success != 1 {
+		t.Errorf("oversized, success = %d, %d, want 1, 1", stats.oversizedCount, stats.success)
+	}
+	if _, ok := writer.items[normal.ID]; !ok || len(writer.items) != 1 {
+		t.Errorf("writer holds %d items, want only the normal session", len(writer.items))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/retry"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// ItemWriter writes a single item and reports the RU charge of the write.
+// The loader depends on this rather than on *azcosmos.ContainerClient so the
+// generation and accounting logic can run without a live account
+type ItemWriter interface {
+	Upsert(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (charge float64, err error)
+	Create(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (charge float64, err error)
+	Replace(ctx context.Context, pk azcosmos.PartitionKey, id string, body []byte) (charge float64, err error)
+}
+
+// BatchWriter writes items sharing a partition key as one transactional batch,
+// creating them with -mode insert and upserting them otherwise. Like ItemWriter
+// it lets the bulk loader run without a live account
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, pk azcosmos.PartitionKey, mode string, bodies [][]byte) (azcosmos.TransactionalBatchResponse, error)
+}
+
+// containerItems is the part of *azcosmos.ContainerClient containerWriter
+// writes through, which lets its retries be tested without a live account
+type containerItems interface {
+	UpsertItem(ctx context.Context, pk azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error)
+	CreateItem(ctx context.Context, pk azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error)
+	ReplaceItem(ctx context.Context, pk azcosmos.PartitionKey, id string, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error)
+	NewTransactionalBatch(pk azcosmos.PartitionKey) azcosmos.TransactionalBatch
+	ExecuteTransactionalBatch(ctx context.Context, b azcosmos.TransactionalBatch, o *azcosmos.TransactionalBatchOptions) (azcosmos.TransactionalBatchResponse, error)
+}
+
+// containerWriter adapts a *azcosmos.ContainerClient to ItemWriter and
+// BatchWriter, retrying transient failures with retry, bounding every attempt
+// by opTimeout and pacing it with limiter
+type containerWriter struct {
+	containerClient containerItems
+	retry           retry.Policy
+	opTimeout       time.Duration
+	limiter         *ruLimiter // nil without -target-rus
+	diagnostics     bool
+}
+
+// newContainerWriter returns an ItemWriter backed by containerClient, with the
+// retry policy and operation timeout of config
+func newContainerWriter(containerClient containerItems, config Config, limiter *ruLimiter) *containerWriter {
+	return &containerWriter{
+		containerClient: containerClient,
+		retry:           config.RetryPolicy,
+		opTimeout:       config.OpTimeout,
+		limiter:         limiter,
+		diagnostics:     config.Diagnostics,
+	}
+}
+
+// Upsert inserts the item or replaces it if the id already exists. The charge
+// includes every attempt
+func (w *containerWriter) Upsert(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (float64, error) {
+	var charge float64
+	ctx, printTrace := traceWrite(ctx, w.diagnostics, "upsert")
+	defer printTrace()
+	err := w.retry.Execute(ctx, func() error {
+		if err := w.limiter.wait(ctx); err != nil {
+			return err
+		}
+		return timeout.WithOpTimeout(ctx, w.opTimeout, func(ctx context.Context) error {
+			resp, err := w.containerClient.UpsertItem(ctx, pk, body, nil)
+			w.limiter.take(float64(resp.RequestCharge))
+			charge += float64(resp.RequestCharge)
+			return err
+		})
+	})
+	return charge, err
+}
+
+// Create inserts the item, failing with a 409 Conflict if the id already exists.
+// The charge includes every attempt
+func (w *containerWriter) Create(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (float64, error) {
+	var charge float64
+	ctx, printTrace := traceWrite(ctx, w.diagnostics, "create")
+	defer printTrace()
+	err := w.retry.Execute(ctx, func() error {
+		if err := w.limiter.wait(ctx); err != nil {
+			return err
+		}
+		return timeout.WithOpTimeout(ctx, w.opTimeout, func(ctx context.Context) error {
+			resp, err := w.containerClient.CreateItem(ctx, pk, body, nil)
+			w.limiter.take(float64(resp.RequestCharge))
+			charge += float64(resp.RequestCharge)
+			return err
+		})
+	})
+	return charge, err
+}
+
+// Replace replaces the item with id, failing with a 404 Not Found if it does
+// not exist. The charge includes every attempt
+func (w *containerWriter) Replace(ctx context.Context, pk azcosmos.PartitionKey, id string, body []byte) (float64, error) {
+	var charge float64
+	ctx, printTrace := traceWrite(ctx, w.diagnostics, "replace")
+	defer printTrace()
+	err := w.retry.Execute(ctx, func() error {
+		if err := w.limiter.wait(ctx); err != nil {
+			return err
+		}
+		return timeout.WithOpTimeout(ctx, w.opTimeout, func(ctx context.Context) error {
+			resp, err := w.containerClient.ReplaceItem(ctx, pk, id, body, nil)
+			w.limiter.take(float64(resp.RequestCharge))
+			charge += float64(resp.RequestCharge)
+			return err
+		})
+	})
+	return charge, err
+}
+
+// WriteBatch executes bodies as one transactional batch. The response and its
+// charge are those of the last attempt
+func (w *containerWriter) WriteBatch(ctx context.Context, pk azcosmos.PartitionKey, mode string, bodies [][]byte) (azcosmos.TransactionalBatchResponse, error) {
+	batch := w.containerClient.NewTransactionalBatch(pk)
+	for _, body := range bodies {
+		if mode == "insert" {
+			batch.CreateItem(body, nil)
+		} else {
+			batch.UpsertItem(body, nil)
+		}
+	}
+
+	var resp azcosmos.TransactionalBatchResponse
+	err := w.retry.Execute(ctx, func() error {
+		if err := w.limiter.wait(ctx); err != nil {
+			return err
+		}
+		return timeout.WithOpTimeout(ctx, w.opTimeout, func(ctx context.Context) error {
+			var err error
+			resp, err = w.containerClient.ExecuteTransactionalBatch(ctx, batch, nil)
+			w.limiter.take(float64(resp.RequestCharge))
+			return err
+		})
+	})
+	return resp, err
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// fakeWriter is an ItemWriter that keeps the items in memory. Create fails
+// with 409 on an existing id and Replace with 404 on a missing one. fail, when
+// set, is asked first and can inject any other error, e.g. a 429
+type fakeWriter struct {
+	charge  float64       // RU charge of every call
+	latency time.Duration // delay of every call, cut short when ctx is done
+	fail    func(call int, id string) error
+
+	mu    sync.Mutex
+	calls int
+	items map[string][]byte
+	order []string // ids in the order they were written, with repeats
+}
+
+func (w *fakeWriter) Upsert(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (float64, error) {
+	return w.write(ctx, "upsert", body)
+}
+
+func (w *fakeWriter) Create(ctx context.Context, pk azcosmos.PartitionKey, body []byte) (float64, error) {
+	return w.write(ctx, "create", body)
+}
+
+func (w *fakeWriter) Replace(ctx context.Context, pk azcosmos.PartitionKey, id string, body []byte) (float64, error) {
+	return w.write(ctx, "replace", body)
+}
+
+func (w *fakeWriter) write(ctx context.Context, op string, body []byte) (float64, error) {
+	var doc struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return 0, responseError(http.StatusBadRequest, 0)
+	}
+
+	if w.latency > 0 {
+		timer := time.NewTimer(w.latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls++
+	if w.fail != nil {
+		if err := w.fail(w.calls, doc.ID); err != nil {
+			return w.charge, err
+		}
+	}
+	if w.items == nil {
+		w.items = make(map[string][]byte)
+	}
+	_, exists := w.items[doc.ID]
+	switch {
+	case op == "create" && exists:
+		return w.charge, responseError(http.StatusConflict, 0)
+	case op == "replace" && !exists:
+		return w.charge, responseError(http.StatusNotFound, 0)
+	}
+	w.items[doc.ID] = body
+	w.order = append(w.order, doc.ID)
+	return w.charge, nil
+}
+
+// written returns the number of successful writes
+func (w *fakeWriter) written() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.order)
+}
+
+// responseError returns the error azcosmos reports for a response with status,
+// retryAfterMs sets the x-ms-retry-after-ms header when above 0
+func responseError(status, retryAfterMs int) error {
+	header := http.Header{}
+	if retryAfterMs > 0 {
+		header.Set("x-ms-retry-after-ms", strconv.Itoa(retryAfterMs))
+	}
+	return &azcore.ResponseError{
+		StatusCode:  status,
+		RawResponse: &http.Response{StatusCode: status, Header: header, Body: http.NoBody},
+	}
+}
+
+// uniqueKeyConflict returns the 409 the unique key policy rejects a write with,
+// which carries a substatus unlike a conflict on the id
+func uniqueKeyConflict() error {
+	err := responseError(http.StatusConflict, 0).(*azcore.ResponseError)
+	err.RawResponse.Header.Set("x-ms-substatus", "1001")
+	return err
+}
+
+// failFirst fails the first n calls with err
+func failFirst(n int, err error) func(int, string) error {
+	return func(call int, id string) error {
+		if call <= n {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestWriteItemModes(t *testing.T) {
+	body := []byte(`{"id":"item-1"}`)
+	pk := azcosmos.NewPartitionKeyString("t")
+
+	tests := []struct {
+		name       string
+		mode       string
+		existing   bool
+		wantStatus int
+	}{
+		{"upsert new", "upsert", false, 0},
+		{"upsert existing", "upsert", true, 0},
+		{"insert new", "insert", false, 0},
+		{"insert existing", "insert", true, http.StatusConflict},
+		{"replace existing", "replace", true, 0},
+		{"replace missing", "replace", false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &fakeWriter{charge: 5}
+			if tt.existing {
+				writer.items = map[string][]byte{"item-1": body}
+			}
+			charge, err := writeItem(context.Background(), writer, tt.mode, pk, body)
+			if got := statusCode(err); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d (err %v)", got, tt.wantStatus, err)
+			}
+			if charge != 5 {
+				t.Errorf("charge = %v, want the writer's 5", charge)
+			}
+		})
+	}
+}
+
+// fakeContainer is the containerItems of a containerWriter. Every call costs
+// charge RUs, fail decides its error, numbered from 1, and hang makes a call
+// block until its context is done
+type fakeContainer struct {
+	charge float32
+	fail   func(call int) error
+	hang   func(call int) bool
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *fakeContainer) call(ctx context.Context) (azcosmos.Response, error) {
+	c.mu.Lock()
+	c.calls++
+	call := c.calls
+	c.mu.Unlock()
+
+	resp := azcosmos.Response{RequestCharge: c.charge}
+	if c.hang != nil && c.hang(call) {
+		<-ctx.Done()
+		return resp, ctx.Err()
+	}
+	if c.fail != nil {
+		return resp, c.fail(call)
+	}
+	return resp, nil
+}
+
+func (c *fakeContainer) UpsertItem(ctx context.Context, pk azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	resp, err := c.call(ctx)
+	return azcosmos.ItemResponse{Response: resp}, err
+}
+
+func (c *fakeContainer) CreateItem(ctx context.Context, pk azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	resp, err := c.call(ctx)
+	return azcosmos.ItemResponse{Response: resp}, err
+}
+
+func (c *fakeContainer) ReplaceItem(ctx context.Context, pk azcosmos.PartitionKey, id string, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	resp, err := c.call(ctx)
+	return azcosmos.ItemResponse{Response: resp}, err
+}
+
+func (c *fakeContainer) NewTransactionalBatch(pk azcosmos.PartitionKey) azcosmos.TransactionalBatch {
+	return azcosmos.TransactionalBatch{}
+}
+
+func (c *fakeContainer) ExecuteTransactionalBatch(ctx context.Context, b azcosmos.TransactionalBatch, o *azcosmos.TransactionalBatchOptions) (azcosmos.TransactionalBatchResponse, error) {
+	resp, err := c.call(ctx)
+	return azcosmos.TransactionalBatchResponse{Response: resp, Success: err == nil}, err
+}
+
+func TestContainerWriterRetries(t *testing.T) {
+	body := []byte(`{"id":"item-1"}`)
+	pk := azcosmos.NewPartitionKeyString("t")
+	throttled := responseError(http.StatusTooManyRequests, 1)
+
+	// each write returns its charge, a batch only that of its last attempt
+	writes := map[string]func(*containerWriter) (float64, error){
+		"upsert": func(w *containerWriter) (float64, error) {
+			return w.Upsert(context.Background(), pk, body)
+		},
+		"create": func(w *containerWriter) (float64, error) {
+			return w.Create(context.Background(), pk, body)
+		},
+		"replace": func(w *containerWriter) (float64, error) {
+			return w.Replace(context.Background(), pk, "item-1", body)
+		},
+		"batch": func(w *containerWriter) (float64, error) {
+			resp, err := w.WriteBatch(context.Background(), pk, "upsert", [][]byte{body})
+			return float64(resp.RequestCharge), err
+		},
+	}
+
+	tests := []struct {
+		name       string
+		fail       func(int) error
+		hang       func(int) bool
+		wantCalls  int
+		wantStatus int
+		wantErr    error
+	}{
+		{name: "success", wantCalls: 1},
+		{name: "throttled then written", fail: failCalls(2, throttled), wantCalls: 3},
+		{name: "throttled on every attempt", fail: failCalls(10, throttled), wantCalls: 3, wantStatus: http.StatusTooManyRequests},
+		{name: "conflict is not retried", fail: failCalls(10, responseError(http.StatusConflict, 0)), wantCalls: 1, wantStatus: http.StatusConflict},
+		{name: "attempt timed out then written", hang: func(call int) bool { return call == 1 }, wantCalls: 2},
+		{name: "every attempt timed out", hang: func(int) bool { return true }, wantCalls: 3, wantErr: timeout.ErrOpTimeout},
+	}
+	for _, tt := range tests {
+		for op, write := range writes {
+			t.Run(tt.name+"/"+op, func(t *testing.T) {
+				config := testConfig(t, "-retry-max-attempts", "3", "-op-timeout", "20ms")
+				config.RetryPolicy.InitialInterval = time.Millisecond
+				config.RetryPolicy.MaxInterval = time.Millisecond
+				client := &fakeContainer{charge: 2, fail: tt.fail, hang: tt.hang}
+
+				charge, err := write(newContainerWriter(client, config, nil))
+				if client.calls != tt.wantCalls {
+					t.Errorf("%d calls, want %d", client.calls, tt.wantCalls)
+				}
+				if got := statusCode(err); got != tt.wantStatus {
+					t.Errorf("status = %d, want %d (err %v)", got, tt.wantStatus, err)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantErr == nil && tt.wantStatus == 0 && err != nil {
+					t.Errorf("err = %v, want none", err)
+				}
+				wantCharge := float64(2 * tt.wantCalls)
+				if op == "batch" {
+					wantCharge = 2
+				}
+				if charge != wantCharge {
+					t.Errorf("charge = %v, want %v", charge, wantCharge)
+				}
+			})
+		}
+	}
+}
+
+// failCalls fails the first n calls with err
+func failCalls(n int, err error) func(int) error {
+	return func(call int) error {
+		if call <= n {
+			return err
+		}
+		return nil
+	}
+}
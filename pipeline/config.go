@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/config"
+)
+
+// configuration for Azure Cosmos DB connection and the pipeline workload
+type Config struct {
+	config.Connection
+	Rate          int
+	QueryInterval time.Duration
+	Duration      time.Duration
+	Users         int
+}
+
+// loadConfig defines the pipeline flags, parses args and validates the result
+func loadConfig(args []string) (Config, error) {
+	loader := config.NewLoader("pipeline")
+	fs := loader.FlagSet
+
+	var cfg Config
+	fs.IntVar(&cfg.Rate, "rate", 10, "Sessions the producer writes per second")
+	fs.DurationVar(&cfg.QueryInterval, "query-interval", 5*time.Second, "Time between two activity count queries of the consumer")
+	fs.DurationVar(&cfg.Duration, "duration", 0, "Stop after this long, e.g. 5m (0 runs until Ctrl+C)")
+	fs.IntVar(&cfg.Users, "users", 100, "Users per tenant the producer draws from")
+
+	connection, err := loader.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Connection = connection
+
+	if cfg.Rate < 1 {
+		return Config{}, fmt.Errorf("invalid -rate %d: must be at least 1", cfg.Rate)
+	}
+	if cfg.QueryInterval <= 0 {
+		return Config{}, fmt.Errorf("invalid -query-interval %v: must be positive", cfg.QueryInterval)
+	}
+	if cfg.Duration < 0 {
+		return Config{}, fmt.Errorf("invalid -duration %v: must not be negative", cfg.Duration)
+	}
+	if cfg.Users < 1 {
+		return Config{}, fmt.Errorf("invalid -users %d: must be at least 1", cfg.Users)
+	}
+
+	return cfg, nil
+}
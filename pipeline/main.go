@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/google/uuid"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+)
+
+// sample tenants and activities the producer draws from
+var (
+	tenants    = []string{"Global-Corp", "Enterprise-Corp", "MidMarket-Inc", "TechStartup-Co", "LocalShops-SME"}
+	activities = []string{"login", "logout", "view_dashboard", "create_document", "edit_document", "upload_file", "send_message", "view_report"}
+)
+
+// dashboardInterval is how often the live dashboard line is redrawn
+const dashboardInterval = 500 * time.Millisecond
+
+// dashboard holds the numbers the producer and consumer share with the live
+// dashboard line
+type dashboard struct {
+	mu          sync.Mutex
+	produced    int
+	failed      int
+	queries     int
+	queryErrors int
+	lastLatency time.Duration
+	lastError   error // shown in the summary, logging would break the dashboard line
+	charge      float64
+	counts      map[string]int // activity counts of the latest query
+}
+
+func main() {
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	client, err := config.OpenClient()
+	if err != nil {
+		log.Fatalf("Failed to create Cosmos DB client: %v", err)
+	}
+
+	// the producer and the consumer share one container client
+	containerClient, err := client.NewContainer(config.DatabaseName, config.ContainerName)
+	if err != nil {
+		log.Fatalf("Failed to get container client: %v", err)
+	}
+
+	// stop on Ctrl+C, or after -duration
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Duration)
+		defer cancel()
+	}
+
+	fmt.Printf("Pipeline on %s/%s: writing %d sessions/sec, counting activities every %v (Ctrl+C to stop)\n",
+		config.DatabaseName, config.ContainerName, config.Rate, config.QueryInterval)
+
+	board := &dashboard{}
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		produce(ctx, containerClient, config, board)
+	}()
+	go func() {
+		defer wg.Done()
+		consume(ctx, containerClient, config.QueryInterval, board)
+	}()
+	go func() {
+		defer wg.Done()
+		board.run(ctx, start)
+	}()
+	wg.Wait()
+
+	board.printSummary(time.Since(start))
+}
+
+// produce writes one generated session per tick of a -rate ticker until ctx
+// is done. A write slower than the tick interval makes the ticker drop ticks,
+// so the achieved rate shows on the dashboard rather than a growing backlog
+func produce(ctx context.Context, containerClient *azcosmos.ContainerClient, config Config, board *dashboard) {
+	ticker := time.NewTicker(time.Second / time.Duration(config.Rate))
+	defer ticker.Stop()
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		session := newSession(rnd, config.Users)
+		body, err := json.Marshal(session)
+		if err != nil {
+			board.recordWrite(0, err)
+			continue
+		}
+		partitionKey := azcosmos.NewPartitionKeyString(session.TenantID).AppendString(session.UserID).AppendString(session.SessionID)
+
+		resp, err := containerClient.UpsertItem(ctx, partitionKey, body, nil)
+		if ctx.Err() != nil {
+			return
+		}
+		board.recordWrite(float64(resp.RequestCharge), err)
+	}
+}
+
+// newSession generates a session event of a random tenant, user and activity
+func newSession(rnd *rand.Rand, users int) model.UserSession {
+	id := uuid.New()
+	return model.UserSession{
+		ID:            id.String(),
+		TenantID:      tenants[rnd.Intn(len(tenants))],
+		UserID:        fmt.Sprintf("user-%d", rnd.Intn(users)+1),
+		SessionID:     "session-" + id.String()[:8],
+		Activity:      activities[rnd.Intn(len(activities))],
+		Timestamp:     time.Now().UTC(),
+		SchemaVersion: model.SchemaVersion,
+	}
+}
+
+// consume runs queryActivityCount right away and then every interval until
+// ctx is done, timing every query
+func consume(ctx context.Context, containerClient *azcosmos.ContainerClient, interval time.Duration, board *dashboard) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		started := time.Now()
+		counts, charge, err := queryActivityCount(ctx, containerClient)
+		if ctx.Err() != nil {
+			return
+		}
+		board.recordQuery(time.Since(started), counts, charge, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queryActivityCount counts the items of every activity across the container.
+// A cross partition GROUP BY returns one partial group per partition, so the
+// counts are summed per activity
+func queryActivityCount(ctx context.Context, containerClient *azcosmos.ContainerClient) (map[string]int, float64, error) {
+	query := "SELECT c.activity, COUNT(1) AS cnt FROM c GROUP BY c.activity"
+
+	// the analytics side reads every tenant, so this is a cross partition query
+	emptyPartitionKey := azcosmos.NewPartitionKey()
+
+	pager := containerClient.NewQueryItemsPager(query, emptyPartitionKey, nil)
+
+	counts := map[string]int{}
+	var totalCharge float64
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, totalCharge, fmt.Errorf("failed to count activities: %w", err)
+		}
+		totalCharge += float64(page.RequestCharge)
+
+		for _, _item := range page.Items {
+			var group struct {
+				Activity string `json:"activity"`
+				Count    int    `json:"cnt"`
+			}
+			if err := json.Unmarshal(_item, &group); err != nil {
+				return nil, totalCharge, fmt.Errorf("failed to unmarshal activity count: %w", err)
+			}
+			counts[group.Activity] += group.Count
+		}
+	}
+
+	return counts, totalCharge, nil
+}
+
+// recordWrite counts a producer write and the RUs it consumed
+func (d *dashboard) recordWrite(charge float64, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.charge += charge
+	if err != nil {
+		d.failed++
+		d.lastError = err
+		return
+	}
+	d.produced++
+}
+
+// recordQuery counts a consumer query with its latency and RU charge
+func (d *dashboard) recordQuery(latency time.Duration, counts map[string]int, charge float64, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.charge += charge
+	d.queries++
+	d.lastLatency = latency
+	if err != nil {
+		d.queryErrors++
+		d.lastError = err
+		return
+	}
+	d.counts = counts
+}
+
+// run redraws the dashboard line in place until ctx is done
+func (d *dashboard) run(ctx context.Context, start time.Time) {
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Print("\r\033[K")
+			return
+		case <-ticker.C:
+			fmt.Print("\r\033[K" + d.line(time.Since(start)))
+		}
+	}
+}
+
+// line formats producer throughput, consumer latency and the RU spend so far
+func (d *dashboard) line(elapsed time.Duration) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return fmt.Sprintf(" Producer: %d written, %.1f/s, %d failed | Consumer: %d queries, last %v | RU: %.2f",
+		d.produced, float64(d.produced)/elapsed.Seconds(), d.failed, d.queries, d.lastLatency.Round(time.Millisecond), d.charge)
+}
+
+// printSummary prints the final numbers and the latest activity counts
+func (d *dashboard) printSummary(elapsed time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Printf("\n📊 Pipeline Summary:\n")
+	fmt.Printf(" Sessions written: %d (%.1f/s)\n", d.produced, float64(d.produced)/elapsed.Seconds())
+	if d.failed > 0 {
+		fmt.Printf(" Failed writes: %d\n", d.failed)
+	}
+	fmt.Printf(" Activity count queries: %d\n", d.queries)
+	if d.queryErrors > 0 {
+		fmt.Printf(" Failed queries: %d\n", d.queryErrors)
+	}
+	if d.lastError != nil {
+		fmt.Printf(" Last error: %v\n", d.lastError)
+	}
+	fmt.Printf(" Total RU consumed: %.2f\n", d.charge)
+	fmt.Printf(" Elapsed: %v\n", elapsed.Round(time.Millisecond))
+
+	if len(d.counts) == 0 {
+		return
+	}
+	activityNames := make([]string, 0, len(d.counts))
+	for activity := range d.counts {
+		activityNames = append(activityNames, activity)
+	}
+	sort.Slice(activityNames, func(i, j int) bool { return d.counts[activityNames[i]] > d.counts[activityNames[j]] })
+	fmt.Printf("\n Activities at the last query:\n")
+	for _, activity := range activityNames {
+		fmt.Printf("  %-20s %d\n", activity, d.counts[activity])
+	}
+}
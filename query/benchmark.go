@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// benchmarkPattern is a single query pattern measured by runBenchmark
+type benchmarkPattern struct {
+	name string
+	pk   partitionKey
+	run  func(ctx context.Context) (float64, error)
+}
+
+// benchmarkStats holds the RU charge and latency samples for one pattern
+type benchmarkStats struct {
+	charges   []float64
+	latencies []time.Duration
+	failures  int
+	timeouts  int // failures that ran past -op-timeout
+}
+
+// runBenchmark runs each query pattern iterations times against the same
+// partition and prints min/max/avg/p95 of RU charge and latency per pattern
+func runBenchmark(ctx context.Context, iterations int, tenantID, userID, sessionID, id string) error {
+	if iterations < 1 {
+		return fmt.Errorf("iterations must be at least 1, got %d", iterations)
+	}
+
+	pkFull := newPartitionKey(tenantID, userID, sessionID)
+
+	// point reads need an id, so pick the first item of the session when none is given
+	if id == "" {
+		pager, err := newQueryPager(container, "SELECT TOP 1 c.id FROM c", pkFull, nil)
+		if err != nil {
+			return fmt.Errorf("failed to find an item for point reads: %w", err)
+		}
+		for pager.More() && id == "" {
+			page, err := nextPage(ctx, pager, pkFull)
+			if err != nil {
+				return fmt.Errorf("failed to find an item for point reads: %w", err)
+			}
+			for _, _item := range page.Items {
+				var item struct {
+					ID string `json:"id"`
+				}
+				if err := json.Unmarshal(_item, &item); err != nil {
+					return fmt.Errorf("failed to unmarshal item: %w", err)
+				}
+				id = item.ID
+				break
+			}
+		}
+		if id == "" {
+			return fmt.Errorf("no items found for %s/%s/%s, pass -id or load data first", tenantID, userID, sessionID)
+		}
+	}
+
+	emptyPartitionKey := newPartitionKey()
+
+	patterns := []benchmarkPattern{
+		{
+			name: "point read (full key + id)",
+			pk:   pkFull,
+			run: func(ctx context.Context) (float64, error) {
+				resp, err := readItem(ctx, container, pkFull, id, nil)
+				if err != nil {
+					return 0, err
+				}
+				return float64(resp.RequestCharge), nil
+			},
+		},
+		{
+			name: "query (full key)",
+			pk:   pkFull,
+			run: func(ctx context.Context) (float64, error) {
+				return queryCharge(ctx, "SELECT * FROM c WHERE c.tenantId = @tenantId AND c.userId = @userId AND c.sessionId = @sessionId", pkFull, []azcosmos.QueryParameter{
+					{Name: "@tenantId", Value: tenantID},
+					{Name: "@userId", Value: userID},
+					{Name: "@sessionId", Value: sessionID},
+				})
+			},
+		},
+		{
+			name: "query (tenantId + userId)",
+			pk:   emptyPartitionKey,
+			run: func(ctx context.Context) (float64, error) {
+				return queryCharge(ctx, "SELECT * FROM c WHERE c.tenantId = @tenantId AND c.userId = @userId", emptyPartitionKey, []azcosmos.QueryParameter{
+					{Name: "@tenantId", Value: tenantID},
+					{Name: "@userId", Value: userID},
+				})
+			},
+		},
+		{
+			name: "query (sessionId only, cross partition)",
+			pk:   emptyPartitionKey,
+			run: func(ctx context.Context) (float64, error) {
+				return queryCharge(ctx, "SELECT * FROM c WHERE c.sessionId = @sessionId", emptyPartitionKey, []azcosmos.QueryParameter{
+					{Name: "@sessionId", Value: sessionID},
+				})
+			},
+		},
+	}
+
+	fmt.Printf("Benchmarking %d query patterns, %d iterations each\n", len(patterns), iterations)
+	fmt.Println("==========================================")
+
+	for _, pattern := range patterns {
+		if isCrossPartition(pattern.pk) && !allowCrossPartition {
+			fmt.Println(pattern.name)
+			fmt.Println(" Skipped: fans out to every partition, pass -allow-cross-partition to include it")
+			fmt.Println("==========================================")
+			continue
+		}
+		var stats benchmarkStats
+		for range iterations {
+			start := time.Now()
+			charge, err := pattern.run(ctx)
+			latency := time.Since(start)
+			if err != nil {
+				stats.failures++
+				if errors.Is(err, timeout.ErrOpTimeout) {
+					stats.timeouts++
+				}
+				fmt.Printf(" %s failed: %v\n", pattern.name, err)
+				continue
+			}
+			stats.charges = append(stats.charges, charge)
+			stats.latencies = append(stats.latencies, latency)
+		}
+		printBenchmarkStats(pattern.name, describeRouting(pattern.pk), stats)
+	}
+
+	return nil
+}
+
+// queryCharge runs a query to completion and returns the RU charge summed over all pages
+func queryCharge(ctx context.Context, query string, pk partitionKey, params []azcosmos.QueryParameter) (float64, error) {
+	pager, err := newQueryPager(container, query, pk, &azcosmos.QueryOptions{
+		QueryParameters: params,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	_, charge, err := drainPager(ctx, pager, pk)
+	return charge, err
+}
+
+// printBenchmarkStats prints the routing class and min/max/avg/p95 of RU charge
+// and latency for one pattern
+func printBenchmarkStats(name, routing string, stats benchmarkStats) {
+	fmt.Println(name)
+	fmt.Printf(" Routing: %s\n", routing)
+	if len(stats.charges) == 0 {
+		fmt.Printf(" no successful runs (%d failed, %d timed out)\n", stats.failures, stats.timeouts)
+		fmt.Println("==========================================")
+		return
+	}
+
+	charges := append([]float64(nil), stats.charges...)
+	sort.Float64s(charges)
+	latencies := append([]time.Duration(nil), stats.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var chargeSum float64
+	for _, charge := range charges {
+		chargeSum += charge
+	}
+	var latencySum time.Duration
+	for _, latency := range latencies {
+		latencySum += latency
+	}
+	n := len(charges)
+
+	fmt.Printf(" RU:      min %.2f  max %.2f  avg %.2f  p95 %.2f\n",
+		charges[0], charges[n-1], chargeSum/float64(n), charges[percentileIndex(n, 0.95)])
+	fmt.Printf(" Latency: min %v  max %v  avg %v  p95 %v\n",
+		latencies[0], latencies[n-1], latencySum/time.Duration(n), latencies[percentileIndex(n, 0.95)])
+	if stats.failures > 0 {
+		fmt.Printf(" Failed runs: %d (%d timed out)\n", stats.failures, stats.timeouts)
+	}
+	fmt.Println("==========================================")
+}
+
+// percentileIndex returns the index of the p-th percentile in a sorted slice of length n
+func percentileIndex(n int, p float64) int {
+	index := int(math.Ceil(p*float64(n))) - 1
+	if index < 0 {
+		return 0
+	}
+	return index
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/config"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/diag"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/pii"
+)
+
+// query modes selectable with -query-mode
+var queryModes = []string{"demo", "history", "latest-per-user", "list-tenants", "hot-partitions", "tenant-sessions", "count", "read-your-writes", "custom", "session-durations", "recent-sessions", "query-metrics", "tenant-isolation", "export"}
+
+// output formats selectable with -output
+var outputFormats = []string{"table", "json"}
+
+// configuration for Azure Cosmos DB connection and the queries to run
+type Config struct {
+	config.Connection
+	QueryMode  string
+	Window     time.Duration
+	Limit      int
+	Benchmark  bool
+	Iterations int
+	TenantID   string
+	UserID     string
+	SessionID  string
+	ID         string
+	Debug      bool
+	Threshold  float64
+
+	AllowCrossPartition bool
+	TenantsContainer    string
+
+	// PKLevels is the depth of the container's partition key. Keys are built
+	// with at most that many levels, and it tells a full key from a prefix in
+	// the routing report
+	PKLevels int
+	PIIKey   []byte
+
+	ConsistencyLevel *azcosmos.ConsistencyLevel
+
+	// Count prints only the number of sessions matching -tenant and, when
+	// given on the command line, -user and -session
+	Count      bool
+	UserSet    bool
+	SessionSet bool
+
+	SQL    string
+	Params []azcosmos.QueryParameter
+
+	OpTimeout time.Duration
+	Deadline  time.Duration
+
+	// Containers lists containers with the same schema that the session and
+	// history queries fan out to, instead of -container alone
+	Containers []string
+
+	// Verbose prints request diagnostics of failed requests, Redact hashes
+	// the partition key values in them
+	Verbose bool
+	Redact  bool
+
+	// Diagnostics prints every HTTP request the SDK sent for each read and
+	// query page: the endpoint, status, latency and RU charge of every retry
+	Diagnostics bool
+
+	// Output is the format of -query-mode session-durations, one of outputFormats
+	Output string
+
+	// Fields projects the history and recent-sessions queries to these fields
+	Fields []string
+
+	// Keep leaves the item of -query-mode read-your-writes in the container
+	Keep bool
+}
+
+// loadConfig defines the query flags, parses args and validates the result
+func loadConfig(args []string) (Config, error) {
+	loader := config.NewLoader("query")
+	fs := loader.FlagSet
+
+	var cfg Config
+	var encryptionKey string
+	var consistency string
+	fs.StringVar(&cfg.QueryMode, "query-mode", "demo", fmt.Sprintf("Query to run: one of %v", queryModes))
+	fs.DurationVar(&cfg.Window, "window", 24*time.Hour, "Time window for -query-mode history, e.g. 24h")
+	fs.IntVar(&cfg.Limit, "limit", 1000, "Maximum number of results for -query-mode history and recent-sessions")
+	fs.BoolVar(&cfg.Benchmark, "benchmark", false, "Benchmark each query pattern instead of running the demo queries")
+	fs.IntVar(&cfg.Iterations, "iterations", 10, "Number of runs per query pattern in -benchmark mode")
+	fs.StringVar(&cfg.TenantID, "tenant", "MidMarket-Inc", "Tenant ID used by -benchmark and query modes, and checked by -query-mode tenant-isolation")
+	fs.StringVar(&cfg.UserID, "user", "user-192", "User ID used by -benchmark and query modes")
+	fs.StringVar(&cfg.SessionID, "session", "session-5af6ab47", "Session ID used by -benchmark and -query-mode read-your-writes")
+	fs.StringVar(&cfg.ID, "id", "", "Item ID used for point reads in -benchmark (default: first item of the session)")
+	fs.Float64Var(&cfg.Threshold, "threshold", 0.1, "Share of all items (0.0-1.0) above which -query-mode hot-partitions reports a partition")
+	fs.StringVar(&cfg.TenantsContainer, "tenants-container", "Tenants", "Tenants reference container read by -query-mode tenant-sessions")
+	fs.StringVar(&encryptionKey, "encryption-key", "", "Hex encoded 32 byte key used by the loader's -encrypt-pii, encrypts -user and -session and decrypts results")
+	fs.BoolVar(&cfg.AllowCrossPartition, "allow-cross-partition", false, "Allow queries without a partition key, such as the demo's single field queries, counts, tenant lists, hot partitions and -sql, to fan out to every partition")
+	fs.IntVar(&cfg.PKLevels, "pk-levels", 3, "Number of partition key levels of the container: 1 (/tenantId), 2 (+/userId) or 3 (+/sessionId)")
+	fs.IntVar(&cfg.PKLevels, "pk-depth", 3, "Alias for -pk-levels")
+	fs.StringVar(&consistency, "consistency", "", "Consistency of reads and queries: session, eventual or bounded, weaker than the account default (default: account default)")
+	fs.BoolVar(&cfg.Count, "count", false, "Only count the sessions of -tenant, narrowed by -user and -session when given, instead of running -query-mode")
+	fs.StringVar(&cfg.SQL, "sql", "", "Cosmos SQL run across all partitions by -query-mode custom and query-metrics, e.g. \"SELECT * FROM c WHERE c.activity = @activity\"")
+	fs.Func("param", "Query parameter name=value for -sql, repeatable, e.g. -param activity=login (JSON values such as 10 or true keep their type)", func(value string) error {
+		param, err := parseQueryParameter(value)
+		if err != nil {
+			return err
+		}
+		cfg.Params = append(cfg.Params, param)
+		return nil
+	})
+	fs.DurationVar(&cfg.OpTimeout, "op-timeout", 0, "Time limit of a single page fetch or point read (0 means no limit)")
+	fs.DurationVar(&cfg.Deadline, "deadline", 0, "Time limit of the whole run, e.g. 5m (0 means no limit)")
+	fs.Func("containers", "Comma-separated containers with the same schema queried together by the session and history queries, e.g. Sessions-EU,Sessions-US (default: -container)", func(value string) error {
+		cfg.Containers = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" && !slices.Contains(cfg.Containers, name) {
+				cfg.Containers = append(cfg.Containers, name)
+			}
+		}
+		if len(cfg.Containers) == 0 {
+			return fmt.Errorf("no container names in %q", value)
+		}
+		return nil
+	})
+	fs.Func("fields", "Comma-separated fields fetched by -query-mode history and recent-sessions instead of whole documents, e.g. activity,timestamp (fewer fields cost fewer RUs)", func(value string) error {
+		cfg.Fields = nil
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" || slices.Contains(cfg.Fields, field) {
+				continue
+			}
+			if !fieldNamePattern.MatchString(field) {
+				return fmt.Errorf("invalid field name %q", field)
+			}
+			cfg.Fields = append(cfg.Fields, field)
+		}
+		if len(cfg.Fields) == 0 {
+			return fmt.Errorf("no field names in %q", value)
+		}
+		return nil
+	})
+	fs.StringVar(&cfg.Output, "output", "table", fmt.Sprintf("Output format of -query-mode session-durations: one of %v", outputFormats))
+	fs.BoolVar(&cfg.Verbose, "verbose", false, "Print the status, substatus, activity ID and RU charge of every failed read or query, for support tickets")
+	fs.BoolVar(&cfg.Redact, "redact", false, "Replace partition key values in -verbose diagnostics with a short hash")
+	fs.BoolVar(&cfg.Diagnostics, "diagnostics", false, "Print the endpoint, status, latency and RU charge of every request the SDK sent for each read and query page, including its own retries")
+	fs.BoolVar(&cfg.Keep, "keep", false, "Keep the item -query-mode read-your-writes writes instead of deleting it after the check")
+	fs.BoolVar(&cfg.Debug, "debug", false, "Enable debug logging")
+
+	connection, err := loader.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Connection = connection
+	if cfg.Diagnostics {
+		cfg.PerRetryPolicies = append(cfg.PerRetryPolicies, diag.TracePolicy())
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "user":
+			cfg.UserSet = true
+		case "session":
+			cfg.SessionSet = true
+		}
+	})
+	if cfg.Count && cfg.SessionSet && !cfg.UserSet {
+		return Config{}, fmt.Errorf("-count with -session also needs -user, a partition key prefix cannot skip a level")
+	}
+
+	if !slices.Contains(queryModes, cfg.QueryMode) {
+		return Config{}, fmt.Errorf("invalid -query-mode %q: must be one of %v", cfg.QueryMode, queryModes)
+	}
+	if !slices.Contains(outputFormats, cfg.Output) {
+		return Config{}, fmt.Errorf("invalid -output %q: must be one of %v", cfg.Output, outputFormats)
+	}
+	if cfg.QueryMode == "custom" && strings.TrimSpace(cfg.SQL) == "" {
+		return Config{}, fmt.Errorf("-query-mode custom requires -sql")
+	}
+	if cfg.SQL != "" && cfg.QueryMode != "custom" && cfg.QueryMode != "query-metrics" {
+		return Config{}, fmt.Errorf("-sql requires -query-mode custom or query-metrics")
+	}
+	if len(cfg.Params) > 0 && cfg.SQL == "" {
+		return Config{}, fmt.Errorf("-param requires -sql")
+	}
+	if len(cfg.Fields) > 0 && cfg.QueryMode != "history" && cfg.QueryMode != "recent-sessions" {
+		return Config{}, fmt.Errorf("-fields requires -query-mode history or recent-sessions")
+	}
+	if cfg.Keep && cfg.QueryMode != "read-your-writes" {
+		return Config{}, fmt.Errorf("-keep requires -query-mode read-your-writes")
+	}
+	if cfg.PKLevels < 1 || cfg.PKLevels > 3 {
+		return Config{}, fmt.Errorf("invalid -pk-levels/-pk-depth %d: must be 1, 2 or 3", cfg.PKLevels)
+	}
+	if cfg.OpTimeout < 0 {
+		return Config{}, fmt.Errorf("invalid -op-timeout %v: must not be negative", cfg.OpTimeout)
+	}
+	if cfg.Deadline < 0 {
+		return Config{}, fmt.Errorf("invalid -deadline %v: must not be negative", cfg.Deadline)
+	}
+	if cfg.Limit < 1 {
+		return Config{}, fmt.Errorf("invalid -limit %d: must be at least 1", cfg.Limit)
+	}
+	if cfg.Threshold < 0 || cfg.Threshold > 1 {
+		return Config{}, fmt.Errorf("invalid -threshold %v: must be between 0.0 and 1.0", cfg.Threshold)
+	}
+	if cfg.Iterations < 1 {
+		return Config{}, fmt.Errorf("invalid -iterations %d: must be at least 1", cfg.Iterations)
+	}
+	if consistency != "" {
+		level, ok := consistencyLevels[consistency]
+		if !ok {
+			return Config{}, fmt.Errorf("invalid -consistency %q: must be session, eventual or bounded", consistency)
+		}
+		cfg.ConsistencyLevel = &level
+	}
+	if encryptionKey != "" {
+		cfg.PIIKey, err = pii.ParseKey(encryptionKey)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid -encryption-key: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/google/uuid"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// consistencyLevels maps the -consistency values to the SDK levels. A request
+// can only relax the account's default consistency, never strengthen it
+var consistencyLevels = map[string]azcosmos.ConsistencyLevel{
+	"session":  azcosmos.ConsistencyLevelSession,
+	"eventual": azcosmos.ConsistencyLevelEventual,
+	"bounded":  azcosmos.ConsistencyLevelBoundedStaleness,
+}
+
+// describeConsistency returns the consistency level reads are sent with
+func describeConsistency() string {
+	if consistencyLevel == nil {
+		return "account default"
+	}
+	return string(*consistencyLevel)
+}
+
+// itemOptions returns the ItemOptions for a read at the -consistency level,
+// carrying sessionToken when it is not empty
+func itemOptions(sessionToken string) *azcosmos.ItemOptions {
+	options := &azcosmos.ItemOptions{ConsistencyLevel: consistencyLevel}
+	if sessionToken != "" {
+		options.SessionToken = &sessionToken
+	}
+	return options
+}
+
+// runReadYourWrites writes a session item under the full hierarchical key and
+// reads it back with a point read. In session consistency the session token of
+// the write is attached to the read, so the read is guaranteed to see the write
+// even when it is served by another replica. The item is deleted afterwards
+// unless keep is set, so it does not show up in counts and reports
+func runReadYourWrites(ctx context.Context, containerClient *azcosmos.ContainerClient, tenantID, userID, sessionID string, keep bool) error {
+	pk := newPartitionKey(tenantID, userID, sessionID)
+
+	session := model.UserSession{
+		ID:            uuid.NewString(),
+		TenantID:      tenantID,
+		UserID:        userID,
+		SessionID:     sessionID,
+		Activity:      "read_your_writes",
+		Timestamp:     time.Now().UTC(),
+		SchemaVersion: model.SchemaVersion,
+	}
+	body, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	var writeResponse azcosmos.ItemResponse
+	err = timeout.WithOpTimeout(ctx, opTimeout, func(ctx context.Context) error {
+		var err error
+		writeResponse, err = containerClient.UpsertItem(ctx, pk.sdk(), body, nil)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write item: %w", err)
+	}
+	if !keep {
+		defer func() {
+			if _, err := containerClient.DeleteItem(ctx, pk.sdk(), session.ID, nil); err != nil {
+				log.Printf("Failed to delete test item %s: %v", session.ID, err)
+			}
+		}()
+	}
+
+	sessionToken := ""
+	if writeResponse.SessionToken != nil {
+		sessionToken = *writeResponse.SessionToken
+	}
+
+	// only session consistency uses the token, other levels ignore it
+	readToken := ""
+	if consistencyLevel != nil && *consistencyLevel == azcosmos.ConsistencyLevelSession {
+		readToken = sessionToken
+	}
+
+	readResponse, err := readItem(ctx, containerClient, pk, session.ID, itemOptions(readToken))
+	if err != nil {
+		return fmt.Errorf("failed to read item back: %w", err)
+	}
+
+	fmt.Printf("Write then read of item %s\n", session.ID)
+	fmt.Println("==========================================")
+	fmt.Println("Consistency:", describeConsistency())
+	fmt.Println("Write RUs consumed:", writeResponse.RequestCharge)
+	fmt.Println("Session token from write:", sessionToken)
+	if readToken != "" {
+		fmt.Println("Read sent with session token:", readToken)
+	} else {
+		fmt.Println("Read sent without session token")
+	}
+	fmt.Println("Read RUs consumed:", readResponse.RequestCharge)
+	return nil
+}
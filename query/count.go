@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// countDocuments returns the number of items in the container without reading
+// them. A cross partition COUNT comes back as one partial count per partition
+// (and page), so the values are summed across all pages
+func countDocuments(ctx context.Context, containerClient *azcosmos.ContainerClient) (int64, error) {
+	query := "SELECT VALUE COUNT(1) FROM c"
+
+	// every partition holds items, so this is a cross partition query
+	emptyPartitionKey := newPartitionKey()
+
+	pager, err := newQueryPager(containerClient, query, emptyPartitionKey, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	items, _, err := drainPager(ctx, pager, emptyPartitionKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	// VALUE projections return bare scalars rather than documents
+	counts, err := unmarshalItems[int64](items, "count")
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total, nil
+}
+
+// printDocumentCounts prints the total item count and the count per tenant
+func printDocumentCounts(ctx context.Context, containerClient *azcosmos.ContainerClient) error {
+	total, err := countDocuments(ctx, containerClient)
+	if err != nil {
+		return err
+	}
+
+	counts, err := queryPartitionCounts(ctx, containerClient, false)
+	if err != nil {
+		return err
+	}
+
+	// a tenant spread over several physical partitions comes back as one
+	// partial group per partition, so merge them by tenant
+	perTenant := map[string]int64{}
+	var tenants []string
+	for _, partitionCount := range counts {
+		if _, ok := perTenant[partitionCount.TenantId]; !ok {
+			tenants = append(tenants, partitionCount.TenantId)
+		}
+		perTenant[partitionCount.TenantId] += int64(partitionCount.Count)
+	}
+	sort.SliceStable(tenants, func(i, j int) bool {
+		return perTenant[tenants[i]] > perTenant[tenants[j]]
+	})
+
+	fmt.Printf("Documents in container: %d\n", total)
+	fmt.Println("==========================================")
+	var grouped int64
+	for _, tenant := range tenants {
+		fmt.Printf("%s: %d\n", tenant, perTenant[tenant])
+		grouped += perTenant[tenant]
+	}
+	fmt.Println("==========================================")
+
+	// documents written between the two queries make the totals differ
+	if grouped != total {
+		fmt.Printf("Note: per tenant counts add up to %d, the container changed between queries\n", grouped)
+	}
+	return nil
+}
+
+// countQuery turns a "SELECT * FROM c ..." query into one that returns only
+// the number of matching items
+func countQuery(query string) (string, error) {
+	rest, ok := strings.CutPrefix(query, "SELECT * FROM c")
+	if !ok {
+		return "", fmt.Errorf("cannot count %q: only SELECT * FROM c queries can be counted", query)
+	}
+	return "SELECT VALUE COUNT(1) FROM c" + rest, nil
+}
+
+// runCount counts the items query would return without fetching them. It
+// applies the same partition key checks as runQuery, and the partial counts of
+// every page are summed
+func runCount(ctx context.Context, containerClient *azcosmos.ContainerClient, query string, pk partitionKey, params []azcosmos.QueryParameter, opts queryOptions) (int64, float64, error) {
+	query, err := countQuery(query)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pager, err := newQueryPager(containerClient, query, pk, &azcosmos.QueryOptions{
+		QueryParameters:  params,
+		ConsistencyLevel: consistencyLevel,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	items, totalCharge, err := drainPager(ctx, pager, pk)
+	if err != nil {
+		return 0, totalCharge, fmt.Errorf("failed to count items: %w", err)
+	}
+	counts, err := unmarshalItems[int64](items, "count")
+	if err != nil {
+		return 0, totalCharge, err
+	}
+
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total, totalCharge, nil
+}
+
+// printSessionCount counts the sessions matching tenantID and whichever of
+// userID and sessionID are set, and prints the count with its RU charge
+func printSessionCount(tenantID string, userID, sessionID *string) {
+	pk, query, params, err := sessionsQuery(tenantID, userID, sessionID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	count, totalCharge, err := runCount(runContext, container, query, pk, params, queryOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("Filter:", query)
+	fmt.Println("Count:", count)
+	fmt.Println("Total RUs consumed:", totalCharge, "routing:", describeRouting(pk), "consistency:", describeConsistency())
+}
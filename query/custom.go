@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// parseQueryParameter parses a -param value of the form name=value. The name
+// gets a leading @ when it has none. Values that parse as JSON (numbers, true,
+// false, null, quoted strings, arrays) keep their type, anything else is a string
+func parseQueryParameter(value string) (azcosmos.QueryParameter, error) {
+	name, raw, found := strings.Cut(value, "=")
+	name = strings.TrimSpace(name)
+	if !found || name == "" || name == "@" {
+		return azcosmos.QueryParameter{}, fmt.Errorf("invalid -param %q: expected name=value", value)
+	}
+	if !strings.HasPrefix(name, "@") {
+		name = "@" + name
+	}
+
+	var parsed any
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		parsed = raw
+	}
+	return azcosmos.QueryParameter{Name: name, Value: parsed}, nil
+}
+
+// runCustomQuery runs sql with params across all partitions and prints every
+// item as indented JSON. Items are printed as returned, so projections and
+// aggregates work as well as whole documents
+func runCustomQuery(ctx context.Context, containerClient *azcosmos.ContainerClient, sql string, params []azcosmos.QueryParameter) error {
+	// an arbitrary query can filter on anything, so it is sent to every partition
+	emptyPartitionKey := newPartitionKey()
+
+	pager, err := newQueryPager(containerClient, sql, emptyPartitionKey, &azcosmos.QueryOptions{
+		QueryParameters:  params,
+		ConsistencyLevel: consistencyLevel,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Results for:", sql)
+	fmt.Println("==========================================")
+
+	items, totalCharge, err := drainPager(ctx, pager, emptyPartitionKey)
+	if err != nil {
+		return fmt.Errorf("failed to run query: %w", err)
+	}
+
+	for _, _item := range items {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, _item, "", "  "); err != nil {
+			return fmt.Errorf("failed to format item: %w", err)
+		}
+		fmt.Println(pretty.String())
+	}
+
+	fmt.Println("==========================================")
+	fmt.Println("Items:", len(items))
+	fmt.Println("Total RUs consumed:", totalCharge, "routing:", describeRouting(emptyPartitionKey), "consistency:", describeConsistency())
+	return nil
+}
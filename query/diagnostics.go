@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/diag"
+)
+
+// verboseDiagnostics prints request diagnostics for every failed read or query
+// page, set by the -verbose flag
+var verboseDiagnostics bool
+
+// redactDiagnostics hashes the partition key values in the diagnostics, set
+// by the -redact flag
+var redactDiagnostics bool
+
+// traceDiagnostics prints the requests the SDK sent for every read and query
+// page, set by the -diagnostics flag
+var traceDiagnostics bool
+
+// printDiagnostics prints the request diagnostics of a failed operation on pk
+// when -verbose is set. The block is written in one piece so the output of
+// concurrent queries does not interleave
+func printDiagnostics(operation string, pk partitionKey, err error) {
+	if !verboseDiagnostics {
+		return
+	}
+	var b bytes.Buffer
+	diag.FromError(operation, err, pk.values...).Print(&b, redactDiagnostics)
+	os.Stderr.Write(b.Bytes())
+}
+
+// traceOperation returns a context recording the requests of operation when
+// -diagnostics is set, and a func printing them once the operation is done
+func traceOperation(ctx context.Context, operation string) (context.Context, func()) {
+	if !traceDiagnostics {
+		return ctx, func() {}
+	}
+	ctx, trace := diag.WithTrace(ctx, operation)
+	return ctx, func() {
+		var b bytes.Buffer
+		trace.Print(&b)
+		os.Stderr.Write(b.Bytes())
+	}
+}
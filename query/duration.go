@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// incompleteDuration marks a session without a login or without a logout
+const incompleteDuration time.Duration = -1
+
+// SessionDuration is the time between the first login and the last logout of
+// a session. Duration is incompleteDuration when either event is missing
+type SessionDuration struct {
+	SessionID string
+	Start     time.Time
+	End       time.Time
+	Duration  time.Duration
+}
+
+// estimateSessionDurations reads every item of a user and correlates the login
+// and logout events of each session, ordered by session start
+func estimateSessionDurations(ctx context.Context, containerClient *azcosmos.ContainerClient, tenantID, userID string) ([]SessionDuration, error) {
+	query := "SELECT * FROM c WHERE c.tenantId = @tenantId AND c.userId = @userId"
+
+	// tenantId and userId form a prefix of the hierarchical partition key
+	pkPartial := newPartitionKey(tenantID, userID)
+
+	params := []azcosmos.QueryParameter{
+		{Name: "@tenantId", Value: tenantID},
+		{Name: "@userId", Value: userID},
+	}
+
+	items, _, err := runQuery(ctx, containerClient, query, pkPartial, params, queryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+
+	bySession := map[string]*SessionDuration{}
+	var order []string
+	for _, item := range items {
+		session, ok := bySession[item.SessionId]
+		if !ok {
+			session = &SessionDuration{SessionID: item.SessionId}
+			bySession[item.SessionId] = session
+			order = append(order, item.SessionId)
+		}
+
+		if item.Activity != "login" && item.Activity != "logout" {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, item.Timestamp)
+		if err != nil {
+			debugf("skipping %s event of item %s: %v", item.Activity, item.ID, err)
+			continue
+		}
+		// the earliest login and the latest logout bound the session
+		if item.Activity == "login" && (session.Start.IsZero() || timestamp.Before(session.Start)) {
+			session.Start = timestamp
+		}
+		if item.Activity == "logout" && timestamp.After(session.End) {
+			session.End = timestamp
+		}
+	}
+
+	durations := make([]SessionDuration, 0, len(order))
+	for _, sessionID := range order {
+		session := bySession[sessionID]
+		session.Duration = incompleteDuration
+		if !session.Start.IsZero() && !session.End.IsZero() {
+			session.Duration = session.End.Sub(session.Start)
+		}
+		durations = append(durations, *session)
+	}
+
+	// sessions without a login sort last
+	sort.SliceStable(durations, func(i, j int) bool {
+		a, b := durations[i].Start, durations[j].Start
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+	return durations, nil
+}
+
+// sessionDurationJSON is the -output json form of a SessionDuration, with the
+// missing events left out and the duration in seconds
+type sessionDurationJSON struct {
+	SessionID       string     `json:"sessionId"`
+	Start           *time.Time `json:"start,omitempty"`
+	End             *time.Time `json:"end,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds"`
+}
+
+// printSessionDurations prints the session durations as a table or as JSON
+func printSessionDurations(tenantID, userID string, durations []SessionDuration, output string) error {
+	if output == "json" {
+		sessions := make([]sessionDurationJSON, 0, len(durations))
+		for _, duration := range durations {
+			session := sessionDurationJSON{
+				SessionID:       duration.SessionID,
+				DurationSeconds: -1,
+			}
+			if !duration.Start.IsZero() {
+				session.Start = &duration.Start
+			}
+			if !duration.End.IsZero() {
+				session.End = &duration.End
+			}
+			if duration.Duration != incompleteDuration {
+				session.DurationSeconds = duration.Duration.Seconds()
+			}
+			sessions = append(sessions, session)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(sessions); err != nil {
+			return fmt.Errorf("failed to encode session durations: %w", err)
+		}
+		return nil
+	}
+
+	// the results are decrypted already, userID is the encrypted lookup value
+	plainUserID, err := decryptField(piiCipher, userID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Session durations for tenantId: %s and userId: %s (%d sessions)\n", tenantID, plainUserID, len(durations))
+	fmt.Println("==========================================")
+	fmt.Printf("%-38s %-25s %-25s %s\n", "Session", "Login", "Logout", "Duration")
+	incomplete := 0
+	for _, duration := range durations {
+		elapsed := "incomplete"
+		if duration.Duration == incompleteDuration {
+			incomplete++
+		} else {
+			elapsed = duration.Duration.Round(time.Second).String()
+		}
+		fmt.Printf("%-38s %-25s %-25s %s\n", duration.SessionID, formatEventTime(duration.Start), formatEventTime(duration.End), elapsed)
+	}
+	if incomplete > 0 {
+		fmt.Printf("%d sessions have no login or no logout\n", incomplete)
+	}
+	return nil
+}
+
+// formatEventTime formats a login or logout time, "-" when the event is missing
+func formatEventTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
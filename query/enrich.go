@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+)
+
+// EnrichedSession is a session merged with the metadata of its tenant
+type EnrichedSession struct {
+	QueryResult
+	Tenant model.Tenant `json:"tenant"`
+}
+
+// querySessionsWithTenantMetadata simulates a JOIN across containers: Cosmos DB
+// queries cannot span containers, so the tenant is point read from the tenants
+// container and merged into every session of that tenant on the client
+func querySessionsWithTenantMetadata(ctx context.Context, sessionContainer, tenantContainer *azcosmos.ContainerClient, tenantID string) ([]EnrichedSession, error) {
+	// the tenant ID is both the item ID and the partition key, a 1 RU point read
+	tenantResponse, err := readItem(ctx, tenantContainer, newPartitionKey(tenantID), tenantID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenant %s: %w", tenantID, err)
+	}
+	var tenant model.Tenant
+	if err := json.Unmarshal(tenantResponse.Value, &tenant); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tenant %s: %w", tenantID, err)
+	}
+
+	// profiles stored next to the sessions carry a type field, sessions do not
+	query := "SELECT * FROM c WHERE c.tenantId = @tenantId AND NOT IS_DEFINED(c.type)"
+
+	// tenantId alone is the first level of the hierarchical partition key
+	pkPrefix := newPartitionKey(tenantID)
+
+	sessions, charge, err := runQuery(ctx, sessionContainer, query, pkPrefix, []azcosmos.QueryParameter{
+		{Name: "@tenantId", Value: tenantID},
+	}, queryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions of tenant %s: %w", tenantID, err)
+	}
+	debugf("tenant point read %.2f RU, session query %.2f RU", tenantResponse.RequestCharge, charge)
+
+	enriched := make([]EnrichedSession, len(sessions))
+	for i, session := range sessions {
+		enriched[i] = EnrichedSession{QueryResult: session, Tenant: tenant}
+	}
+	return enriched, nil
+}
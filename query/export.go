@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// exportSessions streams the sessions of tenantID, narrowed to userID when
+// given, to w as NDJSON. Items are written as queryStream delivers them, so
+// memory does not grow with the result set
+func exportSessions(ctx context.Context, w io.Writer, tenantID string, userID *string) (int, error) {
+	query := "SELECT * FROM c WHERE c.tenantId = @tenantId"
+	pk := newPartitionKey(tenantID)
+	params := []azcosmos.QueryParameter{{Name: "@tenantId", Value: tenantID}}
+	if userID != nil {
+		query += " AND c.userId = @userId"
+		pk = pk.append(*userID)
+		params = append(params, azcosmos.QueryParameter{Name: "@userId", Value: *userID})
+	}
+
+	// stops the query when writing fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results, errs := queryStream(ctx, query, params, pk)
+	encoder := json.NewEncoder(w)
+	exported := 0
+	var writeErr error
+	for queryResult := range results {
+		if writeErr != nil {
+			continue
+		}
+		if err := encoder.Encode(queryResult); err != nil {
+			writeErr = fmt.Errorf("failed to write session %s: %w", queryResult.ID, err)
+			cancel()
+			continue
+		}
+		exported++
+	}
+	if writeErr != nil {
+		return exported, writeErr
+	}
+	if err := <-errs; err != nil {
+		return exported, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	return exported, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/config"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+)
+
+// the emulator's well known account key, COSMOS_EMULATOR_KEY overrides it
+const emulatorKey = "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XyIDqw=="
+
+// size of the dataset seedEmulator writes
+const (
+	testTenants  = 3
+	testUsers    = 2
+	testSessions = 2
+	testEvents   = 3
+)
+
+// openEmulatorContainer creates a database and a container with the
+// hierarchical partition key on the emulator at COSMOS_EMULATOR_ENDPOINT and
+// deletes the database when the test ends. The test is skipped without it
+func openEmulatorContainer(t *testing.T) *azcosmos.ContainerClient {
+	t.Helper()
+	endpoint := os.Getenv("COSMOS_EMULATOR_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("COSMOS_EMULATOR_ENDPOINT is not set, e.g. https://localhost:8081")
+	}
+	key := os.Getenv("COSMOS_EMULATOR_KEY")
+	if key == "" {
+		key = emulatorKey
+	}
+
+	cred, err := azcosmos.NewKeyCredential(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := azcosmos.NewClientWithKey(endpoint, cred, config.ClientOptions(endpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	databaseName := fmt.Sprintf("query-test-%d", time.Now().UnixNano())
+	if _, err := client.CreateDatabase(ctx, azcosmos.DatabaseProperties{ID: databaseName}, nil); err != nil {
+		t.Skipf("emulator at %s is not reachable: %v", endpoint, err)
+	}
+	t.Cleanup(func() {
+		database, err := client.NewDatabase(databaseName)
+		if err == nil {
+			_, err = database.Delete(context.Background(), nil)
+		}
+		if err != nil {
+			t.Logf("failed to delete database %s: %v", databaseName, err)
+		}
+	})
+
+	database, err := client.NewDatabase(databaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := azcosmos.ContainerProperties{
+		ID: "UserSessions",
+		PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{
+			Kind:    azcosmos.PartitionKeyKindMultiHash,
+			Version: 2,
+			Paths:   []string{"/tenantId", "/userId", "/sessionId"},
+		},
+	}
+	if _, err := database.CreateContainer(ctx, properties, nil); err != nil {
+		t.Fatalf("failed to create container: %v", err)
+	}
+	containerClient, err := database.NewContainer(properties.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return containerClient
+}
+
+// seedEmulator writes testEvents events for every session of every user of
+// every tenant, with activities drawn from a fixed seed, and returns them by id
+func seedEmulator(t *testing.T, containerClient *azcosmos.ContainerClient) map[string]QueryResult {
+	t.Helper()
+	rng := rand.New(rand.NewSource(54))
+	activities := []string{"login", "view_dashboard", "edit_document", "logout"}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	written := make(map[string]QueryResult)
+	for tenant := range testTenants {
+		for user := range testUsers {
+			for session := range testSessions {
+				for event := range testEvents {
+					item := QueryResult{
+						ID:            fmt.Sprintf("t%d-u%d-s%d-e%d", tenant, user, session, event),
+						TenantId:      fmt.Sprintf("tenant-%d", tenant),
+						UserId:        fmt.Sprintf("user-%d", user),
+						SessionId:     fmt.Sprintf("session-%d", session),
+						Activity:      activities[rng.Intn(len(activities))],
+						Timestamp:     start.Add(time.Duration(rng.Intn(3600)) * time.Second).Format(time.RFC3339),
+						SchemaVersion: model.SchemaVersion,
+					}
+					body, err := json.Marshal(item)
+					if err != nil {
+						t.Fatal(err)
+					}
+					pk := newPartitionKey(item.TenantId, item.UserId, item.SessionId).sdk()
+					if _, err := containerClient.CreateItem(context.Background(), pk, body, nil); err != nil {
+						t.Fatalf("failed to write %s: %v", item.ID, err)
+					}
+					written[item.ID] = item
+				}
+			}
+		}
+	}
+	return written
+}
+
+func TestEmulatorRoundTrip(t *testing.T) {
+	containerClient := openEmulatorContainer(t)
+	written := seedEmulator(t, containerClient)
+
+	// the query helpers read the container the command line selected
+	container = containerClient
+	containers = []*azcosmos.ContainerClient{containerClient}
+	t.Cleanup(func() {
+		container = nil
+		containers = nil
+	})
+
+	userID := "user-1"
+	sessionID := "session-0"
+	tests := []struct {
+		name      string
+		userID    *string
+		sessionID *string
+		want      int
+	}{
+		{"full partition key", &userID, &sessionID, testEvents},
+		{"tenant and user prefix", &userID, nil, testSessions * testEvents},
+		{"tenant prefix", nil, nil, testUsers * testSessions * testEvents},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, charge, err := querySessions("tenant-2", tt.userID, tt.sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != tt.want {
+				t.Errorf("got %d results, want %d", len(results), tt.want)
+			}
+			if charge <= 0 {
+				t.Errorf("charge = %v, want it above 0", charge)
+			}
+			for _, result := range results {
+				if result != written[result.ID] {
+					t.Errorf("result %+v differs from the written item %+v", result, written[result.ID])
+				}
+				if result.TenantId != "tenant-2" || (tt.userID != nil && result.UserId != userID) || (tt.sessionID != nil && result.SessionId != sessionID) {
+					t.Errorf("result %s is outside the partition key of the query", result.ID)
+				}
+			}
+		})
+	}
+
+	t.Run("point read", func(t *testing.T) {
+		want := written["t1-u0-s1-e2"]
+		got, err := executePointRead(want.ID, want.TenantId, want.UserId, want.SessionId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("read %+v, want %+v", *got, want)
+		}
+
+		resp, err := readItem(runContext, container, newPartitionKey(want.TenantId, want.UserId, want.SessionId), want.ID, itemOptions(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.RequestCharge <= 0 {
+			t.Errorf("charge = %v, want it above 0", resp.RequestCharge)
+		}
+	})
+}
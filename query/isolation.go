@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// maxLeakedIDs caps the document IDs listed in a tenant isolation error
+const maxLeakedIDs = 20
+
+// validateTenantIsolation runs an unfiltered SELECT * FROM c scoped to the
+// partition key of tenantID and fails when any returned item belongs to another
+// tenant than expectedTenantID. The query has no WHERE clause on purpose, so
+// only the hierarchical partition key keeps other tenants out of the results.
+// The tenant level alone is a prefix of the full tenantId/userId/sessionId key
+// and covers every user and session of the tenant
+func validateTenantIsolation(ctx context.Context, containerClient *azcosmos.ContainerClient, tenantID, expectedTenantID string) error {
+	query := "SELECT * FROM c"
+	pk := newPartitionKey(tenantID)
+
+	results, charge, err := runQuery(ctx, containerClient, query, pk, nil, queryOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to query tenant %s: %w", tenantID, err)
+	}
+	debugf("tenant isolation: %d items for tenant %s, %.2f RUs", len(results), tenantID, charge)
+
+	var leaked []string
+	for _, result := range results {
+		if result.TenantId != expectedTenantID {
+			leaked = append(leaked, fmt.Sprintf("%s (tenantId %s)", result.ID, result.TenantId))
+		}
+	}
+	if len(leaked) == 0 {
+		return nil
+	}
+
+	listed := leaked
+	if len(listed) > maxLeakedIDs {
+		listed = listed[:maxLeakedIDs]
+	}
+	message := strings.Join(listed, ", ")
+	if len(leaked) > len(listed) {
+		message += fmt.Sprintf(" and %d more", len(leaked)-len(listed))
+	}
+	return fmt.Errorf("tenant isolation violated: %d of %d items returned for tenant %s do not belong to %s: %s",
+		len(leaked), len(results), tenantID, expectedTenantID, message)
+}
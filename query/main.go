@@ -3,59 +3,314 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/pii"
 )
 
 type QueryResult struct {
-	ID        string `json:"id"`
-	TenantId  string `json:"tenantId"`
-	UserId    string `json:"userId"`
-	SessionId string `json:"sessionId"`
-	Activity  string `json:"activity"`
-	Timestamp string `json:"timestamp"`
+	ID            string `json:"id"`
+	TenantId      string `json:"tenantId"`
+	UserId        string `json:"userId"`
+	SessionId     string `json:"sessionId"`
+	Activity      string `json:"activity"`
+	Timestamp     string `json:"timestamp"`
+	SchemaVersion int    `json:"schemaVersion"`
+	DeviceType    string `json:"deviceType,omitempty"`
+	IPAddress     string `json:"ipAddress,omitempty"`
+	Country       string `json:"country,omitempty"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	Anomalous     bool   `json:"anomalous,omitempty"`
+	AnomalyType   string `json:"anomalyType,omitempty"`
+}
+
+// PartitionCount holds the item count for a tenant (and optionally user) group
+type PartitionCount struct {
+	TenantId string `json:"tenantId"`
+	UserId   string `json:"userId,omitempty"`
+	Count    int    `json:"cnt"`
+}
+
+// UserLatestActivity holds the most recent activity timestamp of a user
+type UserLatestActivity struct {
+	UserId          string `json:"userId"`
+	LatestTimestamp string `json:"latestTimestamp"`
 }
 
 var container *azcosmos.ContainerClient
 
-func init() {
-	endpoint := os.Getenv("COSMOS_DB_ENDPOINT")
-	if endpoint == "" {
-		log.Fatal("COSMOS_DB_ENDPOINT is not set")
+// debugLogging enables debugf output, set by the -debug flag
+var debugLogging bool
+
+// piiCipher decrypts userId and sessionId written with -encrypt-pii, set by
+// the -encryption-key flag
+var piiCipher *pii.Cipher
+
+// allowCrossPartition lets queries without a partition key fan out to every
+// partition, set by the -allow-cross-partition flag
+var allowCrossPartition bool
+
+// consistencyLevel overrides the account default consistency of reads and
+// queries, set by the -consistency flag
+var consistencyLevel *azcosmos.ConsistencyLevel
+
+func main() {
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	debugLogging = config.Debug
+	allowCrossPartition = config.AllowCrossPartition
+	partitionKeyLevels = config.PKLevels
+	consistencyLevel = config.ConsistencyLevel
+	opTimeout = config.OpTimeout
+	verboseDiagnostics = config.Verbose
+	redactDiagnostics = config.Redact
+	traceDiagnostics = config.Diagnostics
+	if config.Deadline > 0 {
+		var cancel context.CancelFunc
+		runContext, cancel = context.WithTimeout(runContext, config.Deadline)
+		defer cancel()
+	}
+
+	// encryption is deterministic, so encrypted lookup values match stored ones
+	if config.PIIKey != nil {
+		piiCipher, err = pii.NewCipher(config.PIIKey)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		config.UserID = piiCipher.Encrypt(config.UserID)
+		config.SessionID = piiCipher.Encrypt(config.SessionID)
 	}
 
-	dbName := os.Getenv("COSMOS_DB_DATABASE_NAME")
-	if dbName == "" {
-		log.Fatal("COSMOS_DB_DATABASE_NAME is not set")
+	client, err := config.OpenClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// confirm which regional endpoint the region settings route to
+	if regions := config.Regions(); len(regions) > 0 {
+		fmt.Println("Preferred regions:", strings.Join(regions, ", "))
+		host, err := config.ServingEndpoint(runContext, client)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Connectivity check: first request served by", host)
 	}
 
-	containerName := os.Getenv("COSMOS_DB_CONTAINER_NAME")
-	if containerName == "" {
-		log.Fatal("COSMOS_DB_CONTAINER_NAME is not set")
+	database, err := client.NewDatabase(config.DatabaseName)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	_, err := getClient(endpoint)
+	container, err = database.NewContainer(config.ContainerName)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	containers = []*azcosmos.ContainerClient{container}
+	if len(config.Containers) > 0 {
+		containers = nil
+		for _, name := range config.Containers {
+			containerClient, err := database.NewContainer(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			containers = append(containers, containerClient)
+		}
+		fmt.Println("Querying containers:", strings.Join(config.Containers, ", "))
+	}
+
+	if config.Benchmark {
+		err := runBenchmark(runContext, config.Iterations, config.TenantID, config.UserID, config.SessionID, config.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if config.Count {
+		var userID, sessionID *string
+		if config.UserSet {
+			userID = &config.UserID
+		}
+		if config.SessionSet {
+			sessionID = &config.SessionID
+		}
+		printSessionCount(config.TenantID, userID, sessionID)
+		return
+	}
+
+	switch config.QueryMode {
+	case "demo":
+		runDemoQueries()
+	case "history":
+		history, err := getUserSessionHistory(runContext, containers, config.TenantID, config.UserID, config.Window, config.Limit, config.Fields)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Session history for tenantId: %s and userId: %s over the last %v (%d results)\n", config.TenantID, config.UserID, config.Window, len(history))
+		fmt.Println("==========================================")
+		for _, queryResult := range history {
+			fmt.Println("Timestamp:", queryResult.Timestamp)
+			printClientDetails(queryResult)
+			fmt.Println("Session ID:", queryResult.SessionId)
+			fmt.Println("Activity:", queryResult.Activity)
+			fmt.Println("==========================================")
+		}
+	case "latest-per-user":
+		latest, err := getLatestSessionPerUser(runContext, container, config.TenantID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Latest activity per user for tenantId: %s (%d users)\n", config.TenantID, len(latest))
+		fmt.Println("==========================================")
+		for _, userLatest := range latest {
+			userID, err := decryptField(piiCipher, userLatest.UserId)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s: %s\n", userID, userLatest.LatestTimestamp)
+		}
+	case "hot-partitions":
+		hot, err := detectHotPartitions(runContext, container, config.Threshold)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Partitions above %.1f%% of all items: %d\n", config.Threshold*100, len(hot))
+		for _, partition := range hot {
+			fmt.Printf("WARNING: hot partition %s / %s holds %d items (%.1f%%)\n", partition.TenantID, partition.UserID, partition.Count, partition.Fraction*100)
+		}
+	case "tenant-sessions":
+		tenantContainer, err := database.NewContainer(config.TenantsContainer)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessions, err := querySessionsWithTenantMetadata(runContext, container, tenantContainer, config.TenantID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Sessions for tenantId: %s with tenant metadata (%d results)\n", config.TenantID, len(sessions))
+		fmt.Println("==========================================")
+		for _, session := range sessions {
+			fmt.Println("Session ID:", session.SessionId)
+			fmt.Println("User ID:", session.UserId)
+			fmt.Println("Activity:", session.Activity)
+			fmt.Println("Timestamp:", session.Timestamp)
+			fmt.Printf("Tenant users: %d..%d, sessions weight: %d\n", session.Tenant.UserMin, session.Tenant.UserMax, session.Tenant.Sessions)
+			fmt.Println("==========================================")
+		}
+	case "count":
+		err := printDocumentCounts(runContext, container)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "read-your-writes":
+		err := runReadYourWrites(runContext, container, config.TenantID, config.UserID, config.SessionID, config.Keep)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "custom":
+		err := runCustomQuery(runContext, container, config.SQL, config.Params)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "session-durations":
+		durations, err := estimateSessionDurations(runContext, container, config.TenantID, config.UserID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = printSessionDurations(config.TenantID, config.UserID, durations, config.Output)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "recent-sessions":
+		// only narrowed to a user when -user is given on the command line
+		var userID *string
+		if config.UserSet {
+			userID = &config.UserID
+		}
+		err := printRecentSessions(runContext, container, config.TenantID, userID, config.Limit, config.Fields)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "export":
+		var userID *string
+		if config.UserSet {
+			userID = &config.UserID
+		}
+		// the sessions go to stdout, so the summary goes to stderr
+		exported, err := exportSessions(runContext, os.Stdout, config.TenantID, userID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d sessions for tenantId: %s (consistency: %s)\n", exported, config.TenantID, describeConsistency())
+	case "query-metrics":
+		queries := sampleMetricsQueries(config.TenantID, config.UserID)
+		if config.SQL != "" {
+			queries = []metricsQuery{{sql: config.SQL, params: config.Params}}
+		}
+		err := runQueryMetrics(runContext, container, queries)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "tenant-isolation":
+		err := validateTenantIsolation(runContext, container, config.TenantID, config.TenantID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Tenant isolation holds: every item under the partition key of %s belongs to it\n", config.TenantID)
+	case "list-tenants":
+		tenants, err := listTenants(runContext, container)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Tenants in container (%d)\n", len(tenants))
+		fmt.Println("==========================================")
+		for _, tenant := range tenants {
+			fmt.Println(tenant)
+		}
+	}
 }
 
-func main() {
+// runDemoQueries runs each query pattern once against sample keys
+func runDemoQueries() {
 	// Query with a full partition key
 	tenantID := "MidMarket-Inc"
 	userID := "user-192"
 	sessionID := "session-5af6ab47"
-	queryWithFullPartitionKey(tenantID, userID, sessionID)
+	printSessions(tenantID, &userID, &sessionID)
 
 	// Query with a partial partition key
 	_tenantID := "LocalShops-SME"
 	_userID := "user-42"
 	// partial key
-	queryWithTenantAndUserID(_tenantID, _userID)
+	printSessions(_tenantID, &_userID, nil)
+
+	// Distinct activities for the same tenant and user
+	distinctActivities, charge, err := queryDistinctActivities(_tenantID, _userID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Distinct activities for tenantId:", _tenantID, "and userId:", _userID)
+	fmt.Println("Activities:", distinctActivities)
+	fmt.Println("RUs consumed:", charge)
 
 	// Query with a single partition key parameter
 	queryWithSinglePKParameter("tenantId", "Enterprise-Corp")
@@ -67,163 +322,714 @@ func main() {
 	userID_ := "user-42"
 	sessionID_ := "session-0361ef4c"
 	id := "c0ba6ff6-a622-4b30-bcd3-b92960336976" // This should be the ID of the item you want to read
-	executePointRead(id, tenantID_, userID_, sessionID_)
+	_, fromFallback, err := executePointReadWithFallback(id, tenantID_, userID_, sessionID_)
+	if err != nil {
+		log.Printf("Point read failed: %v", err)
+	} else if fromFallback {
+		fmt.Println("Item was found by id with a cross partition query, check the partition key values")
+	}
+
+	// Read several items of the same logical partition in one query
+	items, charge, err := readMany(tenantID_, userID_, sessionID_, []string{id})
+	if err != nil {
+		log.Printf("Read many failed: %v", err)
+	} else {
+		fmt.Println("Read many found", len(items), "items, RUs consumed:", charge)
+	}
+
+	// Report the busiest logical partitions
+	queryHotPartitions(false)
+	queryHotPartitions(true)
+}
+
+// querySessions returns the sessions matching tenantID and whichever of userID
+// and sessionID are set, together with the RU charge
+func querySessions(tenantID string, userID, sessionID *string) ([]QueryResult, float64, error) {
+	pk, query, params, err := sessionsQuery(tenantID, userID, sessionID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results, totalCharge, err := queryContainers(runContext, containers, query, pk, params, queryOptions{})
+	if err != nil {
+		return nil, totalCharge, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return results, totalCharge, nil
+}
+
+// sessionsQuery builds the partition key, query and parameters of querySessions.
+// The partition key holds every level that was given, so the query is scoped as
+// narrowly as possible: a full key targets one logical partition, a prefix only
+// the partitions that hold it. sessionID is only used together with userID,
+// since a key prefix cannot skip a level
+func sessionsQuery(tenantID string, userID, sessionID *string) (partitionKey, string, []azcosmos.QueryParameter, error) {
+	query := "SELECT * FROM c WHERE c.tenantId = @tenantId"
+	pk := newPartitionKey(tenantID)
+	params := []azcosmos.QueryParameter{
+		{Name: "@tenantId", Value: tenantID},
+	}
+
+	if userID != nil {
+		query += " AND c.userId = @userId"
+		pk = pk.append(*userID)
+		params = append(params, azcosmos.QueryParameter{Name: "@userId", Value: *userID})
+
+		if sessionID != nil {
+			query += " AND c.sessionId = @sessionId"
+			pk = pk.append(*sessionID)
+			params = append(params, azcosmos.QueryParameter{Name: "@sessionId", Value: *sessionID})
+		}
+	} else if sessionID != nil {
+		return partitionKey{}, "", nil, fmt.Errorf("sessionId %q needs a userId to form a partition key prefix", *sessionID)
+	}
+	return pk, query, params, nil
+}
+
+// printSessions runs querySessions and prints the results and RU charge
+func printSessions(tenantID string, userID, sessionID *string) {
+	switch {
+	case sessionID != nil && userID != nil:
+		fmt.Println("Results for tenantId:", tenantID, "userId:", *userID, "and sessionId:", *sessionID)
+	case userID != nil:
+		fmt.Println("Results for tenantId:", tenantID, "and userId:", *userID)
+	default:
+		fmt.Println("Results for tenantId:", tenantID)
+	}
+	fmt.Println("==========================================")
+
+	pk, _, _, err := sessionsQuery(tenantID, userID, sessionID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	results, totalCharge, err := querySessions(tenantID, userID, sessionID)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, queryResult := range results {
+		fmt.Println("ID:", queryResult.ID)
+		fmt.Println("Session ID:", queryResult.SessionId)
+		fmt.Println("Activity:", queryResult.Activity)
+		fmt.Println("Timestamp:", queryResult.Timestamp)
+		printClientDetails(queryResult)
+
+		fmt.Println("==========================================")
+	}
+
+	fmt.Println("Total RUs consumed:", totalCharge, "routing:", describeRouting(pk), "consistency:", describeConsistency())
+}
+
+func queryWithSinglePKParameter(paramType, paramValue string) {
+	if paramType != "tenantId" && paramType != "userId" && paramType != "sessionId" {
+		log.Fatalf("Invalid parameter type: %s", paramType)
+	}
+
+	query := fmt.Sprintf("SELECT * FROM c WHERE c.%s = @param", paramType)
+	emptyPartitionKey := newPartitionKey()
+	params := []azcosmos.QueryParameter{
+		{Name: "@param", Value: paramValue},
+	}
+
+	fmt.Printf("Results for %s: %s\n", paramType, paramValue)
+	fmt.Println("==========================================")
+
+	results, totalCharge, err := queryContainers(runContext, containers, query, emptyPartitionKey, params, queryOptions{})
+	if errors.Is(err, errCrossPartitionNotAllowed) {
+		fmt.Println("Skipped:", err)
+		fmt.Println("==========================================")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, queryResult := range results {
+		fmt.Println("ID:", queryResult.ID)
+		fmt.Println("Tenant ID:", queryResult.TenantId)
+		fmt.Println("User ID:", queryResult.UserId)
+		fmt.Println("Session ID:", queryResult.SessionId)
+		fmt.Println("Activity:", queryResult.Activity)
+		fmt.Println("Timestamp:", queryResult.Timestamp)
+		printClientDetails(queryResult)
+
+		fmt.Println("==========================================")
+	}
+
+	fmt.Println("Total RUs consumed:", totalCharge, "routing:", describeRouting(emptyPartitionKey), "consistency:", describeConsistency())
+}
+
+// executePointRead reads a single item by id and its full partition key
+func executePointRead(id, tenantId, userId, sessionId string) (*QueryResult, error) {
+	// create a partition key using the full partition key values
+	pk := newPartitionKey(tenantId, userId, sessionId)
+
+	// perform a point read operation
+	resp, err := readItem(runContext, container, pk, id, itemOptions(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read item: %w", err)
+	}
+
+	queryResult, err := migrateDocument(resp.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	fmt.Println("Point Read Result for:", id, tenantId, userId, sessionId)
+
+	fmt.Println("Activity:", queryResult.Activity)
+	fmt.Println("Timestamp:", queryResult.Timestamp)
+	printClientDetails(queryResult)
+
+	fmt.Println("RUs consumed:", resp.RequestCharge, "consistency:", describeConsistency())
+
+	return &queryResult, nil
 }
 
-// queryWithFullPartitionKey let`s you user the full partition key for querying
-func queryWithFullPartitionKey(tenantID, userID, sessionID string) {
-	query := "SELECT * FROM c WHERE c.tenantId = @tenantId AND c.userId = @userId AND c.sessionId = @sessionId"
+// executePointReadWithFallback does a point read and, when the item is not found
+// under the given partition key, looks it up by id with a cross partition query.
+// The bool result reports whether the item came from the fallback query
+func executePointReadWithFallback(id, tenantId, userId, sessionId string) (*QueryResult, bool, error) {
+	queryResult, err := executePointRead(id, tenantId, userId, sessionId)
+	var respErr *azcore.ResponseError
+	if !(errors.As(err, &respErr) && respErr.StatusCode == 404) {
+		return queryResult, false, err
+	}
+
+	debugf("item %s not found under partition key %s/%s/%s, falling back to a query by id", id, tenantId, userId, sessionId)
 
-	pkFull := azcosmos.NewPartitionKeyString(tenantID).AppendString(userID).AppendString(sessionID)
+	query := "SELECT * FROM c WHERE c.id = @id"
+	emptyPartitionKey := newPartitionKey()
 
-	pager := container.NewQueryItemsPager(query, pkFull, &azcosmos.QueryOptions{
+	pager, err := newQueryPager(container, query, emptyPartitionKey, &azcosmos.QueryOptions{
 		QueryParameters: []azcosmos.QueryParameter{
-			{Name: "@tenantId", Value: tenantID},
-			{Name: "@userId", Value: userID},
-			{Name: "@sessionId", Value: sessionID},
+			{Name: "@id", Value: id},
 		},
 	})
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to query item by id: %w", err)
+	}
 
-	fmt.Println("Querying with full partition key:", pkFull)
-
+	var totalCharge float32
 	for pager.More() {
-		page, err := pager.NextPage(context.Background())
+		page, err := nextPage(runContext, pager, emptyPartitionKey)
 		if err != nil {
-			log.Fatal(err)
+			return nil, true, fmt.Errorf("failed to query item by id: %w", err)
 		}
+		totalCharge += page.RequestCharge
 
 		for _, _item := range page.Items {
-			var queryResult QueryResult
-			err = json.Unmarshal(_item, &queryResult)
+			queryResult, err := migrateDocument(_item)
 			if err != nil {
-				log.Fatal(err)
+				return nil, true, fmt.Errorf("failed to unmarshal item: %w", err)
 			}
-			fmt.Println("ID", queryResult.ID)
-			fmt.Println("Activity", queryResult.Activity)
-			fmt.Println("Timestamp", queryResult.Timestamp)
 
-			fmt.Println("RUs consumed", page.RequestCharge)
+			fmt.Println("Fallback Query Result for:", id, queryResult.TenantId, queryResult.UserId, queryResult.SessionId)
+			fmt.Println("Activity:", queryResult.Activity)
+			fmt.Println("Timestamp:", queryResult.Timestamp)
+			printClientDetails(queryResult)
+			fmt.Println("RUs consumed:", totalCharge)
+
+			return &queryResult, true, nil
 		}
 	}
+
+	return nil, true, fmt.Errorf("item %s not found in any partition", id)
+}
+
+// debugf logs a message when -debug is set
+func debugf(format string, args ...any) {
+	if debugLogging {
+		log.Printf("DEBUG: "+format, args...)
+	}
+}
+
+// readMany reads several items that share one full partition key with a single
+// IN query, which is cheaper than a point read per id
+func readMany(tenantId, userId, sessionId string, ids []string) ([]QueryResult, float64, error) {
+	if len(ids) == 0 {
+		return nil, 0, nil
+	}
+
+	pkFull, query, params := readManyQuery(tenantId, userId, sessionId, ids)
+	return runQuery(runContext, container, query, pkFull, params, queryOptions{})
+}
+
+// readManyQuery builds the partition key, query and parameters of readMany.
+// The key only holds the levels of the container, so the levels it leaves out
+// are filtered in the query, an id is only unique within its logical partition
+func readManyQuery(tenantId, userId, sessionId string, ids []string) (partitionKey, string, []azcosmos.QueryParameter) {
+	pkFull := newPartitionKey(tenantId, userId, sessionId)
+
+	placeholders := make([]string, len(ids))
+	params := make([]azcosmos.QueryParameter, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("@id%d", i)
+		params[i] = azcosmos.QueryParameter{Name: placeholders[i], Value: id}
+	}
+	query := fmt.Sprintf("SELECT * FROM c WHERE c.id IN (%s)", strings.Join(placeholders, ","))
+
+	levels := []struct{ field, value string }{{"tenantId", tenantId}, {"userId", userId}, {"sessionId", sessionId}}
+	for _, level := range levels[pkFull.depth():] {
+		query += fmt.Sprintf(" AND c.%s = @%s", level.field, level.field)
+		params = append(params, azcosmos.QueryParameter{Name: "@" + level.field, Value: level.value})
+	}
+	return pkFull, query, params
 }
 
-// queryWithTenantAndUserID lets you query with partial key, tenantId and userId
-func queryWithTenantAndUserID(tenantID, userID string) {
-	query := "SELECT * FROM c WHERE c.tenantId = @tenantId AND c.userId = @userId"
+// queryDistinctActivities returns the set of activity types a user performed
+// and the RU charge of the query
+func queryDistinctActivities(tenantID, userID string) ([]string, float64, error) {
+	query := "SELECT DISTINCT VALUE c.activity FROM c WHERE c.tenantId = @t AND c.userId = @u"
 
-	// since we don't have the full partition key, we use an empty partition key
-	emptyPartitionKey := azcosmos.NewPartitionKey()
+	// tenantId and userId form a prefix of the hierarchical partition key
+	pkPartial := newPartitionKey(tenantID, userID)
 
-	pager := container.NewQueryItemsPager(query, emptyPartitionKey, &azcosmos.QueryOptions{
+	pager, err := newQueryPager(container, query, pkPartial, &azcosmos.QueryOptions{
 		QueryParameters: []azcosmos.QueryParameter{
-			{Name: "@tenantId", Value: tenantID},
-			{Name: "@userId", Value: userID},
+			{Name: "@t", Value: tenantID},
+			{Name: "@u", Value: userID},
 		},
 	})
-	for pager.More() {
-		page, err := pager.NextPage(context.Background())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items, totalCharge, err := drainPager(runContext, pager, pkPartial)
+	if err != nil {
+		return nil, totalCharge, fmt.Errorf("failed to query distinct activities: %w", err)
+	}
+
+	// VALUE projections return bare scalars rather than documents
+	distinctActivities, err := unmarshalItems[string](items, "activity")
+	if err != nil {
+		return nil, totalCharge, err
+	}
+	return distinctActivities, totalCharge, nil
+}
+
+// getUserSessionHistory returns the sessions of a user within the last window
+// across containerClients, most recent first and capped at limit results. With
+// fields only those are fetched, and the timestamp the results are sorted by
+func getUserSessionHistory(ctx context.Context, containerClients []*azcosmos.ContainerClient, tenantID, userID string, window time.Duration, limit int, fields []string) ([]QueryResult, error) {
+	query := "SELECT TOP @limit * FROM c WHERE c.tenantId = @tenantId AND c.userId = @userId AND c.timestamp >= @cutoff"
+
+	// tenantId and userId form a prefix of the hierarchical partition key
+	pkPartial := newPartitionKey(tenantID, userID)
+
+	cutoff := time.Now().Add(-window).UTC().Format(time.RFC3339Nano)
+
+	params := []azcosmos.QueryParameter{
+		{Name: "@limit", Value: limit},
+		{Name: "@tenantId", Value: tenantID},
+		{Name: "@userId", Value: userID},
+		{Name: "@cutoff", Value: cutoff},
+	}
+
+	// the merge of several containers sorts by timestamp
+	if len(fields) > 0 && !slices.Contains(fields, "timestamp") {
+		fields = append(slices.Clip(fields), "timestamp")
+	}
+
+	history, _, err := queryContainers(ctx, containerClients, query, pkPartial, params, queryOptions{
+		orderBy: &orderByTimestampDesc,
+		fields:  fields,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session history: %w", err)
+	}
+
+	// each container is ordered on its own, so the merged results are not
+	if len(containerClients) > 1 {
+		sortByTimestampDesc(history)
+	}
+
+	// TOP bounds each container, the merged results of several can exceed it
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+// orderBy sorts query results by a top level document field
+type orderBy struct {
+	field      string
+	descending bool
+}
+
+// orderByTimestampDesc returns the most recent items first
+var orderByTimestampDesc = orderBy{field: "timestamp", descending: true}
+
+// queryOptions controls how runQuery builds and executes a query
+type queryOptions struct {
+	// orderBy appends an ORDER BY clause when set
+	orderBy *orderBy
+
+	// fields replaces SELECT * with these top level fields, the results only
+	// carry those
+	fields []string
+}
+
+// fieldNamePattern matches the document field names allowed in generated SQL
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// errOrderByIndexMissing is returned when Cosmos DB rejects an ORDER BY for lack of an index
+var errOrderByIndexMissing = errors.New("ordering requires an index")
+
+// errCrossPartitionNotAllowed is returned by newQueryPager for a query
+// without a partition key unless allowCrossPartition is set
+var errCrossPartitionNotAllowed = errors.New("cross partition query not allowed")
+
+// isCrossPartition reports whether pk carries no partition key values
+func isCrossPartition(pk partitionKey) bool {
+	return classifyPartitionKey(pk) == routingFanOut
+}
+
+// runQuery runs a query to completion and returns the items as QueryResult
+// together with the RU charge summed over all pages
+func runQuery(ctx context.Context, containerClient *azcosmos.ContainerClient, query string, pk partitionKey, params []azcosmos.QueryParameter, opts queryOptions) ([]QueryResult, float64, error) {
+	if opts.orderBy != nil {
+		if !fieldNamePattern.MatchString(opts.orderBy.field) {
+			return nil, 0, fmt.Errorf("invalid order by field %q", opts.orderBy.field)
+		}
+		direction := "ASC"
+		if opts.orderBy.descending {
+			direction = "DESC"
+		}
+		query = fmt.Sprintf("%s ORDER BY c.%s %s", query, opts.orderBy.field, direction)
+	}
+	if len(opts.fields) > 0 {
+		var err error
+		query, err = projectQuery(query, opts.fields)
 		if err != nil {
-			log.Fatal(err)
+			return nil, 0, err
 		}
+	}
 
-		fmt.Println("Results for tenantId:", tenantID, "and userId:", userID)
-		fmt.Println("==========================================")
-
-		for _, _item := range page.Items {
-			var queryResult QueryResult
-			err = json.Unmarshal(_item, &queryResult)
-			if err != nil {
-				log.Fatal(err)
-			}
+	pager, err := newQueryPager(containerClient, query, pk, &azcosmos.QueryOptions{
+		QueryParameters:  params,
+		ConsistencyLevel: consistencyLevel,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
 
-			fmt.Println("Session ID:", queryResult.SessionId)
-			fmt.Println("Activity:", queryResult.Activity)
-			fmt.Println("Timestamp:", queryResult.Timestamp)
+	items, totalCharge, err := drainPager(ctx, pager, pk)
+	if err != nil {
+		if opts.orderBy != nil && isOrderByIndexError(err) {
+			return nil, totalCharge, fmt.Errorf("%w: ORDER BY c.%s needs a range index on /%s (or a composite index when combined with filters) in the container's indexing policy: %v",
+				errOrderByIndexMissing, opts.orderBy.field, opts.orderBy.field, err)
+		}
+		return nil, totalCharge, err
+	}
 
-			fmt.Println("RUs consumed:", page.RequestCharge)
+	decode := migrateDocument
+	if len(opts.fields) > 0 {
+		decode = decodeProjected
+	}
 
-			fmt.Println("==========================================")
+	var results []QueryResult
+	for _, _item := range items {
+		queryResult, err := decode(_item)
+		if err != nil {
+			return nil, totalCharge, err
 		}
+		results = append(results, queryResult)
 	}
+	return results, totalCharge, nil
 }
 
-func queryWithSinglePKParameter(paramType, paramValue string) {
-	if paramType != "tenantId" && paramType != "userId" && paramType != "sessionId" {
-		log.Fatalf("Invalid parameter type: %s", paramType)
+// isOrderByIndexError reports whether err is the 400 Cosmos DB returns when no
+// index can serve an ORDER BY
+func isOrderByIndexError(err error) bool {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != 400 {
+		return false
 	}
 
-	query := fmt.Sprintf("SELECT * FROM c WHERE c.%s = @param", paramType)
-	emptyPartitionKey := azcosmos.NewPartitionKey()
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "order by") && strings.Contains(message, "index") ||
+		strings.Contains(message, "order-by") && strings.Contains(message, "index")
+}
 
-	pager := container.NewQueryItemsPager(query, emptyPartitionKey, &azcosmos.QueryOptions{
+// getLatestSessionPerUser returns the most recent activity timestamp of every
+// user in a tenant, scoped to the tenant with a one level partition key prefix
+func getLatestSessionPerUser(ctx context.Context, containerClient *azcosmos.ContainerClient, tenantID string) ([]UserLatestActivity, error) {
+	query := "SELECT c.userId, MAX(c.timestamp) AS latestTimestamp FROM c WHERE c.tenantId = @tenantId GROUP BY c.userId"
+
+	// tenantId alone is the first level of the hierarchical partition key
+	pkPrefix := newPartitionKey(tenantID)
+
+	pager, err := newQueryPager(containerClient, query, pkPrefix, &azcosmos.QueryOptions{
 		QueryParameters: []azcosmos.QueryParameter{
-			{Name: "@param", Value: paramValue},
+			{Name: "@tenantId", Value: tenantID},
 		},
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest session per user: %w", err)
+	}
 
-	for pager.More() {
-		page, err := pager.NextPage(context.Background())
+	items, _, err := drainPager(ctx, pager, pkPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest session per user: %w", err)
+	}
+	return unmarshalItems[UserLatestActivity](items, "latest activity")
+}
+
+// listTenants returns the sorted set of tenant IDs in the container. DISTINCT
+// across partitions is not supported, so tenant IDs are deduplicated client side
+func listTenants(ctx context.Context, containerClient *azcosmos.ContainerClient) ([]string, error) {
+	query := "SELECT c.tenantId FROM c"
+
+	// every tenant has to be visited, so this is a cross partition query
+	emptyPartitionKey := newPartitionKey()
+
+	pager, err := newQueryPager(containerClient, query, emptyPartitionKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+
+	items, _, err := drainPager(ctx, pager, emptyPartitionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	tenantItems, err := unmarshalItems[struct {
+		TenantId string `json:"tenantId"`
+	}](items, "tenant")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]struct{}{}
+	for _, item := range tenantItems {
+		seen[item.TenantId] = struct{}{}
+	}
+
+	tenants := make([]string, 0, len(seen))
+	for tenant := range seen {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	return tenants, nil
+}
+
+// queryStream runs a query in the background and sends each item on the results
+// channel as it arrives. Both channels are closed once the query finishes, at most
+// one error is sent, and cancelling ctx stops the query early
+func queryStream(ctx context.Context, sql string, params []azcosmos.QueryParameter, pk partitionKey) (<-chan QueryResult, <-chan error) {
+	results := make(chan QueryResult)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(results)
+		defer close(errs)
+
+		pager, err := newQueryPager(container, sql, pk, &azcosmos.QueryOptions{
+			QueryParameters:  params,
+			ConsistencyLevel: consistencyLevel,
+		})
 		if err != nil {
-			log.Fatal(err)
+			errs <- err
+			return
 		}
-		fmt.Printf("Results for %s: %s\n", paramType, paramValue)
-		fmt.Println("==========================================")
 
-		for _, _item := range page.Items {
-			var queryResult QueryResult
-			err = json.Unmarshal(_item, &queryResult)
+		for pager.More() {
+			page, err := nextPage(ctx, pager, pk)
 			if err != nil {
-				log.Fatal(err)
+				errs <- fmt.Errorf("failed to fetch page: %w", err)
+				return
 			}
 
-			fmt.Println("ID:", queryResult.ID)
-			fmt.Println("Tenant ID:", queryResult.TenantId)
-			fmt.Println("User ID:", queryResult.UserId)
-			fmt.Println("Session ID:", queryResult.SessionId)
-			fmt.Println("Activity:", queryResult.Activity)
-			fmt.Println("Timestamp:", queryResult.Timestamp)
+			for _, _item := range page.Items {
+				queryResult, err := migrateDocument(_item)
+				if err != nil {
+					errs <- fmt.Errorf("failed to unmarshal item: %w", err)
+					return
+				}
 
-			fmt.Println("RUs consumed:", page.RequestCharge)
+				select {
+				case results <- queryResult:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+		}
+	}()
 
-			fmt.Println("==========================================")
+	return results, errs
+}
+
+// queryHotPartitions groups items by tenantId (and userId when includeUser is set)
+// and prints the groups sorted by item count, busiest first
+func queryHotPartitions(includeUser bool) {
+	counts, err := queryPartitionCounts(runContext, container, includeUser)
+	if errors.Is(err, errCrossPartitionNotAllowed) {
+		fmt.Println("Skipped:", err)
+		fmt.Println("==========================================")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	total := 0
+	for _, partitionCount := range counts {
+		total += partitionCount.Count
+	}
+
+	if includeUser {
+		fmt.Println("Busiest partitions by tenantId and userId")
+	} else {
+		fmt.Println("Busiest partitions by tenantId")
+	}
+	fmt.Println("==========================================")
+
+	for _, partitionCount := range counts {
+		share := 0.0
+		if total > 0 {
+			share = float64(partitionCount.Count) / float64(total) * 100
+		}
+		if includeUser {
+			fmt.Printf("%s / %s: %d (%.1f%%)\n", partitionCount.TenantId, partitionCount.UserId, partitionCount.Count, share)
+		} else {
+			fmt.Printf("%s: %d (%.1f%%)\n", partitionCount.TenantId, partitionCount.Count, share)
 		}
 	}
+	fmt.Println("==========================================")
 }
 
-func executePointRead(id, tenantId, userId, sessionId string) {
-	// create a partition key using the full partition key values
-	pk := azcosmos.NewPartitionKeyString(tenantId).AppendString(userId).AppendString(sessionId)
+// queryPartitionCounts counts items per tenantId (and userId when includeUser is
+// set) and returns the groups sorted by count, busiest first
+func queryPartitionCounts(ctx context.Context, containerClient *azcosmos.ContainerClient, includeUser bool) ([]PartitionCount, error) {
+	query := "SELECT c.tenantId, COUNT(1) AS cnt FROM c GROUP BY c.tenantId"
+	if includeUser {
+		query = "SELECT c.tenantId, c.userId, COUNT(1) AS cnt FROM c GROUP BY c.tenantId, c.userId"
+	}
 
-	// perform a point read operation
-	resp, err := container.ReadItem(context.Background(), pk, id, nil)
+	// grouping spans every tenant, so this is a cross partition query
+	emptyPartitionKey := newPartitionKey()
+
+	pager, err := newQueryPager(containerClient, query, emptyPartitionKey, nil)
 	if err != nil {
-		log.Fatalf("Failed to read item: %v", err)
+		return nil, fmt.Errorf("failed to count items per partition: %w", err)
 	}
 
-	var queryResult QueryResult
-	err = json.Unmarshal(resp.Value, &queryResult)
+	items, _, err := drainPager(ctx, pager, emptyPartitionKey)
 	if err != nil {
-		log.Fatalf("Failed to unmarshal response: %v", err)
+		return nil, fmt.Errorf("failed to count items per partition: %w", err)
+	}
+	counts, err := unmarshalItems[PartitionCount](items, "partition count")
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Println("Point Read Result for:", id, tenantId, userId, sessionId)
-
-	fmt.Println("Activity:", queryResult.Activity)
-	fmt.Println("Timestamp:", queryResult.Timestamp)
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+	return counts, nil
+}
 
-	fmt.Println("RUs consumed:", resp.RequestCharge)
+// HotPartition is a (tenantId, userId) pair holding a large share of all items
+type HotPartition struct {
+	TenantID string
+	UserID   string
+	Count    int
+	Fraction float64
 }
 
-func getClient(endpoint string) (*azcosmos.Client, error) {
-	creds, err := azidentity.NewDefaultAzureCredential(nil)
+// detectHotPartitions returns the (tenantId, userId) pairs whose share of all
+// items exceeds threshold (0.0-1.0), busiest first
+func detectHotPartitions(ctx context.Context, containerClient *azcosmos.ContainerClient, threshold float64) ([]HotPartition, error) {
+	counts, err := queryPartitionCounts(ctx, containerClient, true)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := azcosmos.NewClient(endpoint, creds, nil)
+	total := 0
+	for _, partitionCount := range counts {
+		total += partitionCount.Count
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	var hot []HotPartition
+	for _, partitionCount := range counts {
+		fraction := float64(partitionCount.Count) / float64(total)
+		if fraction > threshold {
+			hot = append(hot, HotPartition{
+				TenantID: partitionCount.TenantId,
+				UserID:   partitionCount.UserId,
+				Count:    partitionCount.Count,
+				Fraction: fraction,
+			})
+		}
+	}
+	return hot, nil
+}
+
+// migrateDocument upgrades a raw item to the current schema version and
+// converts it to a QueryResult
+func migrateDocument(raw json.RawMessage) (QueryResult, error) {
+	session, err := model.MigrateDocument(raw)
 	if err != nil {
-		return nil, err
+		return QueryResult{}, err
+	}
+	userID, err := decryptField(piiCipher, session.UserID)
+	if err != nil {
+		return QueryResult{}, fmt.Errorf("failed to read userId: %w", err)
+	}
+	sessionID, err := decryptField(piiCipher, session.SessionID)
+	if err != nil {
+		return QueryResult{}, fmt.Errorf("failed to read sessionId: %w", err)
 	}
 
-	return client, nil
+	return QueryResult{
+		ID:            session.ID,
+		TenantId:      session.TenantID,
+		UserId:        userID,
+		SessionId:     sessionID,
+		Activity:      session.Activity,
+		Timestamp:     session.Timestamp.Format(time.RFC3339Nano),
+		SchemaVersion: session.SchemaVersion,
+		DeviceType:    session.DeviceType,
+		IPAddress:     session.IPAddress,
+		Country:       session.Country,
+		UserAgent:     session.UserAgent,
+		Anomalous:     session.Anomalous,
+		AnomalyType:   session.AnomalyType,
+	}, nil
+}
+
+// decryptField returns the plaintext of a field encrypted with -encrypt-pii.
+// Without a cipher, or when empty, the value is returned unchanged. A value the
+// cipher cannot decrypt, like one written without -encrypt-pii, is an error
+func decryptField(cipher *pii.Cipher, ciphertext string) (string, error) {
+	// a field left out of a projection is empty
+	if cipher == nil || ciphertext == "" {
+		return ciphertext, nil
+	}
+	plaintext, err := cipher.Decrypt(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %q: %w", ciphertext, err)
+	}
+	return plaintext, nil
+}
+
+// printClientDetails prints the device, location and user agent of a result,
+// documents written before these fields existed print nothing
+func printClientDetails(queryResult QueryResult) {
+	if queryResult.DeviceType != "" {
+		fmt.Println("Device:", queryResult.DeviceType)
+	}
+	if queryResult.Country != "" {
+		fmt.Println("Country:", queryResult.Country)
+	}
+	if queryResult.IPAddress != "" {
+		fmt.Println("IP Address:", queryResult.IPAddress)
+	}
+	if queryResult.UserAgent != "" {
+		fmt.Println("User Agent:", queryResult.UserAgent)
+	}
 }
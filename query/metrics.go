@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// metricsQuery is a query -query-mode query-metrics runs
+type metricsQuery struct {
+	sql    string
+	params []azcosmos.QueryParameter
+}
+
+// sampleMetricsQueries filter on a single field each, so the index metrics show
+// per field whether the indexing policy serves the filter or the query scans
+func sampleMetricsQueries(tenantID, userID string) []metricsQuery {
+	return []metricsQuery{
+		{"SELECT * FROM c WHERE c.tenantId = @value", []azcosmos.QueryParameter{{Name: "@value", Value: tenantID}}},
+		{"SELECT * FROM c WHERE c.userId = @value", []azcosmos.QueryParameter{{Name: "@value", Value: userID}}},
+		{"SELECT * FROM c WHERE c.activity = @value", []azcosmos.QueryParameter{{Name: "@value", Value: "login"}}},
+		{"SELECT * FROM c WHERE c.deviceType = @value", []azcosmos.QueryParameter{{Name: "@value", Value: "mobile"}}},
+	}
+}
+
+// queryStages are the execution stages reported in the query metrics header,
+// in execution order, with the label printed for each
+var queryStages = []struct {
+	key   string
+	label string
+}{
+	{"queryCompileTimeInMs", "Compile"},
+	{"queryLogicalPlanBuildTimeInMs", "Logical plan"},
+	{"queryPhysicalPlanBuildTimeInMs", "Physical plan"},
+	{"queryOptimizationTimeInMs", "Optimization"},
+	{"indexLookupTimeInMs", "Index lookup"},
+	{"documentLoadTimeInMs", "Document load"},
+	{"VMExecutionTimeInMs", "VM execution"},
+	{"systemFunctionExecuteTimeInMs", "System functions"},
+	{"userFunctionExecuteTimeInMs", "User functions"},
+	{"writeOutputTimeInMs", "Write output"},
+}
+
+// parseQueryMetrics parses the x-ms-documentdb-query-metrics header, a list of
+// name=value pairs separated by semicolons, and adds the values to totals
+func parseQueryMetrics(header string, totals map[string]float64) {
+	for _, pair := range strings.Split(header, ";") {
+		name, raw, found := strings.Cut(pair, "=")
+		if !found {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			continue
+		}
+		totals[strings.TrimSpace(name)] += value
+	}
+}
+
+// indexMetrics is the index utilization returned with PopulateIndexMetrics.
+// Utilized indexes served the query, potential ones would have helped it
+type indexMetrics struct {
+	UtilizedSingleIndexes     []singleIndexMetric    `json:"UtilizedSingleIndexes"`
+	PotentialSingleIndexes    []singleIndexMetric    `json:"PotentialSingleIndexes"`
+	UtilizedCompositeIndexes  []compositeIndexMetric `json:"UtilizedCompositeIndexes"`
+	PotentialCompositeIndexes []compositeIndexMetric `json:"PotentialCompositeIndexes"`
+}
+
+type singleIndexMetric struct {
+	IndexSpec        string `json:"IndexSpec"`
+	IndexImpactScore string `json:"IndexImpactScore"`
+}
+
+type compositeIndexMetric struct {
+	IndexSpecs       []string `json:"IndexSpecs"`
+	IndexImpactScore string   `json:"IndexImpactScore"`
+}
+
+// parseIndexMetrics decodes the x-ms-cosmos-index-utilization header, base64
+// encoded JSON on current service versions and plain JSON on older ones
+func parseIndexMetrics(header string) (indexMetrics, error) {
+	data := []byte(header)
+	if decoded, err := base64.StdEncoding.DecodeString(header); err == nil {
+		data = decoded
+	}
+
+	var metrics indexMetrics
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return indexMetrics{}, fmt.Errorf("failed to parse index metrics: %w", err)
+	}
+	return metrics, nil
+}
+
+// runQueryMetrics runs each query with query and index metrics enabled and
+// prints the RU charge, the time spent per execution stage and the indexes the
+// query used or would have needed. Cosmos DB only reports the RU charge of a
+// page as a whole, so the stage times show where that charge goes
+func runQueryMetrics(ctx context.Context, containerClient *azcosmos.ContainerClient, queries []metricsQuery) error {
+	for _, q := range queries {
+		if err := printQueryMetrics(ctx, containerClient, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printQueryMetrics runs one query to completion and prints its metrics
+func printQueryMetrics(ctx context.Context, containerClient *azcosmos.ContainerClient, q metricsQuery) error {
+	// the sample queries filter on one field, so they fan out to every partition
+	emptyPartitionKey := newPartitionKey()
+
+	pager, err := newQueryPager(containerClient, q.sql, emptyPartitionKey, &azcosmos.QueryOptions{
+		QueryParameters:      q.params,
+		ConsistencyLevel:     consistencyLevel,
+		PopulateIndexMetrics: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	totals := map[string]float64{}
+	var index *indexMetrics
+	var totalCharge float64
+	pages := 0
+	for pager.More() {
+		page, err := nextPage(ctx, pager, emptyPartitionKey)
+		if err != nil {
+			return fmt.Errorf("failed to run query: %w", err)
+		}
+		pages++
+		totalCharge += float64(page.RequestCharge)
+		if page.QueryMetrics != nil {
+			parseQueryMetrics(*page.QueryMetrics, totals)
+		}
+		// index utilization is the same on every page, the first one is enough
+		if index == nil && page.IndexMetrics != nil {
+			metrics, err := parseIndexMetrics(*page.IndexMetrics)
+			if err != nil {
+				debugf("%v", err)
+			} else {
+				index = &metrics
+			}
+		}
+	}
+
+	fmt.Println("Query metrics for:", q.sql)
+	fmt.Println("==========================================")
+	fmt.Printf("RUs consumed: %.2f over %d pages\n", totalCharge, pages)
+	fmt.Printf("Documents: %.0f retrieved, %.0f returned\n", totals["retrievedDocumentCount"], totals["outputDocumentCount"])
+	if pages > 0 {
+		// the ratio is reported per page, so average it
+		fmt.Printf("Index utilization ratio: %.2f\n", totals["indexUtilizationRatio"]/float64(pages))
+	}
+	fmt.Printf("Total execution time: %.2f ms\n", totals["totalExecutionTimeInMs"])
+	for _, stage := range queryStages {
+		if value, ok := totals[stage.key]; ok && value > 0 {
+			fmt.Printf(" %-17s %.2f ms\n", stage.label+":", value)
+		}
+	}
+
+	if index == nil {
+		fmt.Println("Index metrics: not returned")
+	} else {
+		printIndexMetrics(*index)
+	}
+	fmt.Println("==========================================")
+	return nil
+}
+
+// printIndexMetrics prints the utilized and potential indexes of a query. A
+// query with potential but no utilized single indexes is scanning
+func printIndexMetrics(metrics indexMetrics) {
+	for _, index := range metrics.UtilizedSingleIndexes {
+		fmt.Printf("Utilized index: %s (impact %s)\n", index.IndexSpec, index.IndexImpactScore)
+	}
+	for _, index := range metrics.UtilizedCompositeIndexes {
+		fmt.Printf("Utilized composite index: %s (impact %s)\n", strings.Join(index.IndexSpecs, ", "), index.IndexImpactScore)
+	}
+	for _, index := range metrics.PotentialSingleIndexes {
+		fmt.Printf("Potential index: %s (impact %s), add it to the indexing policy\n", index.IndexSpec, index.IndexImpactScore)
+	}
+	for _, index := range metrics.PotentialCompositeIndexes {
+		fmt.Printf("Potential composite index: %s (impact %s)\n", strings.Join(index.IndexSpecs, ", "), index.IndexImpactScore)
+	}
+	if len(metrics.UtilizedSingleIndexes) == 0 && len(metrics.UtilizedCompositeIndexes) == 0 {
+		fmt.Println("No index was used: the query scanned the documents")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// containers are the containers the session queries fan out to, the -containers
+// list or just -container. They share the schema and partition key
+var containers []*azcosmos.ContainerClient
+
+// queryContainers runs the same query against every container concurrently and
+// returns the merged results, in container order, with the RU charge summed
+// across all of them. A failing container fails the whole query
+func queryContainers(ctx context.Context, containerClients []*azcosmos.ContainerClient, query string, pk partitionKey, params []azcosmos.QueryParameter, opts queryOptions) ([]QueryResult, float64, error) {
+	if len(containerClients) == 1 {
+		return runQuery(ctx, containerClients[0], query, pk, params, opts)
+	}
+
+	type containerResult struct {
+		results []QueryResult
+		charge  float64
+		err     error
+	}
+	perContainer := make([]containerResult, len(containerClients))
+
+	var wg sync.WaitGroup
+	for i, containerClient := range containerClients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, charge, err := runQuery(ctx, containerClient, query, pk, params, opts)
+			if err != nil {
+				err = fmt.Errorf("container %s: %w", containerClient.ID(), err)
+			}
+			perContainer[i] = containerResult{results: results, charge: charge, err: err}
+		}()
+	}
+	wg.Wait()
+
+	var merged []QueryResult
+	var totalCharge float64
+	var errs []error
+	for _, result := range perContainer {
+		merged = append(merged, result.results...)
+		totalCharge += result.charge
+		if result.err != nil {
+			errs = append(errs, result.err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, totalCharge, errors.Join(errs...)
+	}
+	debugf("queried %d containers: %d results, %.2f RUs", len(containerClients), len(merged), totalCharge)
+	return merged, totalCharge, nil
+}
+
+// sortByTimestampDesc restores the most recent first order of results merged
+// from several containers. Timestamps that do not parse compare as strings
+func sortByTimestampDesc(results []QueryResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, errA := time.Parse(time.RFC3339Nano, results[i].Timestamp)
+		b, errB := time.Parse(time.RFC3339Nano, results[j].Timestamp)
+		if errA != nil || errB != nil {
+			return results[i].Timestamp > results[j].Timestamp
+		}
+		return a.After(b)
+	})
+}
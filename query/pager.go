@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// newQueryPager returns a pager running query on pk. A query without a
+// partition key is sent to every physical partition, so it is refused with
+// errCrossPartitionNotAllowed unless -allow-cross-partition is set
+func newQueryPager(containerClient *azcosmos.ContainerClient, query string, pk partitionKey, options *azcosmos.QueryOptions) (*runtime.Pager[azcosmos.QueryItemsResponse], error) {
+	if isCrossPartition(pk) && !allowCrossPartition {
+		return nil, fmt.Errorf("%w: %q has no partition key and would be sent to every physical partition, "+
+			"costing RUs on each of them; add the tenantId (and userId, sessionId) to the partition key or pass -allow-cross-partition",
+			errCrossPartitionNotAllowed, query)
+	}
+	return containerClient.NewQueryItemsPager(query, pk.sdk(), options), nil
+}
+
+// drainPager fetches every page of pager, a query on pk, and returns the raw
+// items of all pages with the RU charge summed across them. A failing page is
+// reported with its page number, the charge of the pages before it is kept
+func drainPager(ctx context.Context, pager *runtime.Pager[azcosmos.QueryItemsResponse], pk partitionKey) ([][]byte, float64, error) {
+	var items [][]byte
+	var totalCharge float64
+	for pageNumber := 1; pager.More(); pageNumber++ {
+		page, err := nextPage(ctx, pager, pk)
+		if err != nil {
+			return nil, totalCharge, fmt.Errorf("failed to fetch page %d: %w", pageNumber, err)
+		}
+		totalCharge += float64(page.RequestCharge)
+		items = append(items, page.Items...)
+	}
+	return items, totalCharge, nil
+}
+
+// unmarshalItems decodes every raw item into a T, naming what failed to decode
+func unmarshalItems[T any](items [][]byte, what string) ([]T, error) {
+	var values []T
+	for _, _item := range items {
+		var value T
+		if err := json.Unmarshal(_item, &value); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %w", what, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/pii"
+)
+
+// testCipher returns a cipher with a key derived from seed
+func testCipher(t *testing.T, seed byte) *pii.Cipher {
+	t.Helper()
+	key := make([]byte, pii.KeySize)
+	for i := range key {
+		key[i] = seed + byte(i)
+	}
+	cipher, err := pii.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func TestDecryptField(t *testing.T) {
+	cipher := testCipher(t, 0)
+	tests := []struct {
+		name    string
+		cipher  *pii.Cipher
+		stored  string
+		want    string
+		wantErr bool
+	}{
+		{name: "without -encryption-key", stored: "user-42", want: "user-42"},
+		{name: "encrypted", cipher: cipher, stored: cipher.Encrypt("user-42"), want: "user-42"},
+		{name: "encrypted session", cipher: cipher, stored: cipher.Encrypt("session-5af6ab47"), want: "session-5af6ab47"},
+		{name: "not projected", cipher: cipher, stored: "", want: ""},
+		{name: "written without -encrypt-pii", cipher: cipher, stored: "user-42", wantErr: true},
+		{name: "encrypted with another key", cipher: testCipher(t, 1), stored: cipher.Encrypt("user-42"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptField(tt.cipher, tt.stored)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decryptField(%q) error = %v, wantErr %v", tt.stored, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decryptField(%q) = %q, want %q", tt.stored, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateDocumentDecryptError(t *testing.T) {
+	piiCipher = testCipher(t, 0)
+	t.Cleanup(func() { piiCipher = nil })
+
+	raw, err := json.Marshal(map[string]any{
+		"id":            "a1",
+		"tenantId":      "tenant-1",
+		"userId":        "user-42",
+		"sessionId":     piiCipher.Encrypt("session-1"),
+		"activity":      "login",
+		"timestamp":     "2026-01-02T03:04:05Z",
+		"schemaVersion": 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrateDocument(raw); err == nil {
+		t.Error("migrateDocument() of a userId written without -encrypt-pii succeeded, want an error")
+	}
+	if _, err := decodeProjected(raw); err == nil {
+		t.Error("decodeProjected() of a userId written without -encrypt-pii succeeded, want an error")
+	}
+}
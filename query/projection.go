@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// projectQuery turns a "SELECT * FROM c ..." or "SELECT TOP n * FROM c ..."
+// query into one that returns only fields, which costs fewer RUs the larger
+// the documents and results are
+func projectQuery(query string, fields []string) (string, error) {
+	head, rest, ok := strings.Cut(query, "* FROM c")
+	if !ok || !strings.HasPrefix(head, "SELECT ") {
+		return "", fmt.Errorf("cannot project %q: only SELECT * FROM c queries can be projected", query)
+	}
+
+	projection := make([]string, len(fields))
+	for i, field := range fields {
+		if !fieldNamePattern.MatchString(field) {
+			return "", fmt.Errorf("invalid projected field %q", field)
+		}
+		projection[i] = "c." + field
+	}
+	return head + strings.Join(projection, ", ") + " FROM c" + rest, nil
+}
+
+// decodeProjected unmarshals a projected item into the fields of QueryResult
+// it carries, the others stay empty. Unlike migrateDocument it does not parse
+// the timestamp, which may not have been selected
+func decodeProjected(raw json.RawMessage) (QueryResult, error) {
+	var result QueryResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return QueryResult{}, fmt.Errorf("failed to unmarshal projected item: %w", err)
+	}
+	var err error
+	if result.UserId, err = decryptField(piiCipher, result.UserId); err != nil {
+		return QueryResult{}, fmt.Errorf("failed to read userId: %w", err)
+	}
+	if result.SessionId, err = decryptField(piiCipher, result.SessionId); err != nil {
+		return QueryResult{}, fmt.Errorf("failed to read sessionId: %w", err)
+	}
+	return result, nil
+}
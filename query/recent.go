@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// recentSessionsQuery builds the query of getRecentSessions. A filter and an
+// ORDER BY on different properties can only be served by a composite index, and
+// Cosmos DB only uses it when the filtered properties lead the ORDER BY
+func recentSessionsQuery(tenantID string, userID *string, limit int) (partitionKey, string, []azcosmos.QueryParameter) {
+	query := "SELECT TOP @limit * FROM c WHERE c.tenantId = @tenantId"
+	orderBy := " ORDER BY c.tenantId ASC, c.timestamp DESC"
+	pk := newPartitionKey(tenantID)
+	params := []azcosmos.QueryParameter{
+		{Name: "@limit", Value: limit},
+		{Name: "@tenantId", Value: tenantID},
+	}
+
+	if userID != nil {
+		query += " AND c.userId = @userId"
+		orderBy = " ORDER BY c.tenantId ASC, c.userId ASC, c.timestamp DESC"
+		pk = pk.append(*userID)
+		params = append(params, azcosmos.QueryParameter{Name: "@userId", Value: *userID})
+	}
+	return pk, query + orderBy, params
+}
+
+// getRecentSessions returns the most recent sessions of a tenant, or of one of
+// its users, newest first and capped at limit, together with the RU charge.
+// With fields only those are fetched
+func getRecentSessions(ctx context.Context, containerClient *azcosmos.ContainerClient, tenantID string, userID *string, limit int, fields []string) ([]QueryResult, float64, partitionKey, error) {
+	pk, query, params := recentSessionsQuery(tenantID, userID, limit)
+
+	results, charge, err := runQuery(ctx, containerClient, query, pk, params, queryOptions{fields: fields})
+	if isOrderByIndexError(err) {
+		return nil, charge, pk, fmt.Errorf("%w: %q needs the composite indexes the loader creates with -composite-indexes: %v",
+			errOrderByIndexMissing, query, err)
+	}
+	if err != nil {
+		return nil, charge, pk, fmt.Errorf("failed to query recent sessions: %w", err)
+	}
+	return results, charge, pk, nil
+}
+
+// printRecentSessions runs getRecentSessions and prints the sessions and the
+// RU charge, which shows what the composite index saves against a client side sort
+func printRecentSessions(ctx context.Context, containerClient *azcosmos.ContainerClient, tenantID string, userID *string, limit int, fields []string) error {
+	results, charge, pk, err := getRecentSessions(ctx, containerClient, tenantID, userID, limit, fields)
+	if err != nil {
+		return err
+	}
+
+	// the results are decrypted already, userID is the encrypted lookup value
+	if userID != nil {
+		plainUserID, err := decryptField(piiCipher, *userID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Most recent sessions for tenantId: %s and userId: %s (%d results)\n", tenantID, plainUserID, len(results))
+	} else {
+		fmt.Printf("Most recent sessions for tenantId: %s (%d results)\n", tenantID, len(results))
+	}
+	fmt.Println("==========================================")
+	for _, queryResult := range results {
+		fmt.Println("Timestamp:", queryResult.Timestamp)
+		fmt.Println("User ID:", queryResult.UserId)
+		fmt.Println("Session ID:", queryResult.SessionId)
+		fmt.Println("Activity:", queryResult.Activity)
+		fmt.Println("==========================================")
+	}
+	fmt.Println("Total RUs consumed:", charge, "routing:", describeRouting(pk), "consistency:", describeConsistency())
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// partitionKeyLevels is the depth of the container's hierarchical partition
+// key, set by the -pk-levels flag: /tenantId, /userId, /sessionId
+var partitionKeyLevels = 3
+
+// partitionKey is a hierarchical partition key together with the values it
+// was built from. azcosmos.PartitionKey does not expose its values, which the
+// routing report, the cross partition guard and the diagnostics need
+type partitionKey struct {
+	values []string
+}
+
+// newPartitionKey returns the key of values, no values is the empty key of a
+// cross partition query. Values deeper than partitionKeyLevels are dropped, a
+// container keyed on fewer levels only takes the leading ones
+func newPartitionKey(values ...string) partitionKey {
+	return partitionKey{values: values[:min(len(values), partitionKeyLevels)]}
+}
+
+// append returns pk extended by one more level, or pk itself when it already
+// holds every level of the container
+func (pk partitionKey) append(value string) partitionKey {
+	if len(pk.values) >= partitionKeyLevels {
+		return pk
+	}
+	return partitionKey{values: append(pk.values[:len(pk.values):len(pk.values)], value)}
+}
+
+// depth returns the number of levels pk carries
+func (pk partitionKey) depth() int {
+	return len(pk.values)
+}
+
+// sdk returns pk as the SDK builds and sends it
+func (pk partitionKey) sdk() azcosmos.PartitionKey {
+	if len(pk.values) == 0 {
+		return azcosmos.NewPartitionKey()
+	}
+	key := azcosmos.NewPartitionKeyString(pk.values[0])
+	for _, value := range pk.values[1:] {
+		key = key.AppendString(value)
+	}
+	return key
+}
+
+// routingClass describes how Cosmos DB routes a query for a given partition key
+type routingClass string
+
+const (
+	// routingFullKey targets a single logical partition
+	routingFullKey routingClass = "full key"
+	// routingPrefixKey targets only the physical partitions holding the prefix
+	routingPrefixKey routingClass = "prefix key"
+	// routingFanOut sends the query to every physical partition
+	routingFanOut routingClass = "fan-out"
+)
+
+// classifyPartitionKey reports whether pk is a full hierarchical key, a prefix
+// of it, or empty
+func classifyPartitionKey(pk partitionKey) routingClass {
+	switch depth := pk.depth(); {
+	case depth == 0:
+		return routingFanOut
+	case depth < partitionKeyLevels:
+		return routingPrefixKey
+	default:
+		return routingFullKey
+	}
+}
+
+// describeRouting returns the routing class of pk with the number of key
+// levels it carries, e.g. "prefix key (2 of 3 levels)"
+func describeRouting(pk partitionKey) string {
+	return fmt.Sprintf("%s (%d of %d levels)", classifyPartitionKey(pk), pk.depth(), partitionKeyLevels)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPartitionKeyLevels(t *testing.T) {
+	user, session := "user-1", "session-1"
+	tests := []struct {
+		levels      int
+		wantPoint   []string
+		wantPrefix  []string
+		wantRouting routingClass
+		wantFilters []string
+	}{
+		{
+			levels:      1,
+			wantPoint:   []string{"tenant-1"},
+			wantPrefix:  []string{"tenant-1"},
+			wantRouting: routingFullKey,
+			wantFilters: []string{"c.userId = @userId", "c.sessionId = @sessionId"},
+		},
+		{
+			levels:      2,
+			wantPoint:   []string{"tenant-1", "user-1"},
+			wantPrefix:  []string{"tenant-1", "user-1"},
+			wantRouting: routingFullKey,
+			wantFilters: []string{"c.sessionId = @sessionId"},
+		},
+		{
+			levels:      3,
+			wantPoint:   []string{"tenant-1", "user-1", "session-1"},
+			wantPrefix:  []string{"tenant-1", "user-1"},
+			wantRouting: routingPrefixKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d levels", tt.levels), func(t *testing.T) {
+			partitionKeyLevels = tt.levels
+			t.Cleanup(func() { partitionKeyLevels = 3 })
+
+			if pk := newPartitionKey("tenant-1", user, session); !slices.Equal(pk.values, tt.wantPoint) {
+				t.Errorf("point read key = %v, want %v", pk.values, tt.wantPoint)
+			}
+
+			pk, _, _, err := sessionsQuery("tenant-1", &user, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(pk.values, tt.wantPrefix) {
+				t.Errorf("sessions query key = %v, want %v", pk.values, tt.wantPrefix)
+			}
+			if got := classifyPartitionKey(pk); got != tt.wantRouting {
+				t.Errorf("sessions query routing = %s, want %s", got, tt.wantRouting)
+			}
+
+			pk, query, params := readManyQuery("tenant-1", user, session, []string{"a", "b"})
+			if !slices.Equal(pk.values, tt.wantPoint) {
+				t.Errorf("read many key = %v, want %v", pk.values, tt.wantPoint)
+			}
+			// the levels left out of the key are filtered in the query
+			for _, filter := range tt.wantFilters {
+				if !strings.Contains(query, filter) {
+					t.Errorf("read many query %q does not filter %s", query, filter)
+				}
+			}
+			if want := 2 + len(tt.wantFilters); len(params) != want {
+				t.Errorf("read many has %d parameters, want %d", len(params), want)
+			}
+		})
+	}
+}
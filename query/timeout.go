@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/timeout"
+)
+
+// runContext bounds every query of the run, set by the -deadline flag
+var runContext = context.Background()
+
+// opTimeout bounds a single page fetch or point read, set by the -op-timeout flag
+var opTimeout time.Duration
+
+// nextPage fetches the next page of pager, a query on pk, within -op-timeout
+func nextPage(ctx context.Context, pager *runtime.Pager[azcosmos.QueryItemsResponse], pk partitionKey) (azcosmos.QueryItemsResponse, error) {
+	var page azcosmos.QueryItemsResponse
+	ctx, printTrace := traceOperation(ctx, "query page")
+	defer printTrace()
+	err := timeout.WithOpTimeout(ctx, opTimeout, func(ctx context.Context) error {
+		var err error
+		page, err = pager.NextPage(ctx)
+		return err
+	})
+	if err != nil {
+		printDiagnostics("query page", pk, err)
+	}
+	return page, err
+}
+
+// readItem does a point read within -op-timeout
+func readItem(ctx context.Context, containerClient *azcosmos.ContainerClient, pk partitionKey, id string, options *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	var resp azcosmos.ItemResponse
+	ctx, printTrace := traceOperation(ctx, "point read of "+id)
+	defer printTrace()
+	err := timeout.WithOpTimeout(ctx, opTimeout, func(ctx context.Context) error {
+		var err error
+		resp, err = containerClient.ReadItem(ctx, pk.sdk(), id, options)
+		return err
+	})
+	if err != nil {
+		printDiagnostics("point read of "+id, pk, err)
+	}
+	return resp, err
+}
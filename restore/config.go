@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/config"
+)
+
+// transactional batches are limited to 100 operations
+const maxBatchSize = 100
+
+// configuration for Azure Cosmos DB connection and the restore
+type Config struct {
+	config.Connection
+	Input   string
+	Workers int
+	Batch   int
+}
+
+// loadConfig defines the restore flags, parses args and validates the result
+func loadConfig(args []string) (Config, error) {
+	loader := config.NewLoader("restore")
+	fs := loader.FlagSet
+
+	var cfg Config
+	fs.StringVar(&cfg.Input, "input", "", "Path to a .ndjson.gz archive written by the snapshot command")
+	fs.IntVar(&cfg.Workers, "workers", 4, "Number of concurrent writer goroutines")
+	fs.IntVar(&cfg.Batch, "batch", 1, fmt.Sprintf("Records collected per write, records sharing a partition key are written as one transactional batch (max %d)", maxBatchSize))
+
+	connection, err := loader.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Connection = connection
+
+	if cfg.Input == "" {
+		return Config{}, fmt.Errorf("-input is required")
+	}
+	if cfg.Workers < 1 {
+		return Config{}, fmt.Errorf("invalid -workers %d: must be at least 1", cfg.Workers)
+	}
+	if cfg.Batch < 1 || cfg.Batch > maxBatchSize {
+		return Config{}, fmt.Errorf("invalid -batch %d: must be between 1 and %d", cfg.Batch, maxBatchSize)
+	}
+
+	return cfg, nil
+}
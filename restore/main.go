@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/retry"
+)
+
+// the largest line accepted from an archive, Cosmos DB items are at most 2 MB
+const maxLineSize = 4 * 1024 * 1024
+
+// restoreStats accumulates the outcome of a restore, it is safe to update from
+// several goroutines at once
+type restoreStats struct {
+	mu       sync.Mutex
+	restored int
+	skipped  int
+	errors   int
+	charge   float64
+	tenants  map[string]int
+}
+
+// add counts n restored records of tenant and the RUs they consumed
+func (s *restoreStats) add(tenant string, n int, charge float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restored += n
+	s.charge += charge
+	s.tenants[tenant] += n
+}
+
+// fail counts n records that could not be written
+func (s *restoreStats) fail(n int, charge float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors += n
+	s.charge += charge
+}
+
+func main() {
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	client, err := config.OpenClient()
+	if err != nil {
+		log.Fatalf("Failed to create Cosmos DB client: %v", err)
+	}
+
+	containerClient, err := client.NewContainer(config.DatabaseName, config.ContainerName)
+	if err != nil {
+		log.Fatalf("Failed to get container client: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Restoring %s into %s/%s with %d workers (batch %d)\n", config.Input, config.DatabaseName, config.ContainerName, config.Workers, config.Batch)
+	start := time.Now()
+	stats, err := restoreSnapshot(ctx, containerClient, config)
+	if stats != nil {
+		printRestoreSummary(stats, time.Since(start))
+	}
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	if stats.errors > 0 {
+		log.Fatalf("Restore completed with %d errors", stats.errors)
+	}
+}
+
+// record is one line of the archive. The body is written as read, so fields
+// the current model does not know survive the restore
+type record struct {
+	id     string
+	tenant string
+	keys   []string // partition key values in the order of the container's paths
+	body   []byte
+}
+
+// restoreSnapshot reads the archive and upserts every record with the
+// partition key the container defines, read from the record's own fields.
+// Records missing one of those fields are skipped
+func restoreSnapshot(ctx context.Context, containerClient *azcosmos.ContainerClient, config Config) (*restoreStats, error) {
+	containerResponse, err := containerClient.Read(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container properties: %w", err)
+	}
+	keyPaths := containerResponse.ContainerProperties.PartitionKeyDefinition.Paths
+	fmt.Printf("Partition key paths: %s\n", strings.Join(keyPaths, ", "))
+
+	file, err := os.Open(config.Input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	archive, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", config.Input, err)
+	}
+	defer archive.Close()
+
+	stats := &restoreStats{tenants: make(map[string]int)}
+	records := make(chan record, config.Workers*config.Batch)
+
+	var wg sync.WaitGroup
+	for range config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			restoreWorker(ctx, containerClient, config.Batch, records, stats)
+		}()
+	}
+
+	scanner := bufio.NewScanner(archive)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() && ctx.Err() == nil {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		rec, err := parseRecord(slices.Clone(scanner.Bytes()), keyPaths)
+		if err != nil {
+			log.Printf("Warning: skipping line %d (id %q): %v", line, rec.id, err)
+			stats.mu.Lock()
+			stats.skipped++
+			stats.mu.Unlock()
+			continue
+		}
+
+		select {
+		case records <- rec:
+		case <-ctx.Done():
+		}
+	}
+	close(records)
+	wg.Wait()
+
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read snapshot %s at line %d: %w", config.Input, line+1, err)
+	}
+	if ctx.Err() != nil {
+		return stats, fmt.Errorf("interrupted after line %d", line)
+	}
+	return stats, nil
+}
+
+// parseRecord reads the id, the tenant and the values of keyPaths from one
+// archive line. The id is set even when a key value is missing
+func parseRecord(body []byte, keyPaths []string) (record, error) {
+	var document map[string]any
+	if err := json.Unmarshal(body, &document); err != nil {
+		return record{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+	rec := record{body: body}
+	rec.id, _ = document["id"].(string)
+	rec.tenant, _ = document["tenantId"].(string)
+	if rec.id == "" {
+		return rec, fmt.Errorf("no id")
+	}
+
+	for _, path := range keyPaths {
+		value, ok := lookupPath(document, path)
+		if !ok {
+			return rec, fmt.Errorf("no string value at partition key path %s", path)
+		}
+		rec.keys = append(rec.keys, value)
+	}
+	return rec, nil
+}
+
+// lookupPath returns the string at a partition key path such as /tenantId or
+// /address/country
+func lookupPath(document map[string]any, path string) (string, bool) {
+	var value any = document
+	for _, field := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[field]; !ok {
+			return "", false
+		}
+	}
+	s, ok := value.(string)
+	return s, ok && s != ""
+}
+
+// restoreWorker collects up to batchSize records at a time and writes them
+func restoreWorker(ctx context.Context, containerClient *azcosmos.ContainerClient, batchSize int, records <-chan record, stats *restoreStats) {
+	pending := make([]record, 0, batchSize)
+	for rec := range records {
+		pending = append(pending, rec)
+		if len(pending) == batchSize {
+			writeRecords(ctx, containerClient, pending, stats)
+			pending = pending[:0]
+		}
+	}
+	if len(pending) > 0 {
+		writeRecords(ctx, containerClient, pending, stats)
+	}
+}
+
+// writeRecords groups records by partition key, single records are upserted
+// and groups are upserted in one transactional batch. Throttled and timed out
+// writes are retried with retry.Default
+func writeRecords(ctx context.Context, containerClient *azcosmos.ContainerClient, records []record, stats *restoreStats) {
+	groups := make(map[string][]record)
+	var order []string
+	for _, rec := range records {
+		key := strings.Join(rec.keys, "\x00")
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], rec)
+	}
+
+	for _, key := range order {
+		group := groups[key]
+		partitionKey := azcosmos.NewPartitionKeyString(group[0].keys[0])
+		for _, value := range group[0].keys[1:] {
+			partitionKey = partitionKey.AppendString(value)
+		}
+
+		if len(group) == 1 {
+			var charge float64
+			err := retry.Default.Execute(ctx, func() error {
+				resp, err := containerClient.UpsertItem(ctx, partitionKey, group[0].body, nil)
+				charge += float64(resp.RequestCharge)
+				return err
+			})
+			if err != nil {
+				log.Printf("Failed to upsert item %s: %v", group[0].id, err)
+				stats.fail(1, charge)
+				continue
+			}
+			stats.add(group[0].tenant, 1, charge)
+			continue
+		}
+
+		batch := containerClient.NewTransactionalBatch(partitionKey)
+		for _, rec := range group {
+			batch.UpsertItem(rec.body, nil)
+		}
+		var resp azcosmos.TransactionalBatchResponse
+		var charge float64
+		err := retry.Default.Execute(ctx, func() error {
+			var err error
+			resp, err = containerClient.ExecuteTransactionalBatch(ctx, batch, nil)
+			charge += float64(resp.RequestCharge)
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to upsert batch of %d items for %v: %v", len(group), group[0].keys, err)
+			stats.fail(len(group), charge)
+			continue
+		}
+		if !resp.Success {
+			log.Printf("Batch of %d items for %v was rolled back", len(group), group[0].keys)
+			stats.fail(len(group), charge)
+			continue
+		}
+		stats.add(group[0].tenant, len(resp.OperationResults), charge)
+		stats.fail(len(group)-len(resp.OperationResults), 0)
+	}
+}
+
+// printRestoreSummary prints the totals and the restored records per tenant
+func printRestoreSummary(stats *restoreStats, elapsed time.Duration) {
+	fmt.Printf("\n📊 Restore Summary:\n")
+	fmt.Printf(" Restored: %d\n", stats.restored)
+	if stats.skipped > 0 {
+		fmt.Printf(" Skipped (invalid record): %d\n", stats.skipped)
+	}
+	if stats.errors > 0 {
+		fmt.Printf(" Failed: %d\n", stats.errors)
+	}
+	fmt.Printf(" Total RU consumed: %.2f\n", stats.charge)
+	fmt.Printf(" Elapsed: %v\n", elapsed.Round(time.Millisecond))
+
+	tenants := make([]string, 0, len(stats.tenants))
+	for tenant := range stats.tenants {
+		tenants = append(tenants, tenant)
+	}
+	slices.Sort(tenants)
+	fmt.Printf("\n Per tenant:\n")
+	for _, tenant := range tenants {
+		fmt.Printf("  %-20s %d\n", tenant, stats.tenants[tenant])
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/config"
+)
+
+// configuration for Azure Cosmos DB connection and the snapshot export
+type Config struct {
+	config.Connection
+	MaxDocs   int
+	OutputDir string
+}
+
+// loadConfig defines the snapshot flags, parses args and validates the result
+func loadConfig(args []string) (Config, error) {
+	loader := config.NewLoader("snapshot")
+	fs := loader.FlagSet
+
+	var cfg Config
+	fs.IntVar(&cfg.MaxDocs, "max-docs", 0, "Stop after exporting this many documents (0 exports everything)")
+	fs.StringVar(&cfg.OutputDir, "output-dir", ".", "Directory the snapshot archive is written to")
+
+	connection, err := loader.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Connection = connection
+
+	if cfg.MaxDocs < 0 {
+		return Config{}, fmt.Errorf("invalid -max-docs %d: must not be negative", cfg.MaxDocs)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// snapshotStats summarises an export
+type snapshotStats struct {
+	documents int
+	bytes     int64
+	charge    float64
+}
+
+func main() {
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	client, err := config.OpenClient()
+	if err != nil {
+		log.Fatalf("Failed to create Cosmos DB client: %v", err)
+	}
+
+	containerClient, err := client.NewContainer(config.DatabaseName, config.ContainerName)
+	if err != nil {
+		log.Fatalf("Failed to get container client: %v", err)
+	}
+
+	name := fmt.Sprintf("%s_%s.ndjson.gz", config.ContainerName, time.Now().UTC().Format("20060102T150405Z"))
+	path := filepath.Join(config.OutputDir, name)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Exporting %s/%s to %s\n", config.DatabaseName, config.ContainerName, path)
+	stats, err := exportSnapshot(ctx, containerClient, path, config.MaxDocs)
+	if err != nil {
+		// a partial archive would restore as if it were complete
+		os.Remove(path)
+		log.Fatalf("Snapshot failed: %v", err)
+	}
+
+	fmt.Printf("\n📦 Snapshot Summary:\n")
+	fmt.Printf(" Documents: %d\n", stats.documents)
+	fmt.Printf(" Bytes written: %d\n", stats.bytes)
+	fmt.Printf(" Total RU consumed: %.2f\n", stats.charge)
+}
+
+// exportSnapshot pages through every document in the container and writes them
+// as gzip compressed NDJSON to path. maxDocs limits the export when above 0
+func exportSnapshot(ctx context.Context, containerClient *azcosmos.ContainerClient, path string, maxDocs int) (snapshotStats, error) {
+	var stats snapshotStats
+
+	file, err := os.Create(path)
+	if err != nil {
+		return stats, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer file.Close()
+
+	counter := &countingWriter{w: file}
+	archive := gzip.NewWriter(counter)
+
+	// every partition has to be visited, so this is a cross partition query
+	emptyPartitionKey := azcosmos.NewPartitionKey()
+	pager := containerClient.NewQueryItemsPager("SELECT * FROM c", emptyPartitionKey, nil)
+
+pages:
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return stats, fmt.Errorf("failed to query documents: %w", err)
+		}
+		stats.charge += float64(page.RequestCharge)
+
+		for _, item := range page.Items {
+			if maxDocs > 0 && stats.documents >= maxDocs {
+				break pages
+			}
+			if _, err := archive.Write(append(item, '\n')); err != nil {
+				return stats, fmt.Errorf("failed to write document: %w", err)
+			}
+			stats.documents++
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return stats, fmt.Errorf("failed to finish snapshot archive: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return stats, fmt.Errorf("failed to close snapshot file: %w", err)
+	}
+	stats.bytes = counter.n
+
+	return stats, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/config"
+)
+
+// configuration for Azure Cosmos DB connection and the verification
+type Config struct {
+	config.Connection
+	Keep bool
+}
+
+// loadConfig defines the verify flags, parses args and validates the result
+func loadConfig(args []string) (Config, error) {
+	loader := config.NewLoader("verify")
+	fs := loader.FlagSet
+
+	var cfg Config
+	fs.BoolVar(&cfg.Keep, "keep", false, "Keep the test item instead of deleting it after the check")
+
+	connection, err := loader.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Connection = connection
+
+	return cfg, nil
+}
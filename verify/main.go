@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/google/uuid"
+
+	"github.com/EspiraMarvin/hierarchical-partition-keys.git/internal/model"
+)
+
+// keepTestItem is set by -keep, the test item is deleted after the check otherwise
+var keepTestItem bool
+
+func main() {
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	keepTestItem = config.Keep
+
+	client, err := config.OpenClient()
+	if err != nil {
+		log.Fatalf("Failed to create Cosmos DB client: %v", err)
+	}
+
+	containerClient, err := client.NewContainer(config.DatabaseName, config.ContainerName)
+	if err != nil {
+		log.Fatalf("Failed to get container client: %v", err)
+	}
+
+	fmt.Printf("Verifying read-your-writes on %s/%s\n", config.DatabaseName, config.ContainerName)
+	if err := testReadYourWrites(context.Background(), containerClient); err != nil {
+		log.Fatalf("❌ Read-your-writes check failed: %v", err)
+	}
+}
+
+// testReadYourWrites upserts one generated session under its full hierarchical
+// key and immediately point-reads it with the session token of the write. In
+// session consistency that token guarantees the read sees the write even when
+// another replica serves it, so any difference between the two documents fails
+// the check
+func testReadYourWrites(ctx context.Context, containerClient *azcosmos.ContainerClient) error {
+	session := model.UserSession{
+		ID:            uuid.NewString(),
+		TenantID:      "verify-tenant",
+		UserID:        "verify-user-" + uuid.NewString()[:8],
+		SessionID:     "verify-session-" + uuid.NewString()[:8],
+		Activity:      "read_your_writes",
+		Timestamp:     time.Now().UTC().Truncate(time.Millisecond),
+		SchemaVersion: model.SchemaVersion,
+		DeviceType:    "desktop",
+		IPAddress:     "192.0.2.10",
+		Country:       "KE",
+		UserAgent:     "verify/1.0",
+	}
+	pk := azcosmos.NewPartitionKeyString(session.TenantID).AppendString(session.UserID).AppendString(session.SessionID)
+
+	body, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	writeStart := time.Now()
+	writeResponse, err := containerClient.UpsertItem(ctx, pk, body, nil)
+	writeLatency := time.Since(writeStart)
+	if err != nil {
+		return fmt.Errorf("failed to write item: %w", err)
+	}
+	if !keepTestItem {
+		defer func() {
+			if _, err := containerClient.DeleteItem(ctx, pk, session.ID, nil); err != nil {
+				log.Printf("Failed to delete test item %s: %v", session.ID, err)
+			}
+		}()
+	}
+
+	if writeResponse.SessionToken == nil {
+		return fmt.Errorf("write of item %s returned no session token", session.ID)
+	}
+	sessionToken := *writeResponse.SessionToken
+
+	readStart := time.Now()
+	readResponse, err := containerClient.ReadItem(ctx, pk, session.ID, &azcosmos.ItemOptions{SessionToken: &sessionToken})
+	readLatency := time.Since(readStart)
+	if err != nil {
+		return fmt.Errorf("failed to read item back: %w", err)
+	}
+
+	var read model.UserSession
+	if err := json.Unmarshal(readResponse.Value, &read); err != nil {
+		return fmt.Errorf("failed to unmarshal read item: %w", err)
+	}
+
+	fmt.Println("==========================================")
+	fmt.Printf(" Item: %s\n", session.ID)
+	fmt.Printf(" Session token: %s\n", sessionToken)
+	fmt.Printf(" Write: %v, %.2f RUs, ETag %s\n", writeLatency.Round(time.Microsecond), writeResponse.RequestCharge, writeResponse.ETag)
+	fmt.Printf(" Read:  %v, %.2f RUs, ETag %s\n", readLatency.Round(time.Microsecond), readResponse.RequestCharge, readResponse.ETag)
+	fmt.Printf(" Round trip: %v, %.2f RUs\n", (writeLatency + readLatency).Round(time.Microsecond), writeResponse.RequestCharge+readResponse.RequestCharge)
+
+	// a different ETag means the read returned another version of the item
+	if readResponse.ETag != writeResponse.ETag {
+		return fmt.Errorf("read returned ETag %s, the write produced %s", readResponse.ETag, writeResponse.ETag)
+	}
+	if mismatches := diffSessions(session, read); len(mismatches) > 0 {
+		return fmt.Errorf("read item differs from the written one: %s", strings.Join(mismatches, ", "))
+	}
+
+	fmt.Println("✅ Read returned the written item unchanged")
+	return nil
+}
+
+// diffSessions compares want and got field by field and describes every field
+// that differs
+func diffSessions(want, got model.UserSession) []string {
+	var mismatches []string
+	check := func(field string, equal bool, wantValue, gotValue any) {
+		if !equal {
+			mismatches = append(mismatches, fmt.Sprintf("%s: wrote %v, read %v", field, wantValue, gotValue))
+		}
+	}
+
+	check("id", want.ID == got.ID, want.ID, got.ID)
+	check("tenantId", want.TenantID == got.TenantID, want.TenantID, got.TenantID)
+	check("userId", want.UserID == got.UserID, want.UserID, got.UserID)
+	check("sessionId", want.SessionID == got.SessionID, want.SessionID, got.SessionID)
+	check("activity", want.Activity == got.Activity, want.Activity, got.Activity)
+	check("timestamp", want.Timestamp.Equal(got.Timestamp), want.Timestamp, got.Timestamp)
+	check("schemaVersion", want.SchemaVersion == got.SchemaVersion, want.SchemaVersion, got.SchemaVersion)
+	check("ttl", want.TTL == got.TTL, want.TTL, got.TTL)
+	check("deviceType", want.DeviceType == got.DeviceType, want.DeviceType, got.DeviceType)
+	check("ipAddress", want.IPAddress == got.IPAddress, want.IPAddress, got.IPAddress)
+	check("country", want.Country == got.Country, want.Country, got.Country)
+	check("userAgent", want.UserAgent == got.UserAgent, want.UserAgent, got.UserAgent)
+	check("anomalous", want.Anomalous == got.Anomalous, want.Anomalous, got.Anomalous)
+	check("anomalyType", want.AnomalyType == got.AnomalyType, want.AnomalyType, got.AnomalyType)
+	return mismatches
+}